@@ -0,0 +1,388 @@
+package config
+
+import (
+  "errors"
+  "fmt"
+  "log"
+  "net"
+  "net/url"
+  "os"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  utils "github.com/ItsMeSamey/go_utils"
+  "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Settings of the backend. Each one is named after its environment variable and can also be set in .env or in the
+// YAML or TOML file named by CONFIG_FILE; the environment wins over .env, which wins over the file.
+type Config struct {
+  Debug   bool
+  Zerolog bool
+
+  ListenAddress   string
+  IdleTimeout     time.Duration
+  ReadTimeout     time.Duration
+  WriteTimeout    time.Duration
+  // How long /readyz fails before the listener closes, and how long in-flight requests may then take to finish
+  ShutdownDelay   time.Duration
+  ShutdownTimeout time.Duration
+  CORSOrigins     []string
+  // Header a reverse proxy puts the client address in, only believed for requests coming from TrustedProxies
+  ProxyHeader    string
+  TrustedProxies []string
+
+  // Separate listener for /metrics, empty disables it
+  MetricsListenAddress string
+
+  DatabaseURL string
+  // 0 keeps the pgxpool default
+  DBMaxConns int32
+  DBMinConns int32
+
+  AccessTokenTTL        time.Duration
+  RefreshTokenTTL       time.Duration
+  MFAChallengeTTL       time.Duration
+  MFARequiredForFaculty bool
+  JWTSigningKeys        []string
+  LoginLimiterStore     string
+
+  TranscriptSigningKeys []string
+  InstitutionName       string
+  PublicBaseURL         string
+  GPARetakePolicy       string
+
+  // Every setting as KEY=value in the order they were read, secrets redacted
+  summary []string
+}
+
+// Set by MustLoad at the start of main, every other package reads its settings from here
+var Current *Config
+
+/// Loads the configuration into Current, exits listing every invalid setting
+func MustLoad() {
+  cfg, err := Load()
+  if err != nil {
+    log.Fatalf("Invalid configuration:\n%v\n", err)
+  }
+  log.Println("Configuration:", cfg)
+  Current = cfg
+}
+
+/// Reads and validates every setting, all problems are returned joined in a single error
+func Load() (*Config, error) {
+  s := &source{known: map[string]bool{"CONFIG_FILE": true}}
+
+  dotEnv, err := readDotEnv(".env")
+  if err != nil {
+    s.errs = append(s.errs, err)
+  }
+  s.dotEnv = dotEnv
+
+  if path, ok := s.lookup("CONFIG_FILE"); ok && path != "" {
+    file, err := readFile(path)
+    if err != nil {
+      s.errs = append(s.errs, err)
+    }
+    s.file = file
+    s.filePath = path
+  }
+
+  cfg := &Config{}
+  cfg.Debug = s.bool("DEBUG", false)
+  cfg.Zerolog = s.bool("ZEROLOG", cfg.Debug)
+
+  cfg.ListenAddress = s.string("LISTEN_ADDRESS", "0.0.0.0:3000")
+  if _, _, err := net.SplitHostPort(cfg.ListenAddress); err != nil {
+    s.fail("LISTEN_ADDRESS", "expected host:port, %v", err)
+  }
+  cfg.IdleTimeout = s.duration("IDLE_TIMEOUT", 30*time.Second, false)
+  cfg.ReadTimeout = s.duration("READ_TIMEOUT", 0, false)
+  cfg.WriteTimeout = s.duration("WRITE_TIMEOUT", 0, false)
+  cfg.ShutdownDelay = s.duration("SHUTDOWN_DELAY", 0, false)
+  cfg.ShutdownTimeout = s.duration("SHUTDOWN_TIMEOUT", 10*time.Second, true)
+  cfg.MetricsListenAddress = s.string("METRICS_LISTEN_ADDRESS", "")
+  if cfg.MetricsListenAddress != "" {
+    if _, _, err := net.SplitHostPort(cfg.MetricsListenAddress); err != nil {
+      s.fail("METRICS_LISTEN_ADDRESS", "expected host:port, %v", err)
+    } else if cfg.MetricsListenAddress == cfg.ListenAddress {
+      s.fail("METRICS_LISTEN_ADDRESS", "has to differ from LISTEN_ADDRESS, metrics are not served with the public API")
+    }
+  }
+  cfg.CORSOrigins = s.list("CORS_ORIGINS", []string{"*"})
+  for _, origin := range cfg.CORSOrigins {
+    if origin == "*" {
+      if len(cfg.CORSOrigins) > 1 {
+        s.fail("CORS_ORIGINS", "* allows every origin and can not be combined with others")
+      }
+    } else if err := validateOrigin(origin); err != nil {
+      s.fail("CORS_ORIGINS", "invalid origin %q, %v", origin, err)
+    }
+  }
+
+  cfg.ProxyHeader = s.string("PROXY_HEADER", "")
+  cfg.TrustedProxies = s.list("TRUSTED_PROXIES", []string{})
+  for _, proxy := range cfg.TrustedProxies {
+    if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+      s.fail("TRUSTED_PROXIES", "invalid address %q, expected an IP address or a CIDR range", proxy)
+    }
+  }
+  // Fiber believes the header from every peer when no proxy is listed, anyone could then pick the address rate limits see
+  if cfg.ProxyHeader != "" && len(cfg.TrustedProxies) == 0 {
+    s.fail("PROXY_HEADER", "requires TRUSTED_PROXIES, the addresses of the proxies allowed to set it")
+  }
+  if cfg.ProxyHeader == "" && len(cfg.TrustedProxies) > 0 {
+    s.fail("TRUSTED_PROXIES", "has no effect without PROXY_HEADER")
+  }
+
+  cfg.DatabaseURL = s.secret("DB_URL")
+  if cfg.DatabaseURL == "" {
+    s.fail("DB_URL", "required")
+  } else if _, err := pgxpool.ParseConfig(cfg.DatabaseURL); err != nil {
+    s.fail("DB_URL", "invalid connection string, %v", err)
+  }
+  cfg.DBMaxConns = s.int32("DB_MAX_CONNS", 0)
+  cfg.DBMinConns = s.int32("DB_MIN_CONNS", 0)
+  if cfg.DBMaxConns > 0 && cfg.DBMinConns > cfg.DBMaxConns {
+    s.fail("DB_MIN_CONNS", "%d is more than DB_MAX_CONNS %d", cfg.DBMinConns, cfg.DBMaxConns)
+  }
+
+  cfg.AccessTokenTTL = s.duration("ACCESS_TOKEN_TTL", 15*time.Minute, true)
+  cfg.RefreshTokenTTL = s.duration("REFRESH_TOKEN_TTL", 7*24*time.Hour, true)
+  if cfg.RefreshTokenTTL > 0 && cfg.RefreshTokenTTL < cfg.AccessTokenTTL {
+    s.fail("REFRESH_TOKEN_TTL", "%s is shorter than ACCESS_TOKEN_TTL %s", cfg.RefreshTokenTTL, cfg.AccessTokenTTL)
+  }
+  cfg.MFAChallengeTTL = s.duration("MFA_CHALLENGE_TTL", 5*time.Minute, true)
+  cfg.MFARequiredForFaculty = s.bool("MFA_REQUIRED_FOR_FACULTY", false)
+  cfg.JWTSigningKeys = s.files("JWT_SIGNING_KEYS")
+  if len(cfg.JWTSigningKeys) == 0 && !cfg.Debug {
+    // An ephemeral key logs everyone out on restart and differs between replicas
+    s.fail("JWT_SIGNING_KEYS", "required unless DEBUG=true, set it to the PEM files of the token signing keys")
+  }
+  // Access tokens used to be signed with this HS256 secret, name the replacement instead of reporting an unknown setting
+  if _, ok := s.lookup("JWT_SECRET"); ok {
+    s.fail("JWT_SECRET", "shared secrets are no longer supported, remove it and set JWT_SIGNING_KEYS to PEM private keys instead")
+  }
+  cfg.LoginLimiterStore = s.oneOf("LOGIN_LIMITER_STORE", "postgres", "memory")
+
+  cfg.TranscriptSigningKeys = s.files("TRANSCRIPT_SIGNING_KEYS")
+  cfg.InstitutionName = s.string("INSTITUTION_NAME", "Student Information System")
+  cfg.PublicBaseURL = strings.TrimSuffix(s.string("PUBLIC_BASE_URL", ""), "/")
+  if cfg.PublicBaseURL != "" {
+    if u, err := url.Parse(cfg.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+      s.fail("PUBLIC_BASE_URL", "expected an absolute http or https URL")
+    }
+  }
+  cfg.GPARetakePolicy = s.oneOf("GPA_RETAKE_POLICY", "latest", "best", "average")
+
+  // A typo in a file would otherwise silently fall back to the default
+  s.checkUnknown(s.dotEnv, ".env")
+  s.checkUnknown(s.file, s.filePath)
+
+  cfg.summary = s.summary
+  return cfg, errors.Join(s.errs...)
+}
+
+/// All settings on one line, safe to log
+func (c *Config) String() string {
+  return strings.Join(c.summary, " ")
+}
+
+/// Values of .env, a missing file is the same as an empty one
+func readDotEnv(path string) (map[string]string, error) {
+  values := map[string]string{}
+  if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+    return values, nil
+  }
+
+  err := utils.Load(path, func(k, v string) error {
+    values[strings.ToUpper(strings.TrimSpace(k))] = strings.TrimSpace(v)
+    return nil
+  })
+  if err != nil {
+    // The loader quotes the offending value, which may well be a secret
+    return values, errors.New("unable to read .env, check the quoting of its values")
+  }
+  return values, nil
+}
+
+/// Origins are compared verbatim by the CORS middleware, so anything but scheme://host[:port] never matches
+func validateOrigin(origin string) error {
+  u, err := url.Parse(origin)
+  if err != nil {
+    return err
+  }
+  if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+    return errors.New("expected scheme://host[:port]")
+  }
+  if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+    return errors.New("an origin has no path, query or credentials")
+  }
+  return nil
+}
+
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(\\.|[^'])*'|\S+)`)
+
+/// Connection string with its password masked, for both the URL and the key=value form
+func redactDSN(dsn string) string {
+  if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+    query := u.Query()
+    if query.Has("password") {
+      query.Set("password", "xxxxx")
+      u.RawQuery = query.Encode()
+    }
+    return u.Redacted()
+  }
+  return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// Looks settings up in the environment, .env and the config file, and collects every problem
+type source struct {
+  dotEnv   map[string]string
+  file     map[string]string
+  filePath string
+  known    map[string]bool
+  summary  []string
+  errs     []error
+}
+
+func (s *source) lookup(key string) (string, bool) {
+  s.known[key] = true
+  if value, ok := os.LookupEnv(key); ok {
+    return value, true
+  }
+  if value, ok := s.dotEnv[key]; ok {
+    return value, true
+  }
+  value, ok := s.file[key]
+  return value, ok
+}
+
+func (s *source) checkUnknown(values map[string]string, name string) {
+  keys := []string{}
+  for key := range values {
+    if !s.known[key] {
+      keys = append(keys, key)
+    }
+  }
+  sort.Strings(keys)
+  for _, key := range keys {
+    s.errs = append(s.errs, fmt.Errorf("%s: unknown setting in %s", key, name))
+  }
+}
+
+func (s *source) fail(key string, format string, args ...any) {
+  s.errs = append(s.errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+}
+
+/// The raw value, or def when unset or empty
+func (s *source) raw(key string, def string) (string, bool) {
+  value, ok := s.lookup(key)
+  value = strings.TrimSpace(value)
+  if !ok || value == "" {
+    return def, false
+  }
+  return value, true
+}
+
+func (s *source) string(key string, def string) string {
+  value, _ := s.raw(key, def)
+  s.summary = append(s.summary, key+"="+strconv.Quote(value))
+  return value
+}
+
+func (s *source) secret(key string) string {
+  value, _ := s.raw(key, "")
+  s.summary = append(s.summary, key+"="+strconv.Quote(redactDSN(value)))
+  return value
+}
+
+func (s *source) bool(key string, def bool) bool {
+  value, ok := s.raw(key, "")
+  result := def
+  if ok {
+    parsed, err := strconv.ParseBool(value)
+    if err != nil {
+      s.fail(key, "invalid boolean %q, expected true or false", value)
+    }
+    result = parsed
+  }
+  s.summary = append(s.summary, key+"="+strconv.FormatBool(result))
+  return result
+}
+
+func (s *source) int32(key string, def int32) int32 {
+  value, ok := s.raw(key, "")
+  result := def
+  if ok {
+    parsed, err := strconv.ParseInt(value, 10, 32)
+    if err != nil || parsed < 0 {
+      s.fail(key, "invalid count %q, expected a non negative integer", value)
+    }
+    result = int32(parsed)
+  }
+  s.summary = append(s.summary, key+"="+strconv.Itoa(int(result)))
+  return result
+}
+
+/// A Go duration such as 90s or 15m, 0 disables a timeout unless positive is set
+func (s *source) duration(key string, def time.Duration, positive bool) time.Duration {
+  value, ok := s.raw(key, "")
+  result := def
+  if ok {
+    parsed, err := time.ParseDuration(value)
+    if err != nil || parsed < 0 {
+      s.fail(key, "invalid duration %q, expected a value like 90s or 15m", value)
+    } else if positive && parsed == 0 {
+      s.fail(key, "has to be longer than 0s")
+    }
+    result = parsed
+  }
+  s.summary = append(s.summary, key+"="+result.String())
+  return result
+}
+
+/// Comma separated values, empty entries are dropped
+func (s *source) list(key string, def []string) []string {
+  value, ok := s.raw(key, "")
+  result := def
+  if ok {
+    result = []string{}
+    for _, item := range strings.Split(value, ",") {
+      if item = strings.TrimSpace(item); item != "" {
+        result = append(result, item)
+      }
+    }
+  }
+  s.summary = append(s.summary, key+"="+strconv.Quote(strings.Join(result, ",")))
+  return result
+}
+
+/// A list of paths that have to be readable files
+func (s *source) files(key string) []string {
+  paths := s.list(key, []string{})
+  for _, path := range paths {
+    if info, err := os.Stat(path); err != nil {
+      s.fail(key, "%v", err)
+    } else if info.IsDir() {
+      s.fail(key, "%s is a directory", path)
+    }
+  }
+  return paths
+}
+
+/// One of the allowed values, the first is the default
+func (s *source) oneOf(key string, allowed ...string) string {
+  value, _ := s.raw(key, allowed[0])
+  s.summary = append(s.summary, key+"="+value)
+  for _, option := range allowed {
+    if value == option {
+      return value
+    }
+  }
+  s.fail(key, "invalid value %q, expected one of %s", value, strings.Join(allowed, ", "))
+  return allowed[0]
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+var settingNames = []string{
+  "CONFIG_FILE", "DEBUG", "ZEROLOG", "LISTEN_ADDRESS", "IDLE_TIMEOUT", "READ_TIMEOUT", "WRITE_TIMEOUT", "SHUTDOWN_DELAY",
+  "SHUTDOWN_TIMEOUT", "METRICS_LISTEN_ADDRESS", "CORS_ORIGINS", "PROXY_HEADER", "TRUSTED_PROXIES", "DB_URL", "DB_MAX_CONNS",
+  "DB_MIN_CONNS", "ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "MFA_CHALLENGE_TTL", "MFA_REQUIRED_FOR_FACULTY", "JWT_SIGNING_KEYS",
+  "JWT_SECRET", "LOGIN_LIMITER_STORE", "TRANSCRIPT_SIGNING_KEYS", "INSTITUTION_NAME", "PUBLIC_BASE_URL", "GPA_RETAKE_POLICY",
+}
+
+/// Runs the test in an empty directory with none of the settings in the environment, files maps names to contents
+func isolate(t *testing.T, files map[string]string) string {
+  t.Helper()
+  dir := t.TempDir()
+  t.Chdir(dir)
+  for _, name := range settingNames {
+    // Setenv restores the variable once the test is done, an empty value would still count as set
+    t.Setenv(name, "")
+    os.Unsetenv(name)
+  }
+  for name, contents := range files {
+    if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+      t.Fatal(err)
+    }
+  }
+  return dir
+}
+
+func TestLoadPrecedence(t *testing.T) {
+  const required = "DB_URL=postgres://localhost/sis\nDEBUG=true\n"
+  tests := []struct {
+    name   string
+    env    string
+    dotEnv string
+    file   string
+    want   string
+  }{
+    {"default", "", "", "", "Student Information System"},
+    {"file", "", "", "From File", "From File"},
+    {".env over file", "", "From .env", "From File", "From .env"},
+    {"environment over .env", "From Env", "From .env", "", "From Env"},
+    {"environment over everything", "From Env", "From .env", "From File", "From Env"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      files := map[string]string{".env": required, "config.toml": ""}
+      if test.dotEnv != "" {
+        files[".env"] += "INSTITUTION_NAME=" + test.dotEnv + "\n"
+      }
+      if test.file != "" {
+        files["config.toml"] = `institution_name = "` + test.file + `"`
+      }
+      isolate(t, files)
+      os.Setenv("CONFIG_FILE", "config.toml")
+      if test.env != "" {
+        os.Setenv("INSTITUTION_NAME", test.env)
+      }
+
+      cfg, err := Load()
+      if err != nil {
+        t.Fatal(err)
+      }
+      if cfg.InstitutionName != test.want {
+        t.Errorf("InstitutionName = %q, want %q", cfg.InstitutionName, test.want)
+      }
+    })
+  }
+}
+
+func TestLoadErrors(t *testing.T) {
+  tests := []struct {
+    name   string
+    env    map[string]string
+    dotEnv string
+    file   string
+    want   []string
+  }{
+    {
+      name: "defaults need a database and signing keys",
+      want: []string{"DB_URL: required", "JWT_SIGNING_KEYS: required unless DEBUG=true"},
+    },
+    {
+      name:   "unknown key in .env",
+      dotEnv: "DEBUG=true\nDB_URL=postgres://localhost/sis\nLISTEN_ADRESS=127.0.0.1:3000\n",
+      want:   []string{"LISTEN_ADRESS: unknown setting in .env"},
+    },
+    {
+      name: "unknown keys in the file",
+      env:  map[string]string{"DEBUG": "true", "DB_URL": "postgres://localhost/sis"},
+      file: "jwt_ttl = \"15m\"\ninstitution = \"Example\"\n",
+      want: []string{"INSTITUTION: unknown setting in config.toml", "JWT_TTL: unknown setting in config.toml"},
+    },
+    {
+      name: "JWT_SECRET in the environment",
+      env:  map[string]string{"DEBUG": "true", "DB_URL": "postgres://localhost/sis", "JWT_SECRET": "hunter2"},
+      want: []string{"JWT_SECRET: shared secrets are no longer supported"},
+    },
+    {
+      name:   "JWT_SECRET in .env",
+      dotEnv: "DEBUG=true\nDB_URL=postgres://localhost/sis\nJWT_SECRET=hunter2\n",
+      want:   []string{"JWT_SECRET: shared secrets are no longer supported"},
+    },
+    {
+      name: "invalid file",
+      env:  map[string]string{"DEBUG": "true", "DB_URL": "postgres://localhost/sis"},
+      file: "debug = true\nlisten_address = 3000 3000\n",
+      want: []string{"config.toml:2:"},
+    },
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      files := map[string]string{}
+      if test.dotEnv != "" {
+        files[".env"] = test.dotEnv
+      }
+      if test.file != "" {
+        files["config.toml"] = test.file
+      }
+      isolate(t, files)
+      for key, value := range test.env {
+        os.Setenv(key, value)
+      }
+      if test.file != "" {
+        os.Setenv("CONFIG_FILE", "config.toml")
+      }
+
+      _, err := Load()
+      if err == nil {
+        t.Fatal("expected an error")
+      }
+      for _, want := range test.want {
+        if !strings.Contains(err.Error(), want) {
+          t.Errorf("error %q does not mention %q", err, want)
+        }
+      }
+      if strings.Count(err.Error(), "\n")+1 != len(test.want) {
+        t.Errorf("error %q, expected only %d problems", err, len(test.want))
+      }
+    })
+  }
+}
+
+func TestLoadDoesNotReportKnownKeysAsUnknown(t *testing.T) {
+  isolate(t, map[string]string{
+    ".env":        "DEBUG=true\nDB_URL=postgres://localhost/sis\n",
+    "config.yaml": "listen_address: 127.0.0.1:4000\ncors_origins:\n  - https://a.example\n",
+  })
+  os.Setenv("CONFIG_FILE", "config.yaml")
+
+  cfg, err := Load()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if cfg.ListenAddress != "127.0.0.1:4000" || len(cfg.CORSOrigins) != 1 || cfg.CORSOrigins[0] != "https://a.example" {
+    t.Errorf("unexpected settings %s", cfg)
+  }
+}
+
+func TestLoadUnsupportedFileFormat(t *testing.T) {
+  isolate(t, map[string]string{"config.json": "{}"})
+  os.Setenv("DEBUG", "true")
+  os.Setenv("DB_URL", "postgres://localhost/sis")
+  os.Setenv("CONFIG_FILE", "config.json")
+
+  _, err := Load()
+  if err == nil || !strings.Contains(err.Error(), "CONFIG_FILE: unsupported format of config.json") {
+    t.Errorf("Load error = %v", err)
+  }
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/pelletier/go-toml/v2"
+  "gopkg.in/yaml.v3"
+)
+
+/// Top level settings of a YAML or TOML file, keys are upper cased and lists are joined with commas like in the environment
+func readFile(path string) (map[string]string, error) {
+  data, err := os.ReadFile(path)
+  if err != nil {
+    return nil, fmt.Errorf("CONFIG_FILE: %v", err)
+  }
+
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".yaml", ".yml":
+    return parseYAML(path, data)
+  case ".toml":
+    return parseTOML(path, data)
+  default:
+    return nil, fmt.Errorf("CONFIG_FILE: unsupported format of %s, expected .yaml, .yml or .toml", path)
+  }
+}
+
+func parseYAML(path string, data []byte) (map[string]string, error) {
+  document := map[string]any{}
+  if err := yaml.Unmarshal(data, &document); err != nil {
+    return nil, fmt.Errorf("%s: %v", path, err)
+  }
+  return settingValues(path, document)
+}
+
+func parseTOML(path string, data []byte) (map[string]string, error) {
+  document := map[string]any{}
+  if err := toml.Unmarshal(data, &document); err != nil {
+    var decodeErr *toml.DecodeError
+    if errors.As(err, &decodeErr) {
+      row, _ := decodeErr.Position()
+      return nil, fmt.Errorf("%s:%d: %v", path, row, err)
+    }
+    return nil, fmt.Errorf("%s: %v", path, err)
+  }
+  return settingValues(path, document)
+}
+
+/// Flattens a decoded document into settings, rejecting nested tables and keys that only differ in case
+func settingValues(path string, document map[string]any) (map[string]string, error) {
+  values := map[string]string{}
+  for key, value := range document {
+    name := strings.ToUpper(key)
+    if _, ok := values[name]; ok {
+      return nil, fmt.Errorf("%s: %s is set twice", path, name)
+    }
+
+    switch value := value.(type) {
+    case nil:
+      values[name] = ""
+    case []any:
+      items := []string{}
+      for _, item := range value {
+        switch item.(type) {
+        case []any, map[string]any:
+          return nil, fmt.Errorf("%s: %s can only list plain values", path, key)
+        }
+        items = append(items, fmt.Sprint(item))
+      }
+      values[name] = strings.Join(items, ",")
+    case map[string]any:
+      return nil, fmt.Errorf("%s: %s is nested, settings are top level keys", path, key)
+    default:
+      values[name] = fmt.Sprint(value)
+    }
+  }
+  return values, nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestParseTOML(t *testing.T) {
+  tests := []struct {
+    name string
+    data string
+    want map[string]string
+  }{
+    {"bare values", "debug = true\ndb_max_conns = 10", map[string]string{"DEBUG": "true", "DB_MAX_CONNS": "10"}},
+    {"basic string", `institution_name = "Example University"`, map[string]string{"INSTITUTION_NAME": "Example University"}},
+    {"escapes", `institution_name = "Say \"hi\"\tthere \u00e9"`, map[string]string{"INSTITUTION_NAME": "Say \"hi\"\tthere \u00e9"}},
+    {"literal string", `institution_name = 'C:\keys\#1'`, map[string]string{"INSTITUTION_NAME": `C:\keys\#1`}},
+    {"multi-line string", "institution_name = \"\"\"\\\n  Example University\"\"\"", map[string]string{"INSTITUTION_NAME": "Example University"}},
+    {"quoted key", `"listen_address" = "127.0.0.1:3000"`, map[string]string{"LISTEN_ADDRESS": "127.0.0.1:3000"}},
+    {"comments", "# a comment\n\n  # indented\nshutdown_delay = \"5s\" # trailing\n", map[string]string{"SHUTDOWN_DELAY": "5s"}},
+    {"hash inside a string", `institution_name = "No. #1" # comment`, map[string]string{"INSTITUTION_NAME": "No. #1"}},
+    {"array", `cors_origins = ["https://a.example", 'https://b.example'] # two`, map[string]string{"CORS_ORIGINS": "https://a.example,https://b.example"}},
+    {"multi-line array", "jwt_signing_keys = [\n  \"a.pem\", # current\n  \"b.pem\",\n]", map[string]string{"JWT_SIGNING_KEYS": "a.pem,b.pem"}},
+    {"empty array", "trusted_proxies = []", map[string]string{"TRUSTED_PROXIES": ""}},
+    {"crlf line endings", "debug = false\r\ndb_max_conns = 4\r\n", map[string]string{"DEBUG": "false", "DB_MAX_CONNS": "4"}},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      got, err := parseTOML("config.toml", []byte(test.data))
+      if err != nil {
+        t.Fatal(err)
+      }
+      if !reflect.DeepEqual(got, test.want) {
+        t.Errorf("parseTOML = %v, want %v", got, test.want)
+      }
+    })
+  }
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+  tests := []struct {
+    name string
+    data string
+    want string
+  }{
+    {"table", "debug = true\n[server]\nlisten_address = \"127.0.0.1:3000\"", "config.toml: server is nested"},
+    {"dotted key", `server.listen_address = "127.0.0.1:3000"`, "config.toml: server is nested"},
+    {"array of tables", "[[cors_origins]]\nhost = \"a.example\"", "cors_origins can only list plain values"},
+    {"nested array", `cors_origins = [["a"], ["b"]]`, "cors_origins can only list plain values"},
+    {"no equals sign", "debug = true\ndebug2", "config.toml:2:"},
+    {"unquoted string", "shutdown_delay = 5s", "config.toml:1:"},
+    {"unterminated string", "debug = true\ninstitution_name = \"Example", "config.toml:2:"},
+    {"duplicate key", "debug = true\ndebug = false", "key debug is already defined"},
+    {"keys differing in case", "debug = true\nDEBUG = false", "config.toml: DEBUG is set twice"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      _, err := parseTOML("config.toml", []byte(test.data))
+      if err == nil || !strings.Contains(err.Error(), test.want) {
+        t.Errorf("parseTOML error = %v, want %q", err, test.want)
+      }
+    })
+  }
+}
+
+func TestParseYAML(t *testing.T) {
+  got, err := parseYAML("config.yaml", []byte(strings.Join([]string{
+    "# a comment",
+    "debug: true",
+    "db_max_conns: 10",
+    "institution_name: 'Example: University' # trailing",
+    "cors_origins:",
+    "  - https://a.example",
+    "  - https://b.example",
+    "public_base_url:",
+  }, "\n")))
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := map[string]string{
+    "DEBUG":            "true",
+    "DB_MAX_CONNS":     "10",
+    "INSTITUTION_NAME": "Example: University",
+    "CORS_ORIGINS":     "https://a.example,https://b.example",
+    "PUBLIC_BASE_URL":  "",
+  }
+  if !reflect.DeepEqual(got, want) {
+    t.Errorf("parseYAML = %v, want %v", got, want)
+  }
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+  tests := []struct {
+    name string
+    data string
+    want string
+  }{
+    {"nested map", "server:\n  listen_address: 127.0.0.1:3000", "server is nested"},
+    {"nested list", "cors_origins:\n  - [a, b]", "cors_origins can only list plain values"},
+    {"invalid syntax", "debug: [true", "config.yaml:"},
+    {"keys differing in case", "debug: true\nDEBUG: false", "config.yaml: DEBUG is set twice"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      _, err := parseYAML("config.yaml", []byte(test.data))
+      if err == nil || !strings.Contains(err.Error(), test.want) {
+        t.Errorf("parseYAML error = %v, want %q", err, test.want)
+      }
+    })
+  }
+}
@@ -4,16 +4,27 @@ import (
   "log"
   "context"
 
-  "backend/common"
+  "backend/config"
 
   "github.com/jackc/pgx/v5/pgxpool"
 )
 
 var DB *pgxpool.Pool
 
-func connectDB() {
-  var err error
-  DB, err = pgxpool.New(context.Background(), common.MustGetEnv("DB_URL"))
+/// Connects the pool, exits when the database is unreachable. The migrate subcommand skips the version check as it
+/// has to connect to databases that are behind or ahead of this binary.
+func Connect(checkVersion bool) {
+  // Already validated when the configuration was loaded
+  poolConfig, err := pgxpool.ParseConfig(config.Current.DatabaseURL)
+  if err != nil {
+    log.Fatalf("Unable to parse DB_URL: %v\n", err)
+  }
+  if config.Current.DBMaxConns > 0 {
+    poolConfig.MaxConns = config.Current.DBMaxConns
+  }
+  poolConfig.MinConns = config.Current.DBMinConns
+
+  DB, err = pgxpool.NewWithConfig(context.Background(), poolConfig)
   if err != nil {
     log.Fatalf("Unable to connect to database: %v\n", err)
   }
@@ -22,6 +33,12 @@ func connectDB() {
     log.Fatalf("Database connection verification failed: %v\n", err)
   }
 
+  if checkVersion {
+    if err = CheckSchemaVersion(context.Background()); err != nil {
+      log.Fatalf("Database schema check failed: %v\n", err)
+    }
+  }
+
   log.Println("Database connected successfully using pgx!")
 }
 
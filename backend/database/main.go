@@ -1,6 +0,0 @@
-package database
-
-func init() {
-  connectDB()
-}
-
@@ -0,0 +1,31 @@
+package database
+
+import (
+  "backend/metrics"
+
+  "github.com/prometheus/client_golang/prometheus"
+)
+
+// Read from DB.Stat() on every scrape, the counters are cumulative since the pool was created
+func init() {
+  metrics.With.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgxpool_total_conns", Help: "Connections in the pool, idle, acquired or being constructed."},
+    func() float64 { return float64(DB.Stat().TotalConns()) })
+  metrics.With.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgxpool_idle_conns", Help: "Idle connections in the pool."},
+    func() float64 { return float64(DB.Stat().IdleConns()) })
+  metrics.With.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgxpool_acquired_conns", Help: "Connections currently acquired by requests."},
+    func() float64 { return float64(DB.Stat().AcquiredConns()) })
+  metrics.With.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgxpool_constructing_conns", Help: "Connections currently being established."},
+    func() float64 { return float64(DB.Stat().ConstructingConns()) })
+  metrics.With.NewGaugeFunc(prometheus.GaugeOpts{Name: "pgxpool_max_conns", Help: "Maximum size of the pool."},
+    func() float64 { return float64(DB.Stat().MaxConns()) })
+  metrics.With.NewCounterFunc(prometheus.CounterOpts{Name: "pgxpool_acquires_total", Help: "Successful connection acquires."},
+    func() float64 { return float64(DB.Stat().AcquireCount()) })
+  metrics.With.NewCounterFunc(prometheus.CounterOpts{Name: "pgxpool_empty_acquires_total", Help: "Acquires that had to wait for a connection because none was idle."},
+    func() float64 { return float64(DB.Stat().EmptyAcquireCount()) })
+  metrics.With.NewCounterFunc(prometheus.CounterOpts{Name: "pgxpool_canceled_acquires_total", Help: "Acquires canceled by their context while waiting."},
+    func() float64 { return float64(DB.Stat().CanceledAcquireCount()) })
+  metrics.With.NewCounterFunc(prometheus.CounterOpts{Name: "pgxpool_acquire_duration_seconds_total", Help: "Total time spent acquiring connections, including waits."},
+    func() float64 { return DB.Stat().AcquireDuration().Seconds() })
+  metrics.With.NewCounterFunc(prometheus.CounterOpts{Name: "pgxpool_new_conns_total", Help: "Connections opened since startup."},
+    func() float64 { return float64(DB.Stat().NewConnsCount()) })
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+  "context"
+  "embed"
+  "errors"
+  "fmt"
+  "io/fs"
+  "log"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//go:embed seed.sql
+var seedSQL string
+
+// Held while migrating, so replicas started together do not apply the same migration twice
+const migrationLockKey = 7263150021
+
+// A numbered schema change, loaded from migrations/NNNN_name.up.sql and the matching .down.sql
+type Migration struct {
+  Version int
+  Name    string
+  up      string
+  down    string
+}
+
+// A migration of this binary or of the database, AppliedAt is nil while pending. Known is false for migrations
+// only recorded in the database, applied by a newer binary.
+type MigrationState struct {
+  Version   int
+  Name      string
+  AppliedAt *time.Time
+  Known     bool
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []Migration {
+  entries, err := fs.ReadDir(migrationFiles, "migrations")
+  if err != nil {
+    log.Fatalf("Unable to read migrations: %v\n", err)
+  }
+
+  byVersion := map[int]*Migration{}
+  for _, entry := range entries {
+    base, ok := strings.CutSuffix(entry.Name(), ".sql")
+    if !ok {
+      continue
+    }
+    base, direction, _ := cutLast(base, ".")
+    number, name, _ := strings.Cut(base, "_")
+    version, err := strconv.Atoi(number)
+    if err != nil || version <= 0 || name == "" || (direction != "up" && direction != "down") {
+      log.Fatalf("Invalid migration file name %s, expected NNNN_name.up.sql or NNNN_name.down.sql\n", entry.Name())
+    }
+
+    data, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+    if err != nil {
+      log.Fatalf("Unable to read migration %s: %v\n", entry.Name(), err)
+    }
+
+    m, ok := byVersion[version]
+    if !ok {
+      m = &Migration{Version: version, Name: name}
+      byVersion[version] = m
+    } else if m.Name != name {
+      log.Fatalf("Migration %d is named both %s and %s\n", version, m.Name, name)
+    }
+    if direction == "up" {
+      m.up = string(data)
+    } else {
+      m.down = string(data)
+    }
+  }
+
+  list := []Migration{}
+  for _, m := range byVersion {
+    if m.up == "" || m.down == "" {
+      log.Fatalf("Migration %d %s needs both an up and a down file\n", m.Version, m.Name)
+    }
+    list = append(list, *m)
+  }
+  sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+  // Gaps usually mean a file was lost in a merge
+  for i, m := range list {
+    if m.Version != i+1 {
+      log.Fatalf("Migration %d is missing\n", i+1)
+    }
+  }
+
+  return list
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+  if i := strings.LastIndex(s, sep); i >= 0 {
+    return s[:i], s[i+len(sep):], true
+  }
+  return s, "", false
+}
+
+/// Schema version this binary was built for
+func ExpectedSchemaVersion() int {
+  return len(migrations)
+}
+
+/// Highest applied migration, 0 for a database that was never migrated
+func SchemaVersion(ctx context.Context) (int, error) {
+  var version int
+  err := DB.QueryRow(ctx, `SELECT CASE WHEN to_regclass('schema_migrations') IS NULL THEN 0 ELSE (SELECT COALESCE(MAX(version), 0) FROM schema_migrations) END`).Scan(&version)
+  return version, err
+}
+
+/// Fails unless exactly the migrations of this binary have been applied
+func CheckSchemaVersion(ctx context.Context) error {
+  version, err := SchemaVersion(ctx)
+  if err != nil {
+    return err
+  }
+  if expected := ExpectedSchemaVersion(); version != expected {
+    return fmt.Errorf("database schema is at version %d but this binary expects version %d, run `migrate up` or deploy a matching binary", version, expected)
+  }
+  return nil
+}
+
+/// Run fn on a single connection holding the migration lock
+func withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+  conn, err := DB.Acquire(ctx)
+  if err != nil {
+    return err
+  }
+  defer conn.Release()
+
+  if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+    return err
+  }
+  defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+  _, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+  )`)
+  if err != nil {
+    return err
+  }
+
+  return fn(conn)
+}
+
+/// Applies all pending migrations in order, each in its own transaction. Returns the applied migrations.
+func MigrateUp(ctx context.Context) ([]Migration, error) {
+  applied := []Migration{}
+  err := withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+    var current int
+    if err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+      return err
+    }
+    if current > ExpectedSchemaVersion() {
+      return fmt.Errorf("database schema is at version %d, newer than the %d migrations of this binary", current, ExpectedSchemaVersion())
+    }
+
+    for _, m := range migrations[current:] {
+      tx, err := conn.Begin(ctx)
+      if err != nil {
+        return err
+      }
+      if _, err := tx.Exec(ctx, m.up); err != nil {
+        tx.Rollback(ctx)
+        return fmt.Errorf("migration %d %s failed: %w", m.Version, m.Name, err)
+      }
+      if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name); err != nil {
+        tx.Rollback(ctx)
+        return err
+      }
+      if err := tx.Commit(ctx); err != nil {
+        return err
+      }
+      applied = append(applied, m)
+    }
+    return nil
+  })
+  return applied, err
+}
+
+/// Reverts the last steps migrations, newest first. Returns the reverted migrations.
+func MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+  reverted := []Migration{}
+  err := withMigrationLock(ctx, func(conn *pgxpool.Conn) error {
+    for range steps {
+      var current int
+      if err := conn.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+        return err
+      }
+      if current == 0 {
+        return nil
+      }
+      if current > ExpectedSchemaVersion() {
+        return fmt.Errorf("migration %d is not known to this binary, revert it with the binary that applied it", current)
+      }
+
+      m := migrations[current-1]
+      tx, err := conn.Begin(ctx)
+      if err != nil {
+        return err
+      }
+      if _, err := tx.Exec(ctx, m.down); err != nil {
+        tx.Rollback(ctx)
+        return fmt.Errorf("reverting migration %d %s failed: %w", m.Version, m.Name, err)
+      }
+      if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version); err != nil {
+        tx.Rollback(ctx)
+        return err
+      }
+      if err := tx.Commit(ctx); err != nil {
+        return err
+      }
+      reverted = append(reverted, m)
+    }
+    return nil
+  })
+  return reverted, err
+}
+
+/// Every migration of this binary and of the database, ordered by version
+func MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+  states := map[int]*MigrationState{}
+  for _, m := range migrations {
+    states[m.Version] = &MigrationState{Version: m.Version, Name: m.Name, Known: true}
+  }
+
+  version, err := SchemaVersion(ctx)
+  if err != nil {
+    return nil, err
+  }
+  if version > 0 {
+    rows, err := DB.Query(ctx, `SELECT version, name, applied_at FROM schema_migrations`)
+    if err != nil {
+      return nil, err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+      var version int
+      var name string
+      var appliedAt time.Time
+      if err := rows.Scan(&version, &name, &appliedAt); err != nil {
+        return nil, err
+      }
+      state, ok := states[version]
+      if !ok {
+        state = &MigrationState{Version: version, Name: name}
+        states[version] = state
+      }
+      state.AppliedAt = &appliedAt
+    }
+    if err := rows.Err(); err != nil {
+      return nil, err
+    }
+  }
+
+  list := []MigrationState{}
+  for _, state := range states {
+    list = append(list, *state)
+  }
+  sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+  return list, nil
+}
+
+/// Loads the demo data of seed.sql, only into an empty database at the expected schema version
+func Seed(ctx context.Context) error {
+  if err := CheckSchemaVersion(ctx); err != nil {
+    return err
+  }
+
+  var hasData bool
+  if err := DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM students) OR EXISTS (SELECT 1 FROM faculty)`).Scan(&hasData); err != nil {
+    return err
+  }
+  if hasData {
+    return errors.New("database already has students or faculty, seed data is only loaded into an empty database")
+  }
+
+  tx, err := DB.Begin(ctx)
+  if err != nil {
+    return err
+  }
+  defer tx.Rollback(ctx)
+
+  if _, err := tx.Exec(ctx, seedSQL); err != nil {
+    return err
+  }
+  return tx.Commit(ctx)
+}
@@ -0,0 +1,30 @@
+-- Removes everything 0001_initial_schema created, including all data.
+
+DROP FUNCTION IF EXISTS calculate_student_gpa;
+DROP FUNCTION IF EXISTS get_student_transcript;
+DROP PROCEDURE IF EXISTS delete_grade;
+DROP PROCEDURE IF EXISTS update_grade;
+DROP FUNCTION IF EXISTS get_grade_by_id;
+DROP FUNCTION IF EXISTS get_all_grades;
+DROP FUNCTION IF EXISTS add_grade;
+DROP PROCEDURE IF EXISTS delete_enrollment;
+DROP FUNCTION IF EXISTS get_enrollment_by_id;
+DROP FUNCTION IF EXISTS get_enrollments;
+DROP FUNCTION IF EXISTS create_enrollment;
+DROP PROCEDURE IF EXISTS delete_course;
+DROP PROCEDURE IF EXISTS update_course;
+DROP FUNCTION IF EXISTS get_course_by_id;
+DROP FUNCTION IF EXISTS get_all_courses;
+DROP FUNCTION IF EXISTS create_course;
+DROP PROCEDURE IF EXISTS delete_student;
+DROP PROCEDURE IF EXISTS update_student;
+DROP FUNCTION IF EXISTS get_student_by_id;
+DROP FUNCTION IF EXISTS get_students;
+DROP FUNCTION IF EXISTS create_student;
+DROP FUNCTION IF EXISTS authenticate_user;
+
+DROP TABLE IF EXISTS grades CASCADE;
+DROP TABLE IF EXISTS enrollments CASCADE;
+DROP TABLE IF EXISTS courses CASCADE;
+DROP TABLE IF EXISTS faculty CASCADE;
+DROP TABLE IF EXISTS students CASCADE;
@@ -1,16 +1,5 @@
--- Drop existing tables and sequences (order matters due to foreign keys)
-DROP TABLE IF EXISTS grades CASCADE;
-DROP TABLE IF EXISTS enrollments CASCADE;
-DROP TABLE IF EXISTS courses CASCADE;
-DROP TABLE IF EXISTS faculty CASCADE;
-DROP TABLE IF EXISTS students CASCADE;
-
--- Drop existing sequences if they exist (for clean recreation)
-DROP SEQUENCE IF EXISTS students_id_seq CASCADE;
-DROP SEQUENCE IF EXISTS faculty_id_seq CASCADE;
-DROP SEQUENCE IF EXISTS courses_id_seq CASCADE;
-DROP SEQUENCE IF EXISTS enrollments_id_seq CASCADE;
-DROP SEQUENCE IF EXISTS grades_id_seq CASCADE;
+-- Baseline schema, the former scema.sql without its DROP statements and seed data. Databases created with
+-- scema.sql match it, see the README on adopting them.
 
 -- Create tables
 CREATE TABLE students (
@@ -54,45 +43,6 @@ CREATE TABLE grades (
   UNIQUE (enrollment_id, semester)
 );
 
--- Seed data (WARNING: Passwords should be hashed in a real application)
-INSERT INTO students (name, password, date_of_birth, address, contact, program) VALUES
-('Alice Smith', '', '2002-05-15', '123 Main St, Anytown', '555-1234', 'Computer Science'),
-('Bob Johnson', '', '2003-11-20', '456 Oak Ave, Somewhere', '555-5678', 'Electrical Engineering'),
-('Charlie Brown', '', '2001-07-01', '789 Pine Ln, Nowhere', '555-9012', 'Physics'),
-('Diana Prince', '', '2004-03-10', '101 Hero Way, Themyscira', '555-3456', 'History'),
-('Ethan Hunt', '', '2003-09-25', '246 Spy Blvd, IMF HQ', '555-7890', 'International Relations');
-
-INSERT INTO faculty (name, password, date_of_birth, info) VALUES
-('prof_davis', '', '1975-08-22', 'Dr. Emily Davis, Head of Computer Science'),
-('dr_wilson', '', '1968-04-11', 'Dr. John Wilson, Professor of Electrical Engineering'),
-('prof_jones', '', '1980-12-03', 'Dr. Sarah Jones, Professor of History');
-
-INSERT INTO courses (code, title, credits) VALUES
-('CS101', 'Introduction to Programming', 3.00),
-('EE201', 'Circuit Analysis', 4.00),
-('PHY101', 'General Physics I', 4.00),
-('HIS201', 'World History II', 3.00),
-('IR301', 'Global Politics', 3.00);
-
-INSERT INTO enrollments (student_id, course_id, enrollment_date) VALUES
-(1, 1, '2023-09-01'),
-(1, 3, '2023-09-01'),
-(2, 2, '2023-09-01'),
-(3, 3, '2023-09-01'),
-(4, 4, '2023-09-01'),
-(5, 5, '2023-09-01'),
-(1, 4, '2024-01-15'),
-(2, 1, '2024-01-15');
-
-INSERT INTO grades (enrollment_id, grade, semester) VALUES
-(1, 3.80, 20231),
-(2, 3.50, 20231),
-(3, 4.00, 20231),
-(4, 3.20, 20231),
-(5, 3.90, 20231),
-(6, 3.70, 20231),
-(7, 3.00, 20242);
-
 CREATE OR REPLACE FUNCTION authenticate_user(
   p_id INT,
   p_password VARCHAR,
@@ -799,4 +749,3 @@ EXCEPTION
     RAISE EXCEPTION 'Failed to calculate GPA: %', SQLERRM;
 END;
 $$;
-
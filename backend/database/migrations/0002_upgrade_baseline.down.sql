@@ -0,0 +1,859 @@
+-- Restores the baseline schema of 0001_initial_schema and drops everything 0002_upgrade_baseline added, including
+-- sessions, roles, terms, sections and grading scales with their data. Passwords stay hashed, the baseline
+-- authenticate_user compares them in plaintext so nobody can log in until they are reset. Fails while a student is
+-- enrolled into a course in several terms or a grade has 10 points or more, the baseline schema can hold neither.
+
+DROP FUNCTION get_transcript_document;
+DROP PROCEDURE create_transcript_document;
+DROP FUNCTION get_student_gpa_breakdown;
+DROP FUNCTION calculate_student_gpa;
+DROP FUNCTION student_effective_grades;
+DROP FUNCTION get_student_transcript;
+DROP PROCEDURE delete_grade;
+DROP PROCEDURE update_grade;
+DROP FUNCTION get_grade_by_id;
+DROP FUNCTION get_grades_page;
+DROP FUNCTION get_all_grades;
+DROP FUNCTION add_grade;
+DROP PROCEDURE delete_grading_scale;
+DROP PROCEDURE update_grading_scale;
+DROP FUNCTION create_grading_scale;
+DROP PROCEDURE store_grading_scale;
+DROP FUNCTION get_grading_scales;
+DROP FUNCTION resolve_grade;
+DROP FUNCTION points_to_mark;
+DROP FUNCTION student_grading_scale;
+DROP FUNCTION enrollment_grading_scale;
+DROP PROCEDURE delete_waitlist_entry;
+DROP FUNCTION get_student_waitlist;
+DROP FUNCTION get_section_waitlist;
+DROP PROCEDURE delete_enrollment;
+DROP FUNCTION get_enrollment_by_id;
+DROP FUNCTION get_enrollments_page;
+DROP FUNCTION get_enrollments;
+DROP FUNCTION create_enrollment;
+DROP PROCEDURE fill_section_from_waitlist;
+DROP FUNCTION waitlist_position;
+DROP PROCEDURE delete_course_section;
+DROP PROCEDURE update_course_section;
+DROP FUNCTION create_course_section;
+DROP PROCEDURE validate_course_section;
+DROP FUNCTION get_course_sections;
+DROP PROCEDURE require_grading_open;
+DROP PROCEDURE require_enrollment_open;
+DROP PROCEDURE delete_term;
+DROP PROCEDURE update_term;
+DROP PROCEDURE create_term;
+DROP PROCEDURE validate_term;
+DROP FUNCTION get_terms;
+DROP FUNCTION get_existing_enrollments;
+DROP FUNCTION get_existing_term_ids;
+DROP FUNCTION get_existing_course_ids;
+DROP FUNCTION get_existing_student_ids;
+DROP FUNCTION get_existing_course_codes;
+DROP FUNCTION get_prerequisite_overrides;
+DROP FUNCTION get_unmet_prerequisites;
+DROP PROCEDURE set_course_prerequisites;
+DROP FUNCTION get_course_prerequisites;
+DROP PROCEDURE require_course_instructor;
+DROP PROCEDURE unassign_course_instructor;
+DROP PROCEDURE assign_course_instructor;
+DROP FUNCTION get_course_instructors;
+DROP PROCEDURE delete_course;
+DROP PROCEDURE update_course;
+DROP FUNCTION search;
+DROP FUNCTION get_course_by_id;
+DROP FUNCTION get_all_courses;
+DROP FUNCTION create_course;
+DROP PROCEDURE deactivate_faculty;
+DROP PROCEDURE update_faculty;
+DROP FUNCTION get_faculty_profile;
+DROP FUNCTION get_faculty_by_id;
+DROP FUNCTION get_faculty;
+DROP FUNCTION create_faculty;
+DROP PROCEDURE delete_student;
+DROP PROCEDURE update_student;
+DROP FUNCTION get_student_by_id;
+DROP FUNCTION get_students_page;
+DROP FUNCTION get_students;
+DROP FUNCTION create_student;
+DROP FUNCTION get_roles;
+DROP PROCEDURE set_user_roles;
+DROP PROCEDURE require_permission;
+DROP FUNCTION has_permission;
+DROP FUNCTION get_user_permissions;
+DROP FUNCTION get_user_roles;
+DROP PROCEDURE delete_mfa_factor;
+DROP PROCEDURE use_recovery_code;
+DROP PROCEDURE use_mfa_step;
+DROP PROCEDURE enable_mfa_factor;
+DROP PROCEDURE set_mfa_factor;
+DROP FUNCTION get_mfa_factor;
+DROP PROCEDURE reset_login_key;
+DROP FUNCTION get_login_locked_until;
+DROP PROCEDURE lock_login_key;
+DROP FUNCTION record_login_failure;
+DROP FUNCTION get_revoked_sessions;
+DROP FUNCTION revoke_user_sessions;
+DROP PROCEDURE revoke_session;
+DROP PROCEDURE rotate_session;
+DROP FUNCTION get_active_session;
+DROP PROCEDURE create_session;
+DROP PROCEDURE set_user_password;
+DROP FUNCTION get_user_credentials;
+
+DROP TABLE transcript_documents;
+DROP TABLE mfa_recovery_codes;
+DROP TABLE mfa_factors;
+DROP TABLE login_attempts;
+DROP TABLE sessions;
+DROP TABLE prerequisite_overrides;
+DROP TABLE section_waitlist;
+
+ALTER TABLE grades
+  DROP CONSTRAINT grades_semester_fkey,
+  DROP COLUMN mark,
+  DROP COLUMN mark_kind,
+  ALTER COLUMN grade TYPE DECIMAL(3, 2);
+
+ALTER TABLE enrollments
+  DROP COLUMN section_id,
+  DROP COLUMN term_id,
+  ADD UNIQUE (student_id, course_id);
+
+DROP TABLE course_sections;
+DROP TABLE course_prerequisites;
+DROP TABLE course_instructors;
+
+DROP INDEX courses_code_trgm_idx;
+DROP INDEX courses_title_trgm_idx;
+ALTER TABLE courses
+  DROP COLUMN search_vector,
+  DROP COLUMN grading_scale_id;
+
+DROP TABLE terms;
+DROP TABLE program_grading_scales;
+DROP TABLE grading_scale_marks;
+DROP TABLE grading_scales;
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
+
+ALTER TABLE faculty
+  DROP COLUMN active,
+  DROP COLUMN must_change_password;
+
+DROP INDEX students_name_trgm_idx;
+DROP INDEX students_contact_trgm_idx;
+DROP INDEX students_program_trgm_idx;
+ALTER TABLE students
+  DROP COLUMN search_vector,
+  DROP COLUMN must_change_password;
+
+CREATE OR REPLACE FUNCTION authenticate_user(
+  p_id INT,
+  p_password VARCHAR,
+  p_role VARCHAR
+)
+RETURNS TABLE (
+  user_id INT,
+  user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_stored_password VARCHAR;
+  v_date_of_birth DATE;
+  v_dob_password VARCHAR;
+BEGIN
+  IF p_role = 'student' THEN
+    SELECT password, date_of_birth INTO v_stored_password, v_date_of_birth FROM students WHERE id = p_id;
+  ELSIF p_role = 'faculty' THEN
+    SELECT password, date_of_birth INTO v_stored_password, v_date_of_birth FROM faculty WHERE id = p_id;
+  ELSE
+    RAISE EXCEPTION 'Invalid role specified';
+  END IF;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid credentials';
+  END IF;
+
+  IF v_stored_password = '' THEN
+    IF v_date_of_birth IS NULL THEN
+       RAISE EXCEPTION 'Invalid credentials';
+    END IF;
+    v_dob_password := to_char(v_date_of_birth, 'YYYY-MM-DD');
+    IF p_password != v_dob_password THEN
+      RAISE EXCEPTION 'Invalid credentials';
+    END IF;
+  ELSE
+    IF p_password != v_stored_password THEN
+      RAISE EXCEPTION 'Invalid credentials';
+    END IF;
+  END IF;
+
+  RETURN QUERY SELECT p_id, p_role;
+
+EXCEPTION
+  WHEN NO_DATA_FOUND THEN
+    RAISE EXCEPTION 'Invalid credentials';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Authentication failed: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_student(
+  p_name VARCHAR,
+  p_password VARCHAR,
+  p_date_of_birth DATE,
+  p_address TEXT,
+  p_contact VARCHAR,
+  p_program VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_id INT;
+BEGIN
+  IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Student name is required';
+  END IF;
+  IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Student date of birth is required';
+  END IF;
+
+  INSERT INTO students (name, password, date_of_birth, address, contact, program)
+  VALUES (p_name, p_password, p_date_of_birth, p_address, p_contact, p_program)
+  RETURNING id INTO v_student_id;
+
+  RETURN v_student_id;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to create student: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_students(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF students
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role = 'student' THEN
+    RETURN QUERY SELECT * FROM students WHERE id = p_user_id;
+  ELSIF p_user_role = 'faculty' THEN
+    RETURN QUERY SELECT * FROM students;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_student_by_id(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF students
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role = 'student' AND p_student_id != p_user_id THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own details.';
+  END IF;
+
+  RETURN QUERY SELECT * FROM students WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_student(
+  p_student_id INT,
+  p_name VARCHAR,
+  p_date_of_birth DATE,
+  p_address TEXT,
+  p_contact VARCHAR,
+  p_program VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can update student details.';
+  END IF;
+
+   IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Student name is required';
+  END IF;
+   IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Student date of birth is required';
+  END IF;
+
+  UPDATE students
+  SET name = p_name,
+    date_of_birth = p_date_of_birth,
+    address = p_address,
+    contact = p_contact,
+    program = p_program
+  WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update student: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_student(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can delete students.';
+  END IF;
+
+  DELETE FROM students WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete student: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_course(
+  p_code VARCHAR,
+  p_title VARCHAR,
+  p_credits DECIMAL(3, 2),
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_course_id INT;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can create courses.';
+  END IF;
+
+  IF p_code IS NULL OR p_code = '' THEN
+    RAISE EXCEPTION 'Course code is required';
+  END IF;
+  IF p_title IS NULL OR p_title = '' THEN
+    RAISE EXCEPTION 'Course title is required';
+  END IF;
+  IF p_credits IS NULL OR p_credits <= 0 THEN
+    RAISE EXCEPTION 'Positive credits are required';
+  END IF;
+
+  INSERT INTO courses (code, title, credits)
+  VALUES (p_code, p_title, p_credits)
+  RETURNING id INTO v_course_id;
+
+  RETURN v_course_id;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Course with code % already exists', p_code;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to create course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_all_courses()
+RETURNS SETOF courses
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM courses;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_course_by_id(
+  p_course_id INT
+)
+RETURNS SETOF courses
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM courses WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_course(
+  p_course_id INT,
+  p_code VARCHAR,
+  p_title VARCHAR,
+  p_credits DECIMAL(3, 2),
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can update courses.';
+  END IF;
+
+  IF p_code IS NULL OR p_code = '' THEN
+    RAISE EXCEPTION 'Course code is required';
+  END IF;
+  IF p_title IS NULL OR p_title = '' THEN
+    RAISE EXCEPTION 'Course title is required';
+  END IF;
+  IF p_credits IS NULL OR p_credits <= 0 THEN
+    RAISE EXCEPTION 'Positive credits are required';
+  END IF;
+
+  UPDATE courses
+  SET code = p_code,
+    title = p_title,
+    credits = p_credits
+  WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Course with code % already exists', p_code;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_course(
+  p_course_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can delete courses.';
+  END IF;
+
+  DELETE FROM courses WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_enrollment(
+  p_student_id INT,
+  p_course_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  v_id INT,
+  v_date DATE
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_enrollment_id INT;
+  v_enrollment_date DATE;
+  v_student_exists BOOLEAN;
+  v_course_exists BOOLEAN;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can create enrollments.';
+  END IF;
+
+  IF p_student_id IS NULL OR p_student_id = 0 OR p_course_id IS NULL OR p_course_id = 0 THEN
+    RAISE EXCEPTION 'Student ID and Course ID are required';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  SELECT EXISTS(SELECT 1 FROM courses WHERE id = p_course_id) INTO v_course_exists;
+
+  IF NOT v_student_exists OR NOT v_course_exists THEN
+    RAISE EXCEPTION 'Invalid student ID or course ID';
+  END IF;
+
+  INSERT INTO enrollments (student_id, course_id)
+  VALUES (p_student_id, p_course_id)
+  RETURNING id, enrollment_date INTO v_enrollment_id, v_enrollment_date;
+
+  RETURN QUERY SELECT v_enrollment_id, v_enrollment_date;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Student is already enrolled in this course';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to create enrollment: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_enrollments(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_filter_student_id INT DEFAULT NULL
+)
+RETURNS SETOF enrollments
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role = 'student' THEN
+    RETURN QUERY SELECT * FROM enrollments WHERE student_id = p_user_id;
+  ELSIF p_user_role = 'faculty' THEN
+    IF p_filter_student_id IS NOT NULL THEN
+      RETURN QUERY SELECT * FROM enrollments WHERE student_id = p_filter_student_id;
+    ELSE
+      RETURN QUERY SELECT * FROM enrollments;
+    END IF;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_enrollment_by_id(
+  p_enrollment_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF enrollments
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_id INT;
+  v_enrollment enrollments;
+BEGIN
+  SELECT * INTO v_enrollment FROM enrollments WHERE id = p_enrollment_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Enrollment not found';
+  END IF;
+
+  IF p_user_role = 'student' AND v_enrollment.student_id != p_user_id THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own enrollments.';
+  END IF;
+
+  RETURN NEXT v_enrollment;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_enrollment(
+  p_enrollment_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_id INT;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can delete enrollments.';
+  END IF;
+
+  DELETE FROM enrollments WHERE id = p_enrollment_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Enrollment not found';
+  END IF;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete enrollment: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION add_grade(
+  p_enrollment_id INT,
+  p_grade DECIMAL(3, 2),
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_grade_id INT;
+  v_enrollment_student_id INT;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can add grades.';
+  END IF;
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 OR p_semester IS NULL OR p_semester = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID and Semester are required';
+  END IF;
+
+  SELECT student_id INTO v_enrollment_student_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  INSERT INTO grades (enrollment_id, grade, semester)
+  VALUES (p_enrollment_id, p_grade, p_semester)
+  RETURNING id INTO v_grade_id;
+
+  RETURN v_grade_id;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to add grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_all_grades(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF grades
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role = 'student' THEN
+    RETURN QUERY
+    SELECT g.*
+    FROM grades g
+    JOIN enrollments e ON g.enrollment_id = e.id
+    WHERE e.student_id = p_user_id;
+  ELSIF p_user_role = 'faculty' THEN
+    RETURN QUERY SELECT * FROM grades;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+-- Corrected function definition (removed duplicate OR)
+CREATE OR REPLACE FUNCTION get_grade_by_id(
+  p_grade_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF grades
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_grade grades;
+  v_enrollment_student_id INT;
+BEGIN
+  SELECT * INTO v_grade FROM grades WHERE id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+  IF p_user_role = 'student' THEN
+    SELECT student_id INTO v_enrollment_student_id FROM enrollments WHERE id = v_grade.enrollment_id;
+    IF NOT FOUND THEN
+     RAISE EXCEPTION 'Internal error: Enrollment not found for grade.';
+    END IF;
+    IF v_enrollment_student_id != p_user_id THEN
+     RAISE EXCEPTION 'Access denied. Students can only view grades for their own enrollments.';
+    END IF;
+  END IF;
+
+  RETURN NEXT v_grade;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_grade(
+  p_grade_id INT,
+  p_enrollment_id INT,
+  p_grade DECIMAL(3, 2),
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+   v_enrollment_student_id INT;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can update grades.';
+  END IF;
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 OR p_semester IS NULL OR p_semester = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID and Semester are required';
+  END IF;
+
+  SELECT student_id INTO v_enrollment_student_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  UPDATE grades
+  SET enrollment_id = p_enrollment_id,
+    grade = p_grade,
+    semester = p_semester
+  WHERE id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_grade(
+  p_grade_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_enrollment_student_id INT;
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Only faculty can delete grades.';
+  END IF;
+
+  DELETE FROM grades WHERE id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_student_transcript(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  enrollment_id INT,
+  course_code VARCHAR,
+  course_title VARCHAR,
+  credits DECIMAL(3, 2),
+  grade_id INT,
+  grade DECIMAL(3, 2),
+  semester INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_exists BOOLEAN;
+BEGIN
+  IF p_user_role = 'student' AND p_student_id != p_user_id THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own transcript.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT
+    e.id AS enrollment_id,
+    c.code,
+    c.title,
+    c.credits,
+    g.id AS grade_id,
+    g.grade,
+    g.semester
+  FROM
+    enrollments e
+  JOIN
+    courses c ON e.course_id = c.id
+  LEFT JOIN
+    grades g ON e.id = g.enrollment_id
+  WHERE
+    e.student_id = p_student_id
+  ORDER BY
+    g.semester NULLS LAST, c.code;
+
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION calculate_student_gpa(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS DECIMAL(3, 2)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_gpa DECIMAL(3, 2);
+  v_student_exists BOOLEAN;
+BEGIN
+  IF p_user_role = 'student' AND p_student_id != p_user_id THEN
+    RAISE EXCEPTION 'Access denied. Students can only calculate their own GPA.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+
+  SELECT
+    SUM(g.grade * c.credits) / NULLIF(SUM(c.credits), 0)
+  INTO v_gpa
+  FROM
+    enrollments e
+  JOIN
+    courses c ON e.course_id = c.id
+  JOIN
+    grades g ON e.id = g.enrollment_id
+  WHERE
+    e.student_id = p_student_id AND g.grade IS NOT NULL;
+
+  IF v_gpa IS NULL THEN
+    RETURN 0.0;
+  END IF;
+
+  RETURN v_gpa;
+
+EXCEPTION
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to calculate GPA: %', SQLERRM;
+END;
+$$;
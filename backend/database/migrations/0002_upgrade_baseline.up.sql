@@ -0,0 +1,3410 @@
+-- Upgrades the baseline schema to accounts with hashed passwords, sessions and second factors, role based permissions,
+-- grading scales, academic terms, course sections and prerequisites, search and signed transcripts. A database
+-- created with scema.sql keeps its data:
+-- * plaintext passwords are hashed, empty ones become the hashed date of birth that must be changed on first login
+-- * every faculty member is an admin, as every faculty member could change all records before
+-- * every semester of a grade becomes a term, enrollments without grades are put into a term after the last graded
+--   one. The dates of these terms are estimated from the enrollment dates and should be corrected.
+-- * grades keep their points and get the matching mark of the default grading scale
+-- Roles, permissions and the grading scales are reference data the application needs, they are part of the schema.
+
+-- Trigram similarity for typo tolerant search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+-- bcrypt for hashing the stored passwords
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+-- Every routine is defined again below, most with new signatures or result columns
+DROP FUNCTION calculate_student_gpa;
+DROP FUNCTION get_student_transcript;
+DROP PROCEDURE delete_grade;
+DROP PROCEDURE update_grade;
+DROP FUNCTION get_grade_by_id;
+DROP FUNCTION get_all_grades;
+DROP FUNCTION add_grade;
+DROP PROCEDURE delete_enrollment;
+DROP FUNCTION get_enrollment_by_id;
+DROP FUNCTION get_enrollments;
+DROP FUNCTION create_enrollment;
+DROP PROCEDURE delete_course;
+DROP PROCEDURE update_course;
+DROP FUNCTION get_course_by_id;
+DROP FUNCTION get_all_courses;
+DROP FUNCTION create_course;
+DROP PROCEDURE delete_student;
+DROP PROCEDURE update_student;
+DROP FUNCTION get_student_by_id;
+DROP FUNCTION get_students;
+DROP FUNCTION create_student;
+DROP FUNCTION authenticate_user;
+
+ALTER TABLE students
+  ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || contact || ' ' || program)) STORED;
+
+CREATE INDEX students_search_idx ON students USING GIN (search_vector);
+CREATE INDEX students_name_trgm_idx ON students USING GIN (name gin_trgm_ops);
+CREATE INDEX students_contact_trgm_idx ON students USING GIN (contact gin_trgm_ops);
+CREATE INDEX students_program_trgm_idx ON students USING GIN (program gin_trgm_ops);
+
+ALTER TABLE faculty
+  ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Roles group permissions, permissions are what stored procedures and the backend check
+CREATE TABLE roles (
+  name VARCHAR(50) PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions (
+  name VARCHAR(50) PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+  role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  permission VARCHAR(50) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+-- Role assignments, user_id refers to students or faculty depending on user_role.
+-- Students implicitly hold the student role.
+CREATE TABLE user_roles (
+  user_id INT NOT NULL,
+  user_role VARCHAR(50) NOT NULL,
+  role VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  PRIMARY KEY (user_id, user_role, role)
+);
+
+-- Grading scales map marks to grade points. A course uses its own scale, else the scale of the student's program, else the default scale.
+CREATE TABLE grading_scales (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(100) UNIQUE NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE UNIQUE INDEX grading_scales_default_idx ON grading_scales (is_default) WHERE is_default;
+
+-- Only 'graded' marks carry points and count towards the GPA, they earn credit with points above 0.
+-- 'pass' earns credit, 'fail' is attempted without credit, 'incomplete' and 'withdrawn' are neither.
+CREATE TABLE grading_scale_marks (
+  scale_id INT NOT NULL REFERENCES grading_scales(id) ON DELETE CASCADE,
+  mark VARCHAR(10) NOT NULL,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  points DECIMAL(4, 2),
+  kind VARCHAR(20) NOT NULL CHECK (kind IN ('graded', 'pass', 'fail', 'incomplete', 'withdrawn')),
+  PRIMARY KEY (scale_id, mark),
+  CHECK ((kind = 'graded') = (points IS NOT NULL))
+);
+
+-- students.program is free text, a program is assigned a scale by name
+CREATE TABLE program_grading_scales (
+  program VARCHAR(255) PRIMARY KEY,
+  scale_id INT NOT NULL REFERENCES grading_scales(id) ON DELETE CASCADE
+);
+
+-- Academic terms, identified by a code that sorts chronologically (e.g. 20231) since grades.semester refers to it and
+-- retakes and cumulative GPAs are ordered by it. Students enroll from enrollment_opens to enrollment_closes, grades are
+-- accepted from start_date to grades_due, all dates inclusive.
+CREATE TABLE terms (
+  id INT PRIMARY KEY CHECK (id > 0),
+  name VARCHAR(100) UNIQUE NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE NOT NULL,
+  enrollment_opens DATE NOT NULL,
+  enrollment_closes DATE NOT NULL,
+  grades_due DATE NOT NULL,
+  CHECK (start_date <= end_date),
+  CHECK (enrollment_opens <= enrollment_closes),
+  CHECK (grades_due >= start_date)
+);
+
+ALTER TABLE courses
+  ADD COLUMN grading_scale_id INT REFERENCES grading_scales(id) ON DELETE SET NULL,
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', code || ' ' || title)) STORED;
+
+CREATE INDEX courses_search_idx ON courses USING GIN (search_vector);
+CREATE INDEX courses_code_trgm_idx ON courses USING GIN (code gin_trgm_ops);
+CREATE INDEX courses_title_trgm_idx ON courses USING GIN (title gin_trgm_ops);
+
+-- Faculty teaching a course, only they may grade its enrollments
+CREATE TABLE course_instructors (
+  course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+  faculty_id INT NOT NULL REFERENCES faculty(id) ON DELETE CASCADE,
+  assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (course_id, faculty_id)
+);
+
+CREATE INDEX course_instructors_faculty_idx ON course_instructors (faculty_id);
+
+-- Requirements to enroll into course_id. Requirements with the same group_number are alternatives, every group must be
+-- met. Without min_grade any passing grade counts. A corequisite may also be taken in the same term as the course.
+CREATE TABLE course_prerequisites (
+  id SERIAL PRIMARY KEY,
+  course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+  group_number INT NOT NULL CHECK (group_number > 0),
+  required_course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+  min_grade DECIMAL(4, 2) CHECK (min_grade >= 0),
+  is_corequisite BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE (course_id, group_number, required_course_id),
+  CHECK (course_id <> required_course_id)
+);
+
+CREATE INDEX course_prerequisites_required_idx ON course_prerequisites (required_course_id);
+
+-- A course offered in a term is taught in sections with a limited number of seats, students enrolling into a full
+-- section are put on its waitlist. The instructor of a section may grade its enrollments like course_instructors.
+CREATE TABLE course_sections (
+  id SERIAL PRIMARY KEY,
+  course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+  term_id INT NOT NULL REFERENCES terms(id),
+  section_number VARCHAR(10) NOT NULL,
+  instructor_id INT REFERENCES faculty(id) ON DELETE SET NULL,
+  capacity INT NOT NULL CHECK (capacity > 0),
+  room VARCHAR(50) NOT NULL DEFAULT '',
+  meeting_times VARCHAR(255) NOT NULL DEFAULT '',
+  UNIQUE (course_id, term_id, section_number)
+);
+
+CREATE INDEX course_sections_term_idx ON course_sections (term_id);
+
+-- A student may take a course again in a later term
+ALTER TABLE enrollments
+  ADD COLUMN term_id INT REFERENCES terms(id),
+  ADD COLUMN section_id INT REFERENCES course_sections(id),
+  DROP CONSTRAINT enrollments_student_id_course_id_key;
+
+-- Students waiting for a seat in a full section, promoted in order of created_at
+CREATE TABLE section_waitlist (
+  id SERIAL PRIMARY KEY,
+  section_id INT NOT NULL REFERENCES course_sections(id) ON DELETE CASCADE,
+  student_id INT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp(),
+  UNIQUE (section_id, student_id)
+);
+
+CREATE INDEX section_waitlist_order_idx ON section_waitlist (section_id, created_at, id);
+CREATE INDEX section_waitlist_student_idx ON section_waitlist (student_id);
+
+-- Audit of enrollments made although prerequisites were not met, unmet holds the requirements missing at the time.
+-- enrollment_id is NULL when the student was put on a waitlist instead.
+CREATE TABLE prerequisite_overrides (
+  id SERIAL PRIMARY KEY,
+  student_id INT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+  course_id INT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+  term_id INT NOT NULL REFERENCES terms(id),
+  enrollment_id INT REFERENCES enrollments(id) ON DELETE SET NULL,
+  unmet JSONB NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  overridden_by INT NOT NULL REFERENCES faculty(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX prerequisite_overrides_student_idx ON prerequisite_overrides (student_id);
+CREATE INDEX prerequisite_overrides_course_idx ON prerequisite_overrides (course_id);
+
+-- grade holds the grade points, mark and mark_kind are copied from the grading scale when grading so later scale changes
+-- do not alter existing grades. Special marks have no points, a row without grade and mark is not graded yet.
+ALTER TABLE grades
+  ALTER COLUMN grade TYPE DECIMAL(4, 2),
+  ADD COLUMN mark VARCHAR(10),
+  ADD COLUMN mark_kind VARCHAR(20);
+
+-- Login sessions, user_id refers to students or faculty depending on user_role
+CREATE TABLE sessions (
+  id VARCHAR(64) PRIMARY KEY,
+  user_id INT NOT NULL,
+  user_role VARCHAR(50) NOT NULL,
+  refresh_token_hash VARCHAR(64) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user_idx ON sessions (user_id, user_role);
+CREATE INDEX sessions_revoked_at_idx ON sessions (revoked_at) WHERE revoked_at IS NOT NULL;
+
+-- Failed login counters, keyed by account ('account:<role>:<id>') or client ('ip:<address>')
+CREATE TABLE login_attempts (
+  key VARCHAR(255) PRIMARY KEY,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  locked_until TIMESTAMPTZ
+);
+
+-- TOTP second factors, a factor is pending until the first code is verified
+CREATE TABLE mfa_factors (
+  user_id INT NOT NULL,
+  user_role VARCHAR(50) NOT NULL,
+  secret VARCHAR(64) NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, user_role)
+);
+
+CREATE TABLE mfa_recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  user_role VARCHAR(50) NOT NULL,
+  code_hash VARCHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ,
+  FOREIGN KEY (user_id, user_role) REFERENCES mfa_factors(user_id, user_role) ON DELETE CASCADE
+);
+
+-- Issued PDF transcripts, payload is the exact JSON that was signed so a document can be verified after the records change.
+-- No foreign key on student_id, an issued document stays verifiable after the student is deleted.
+CREATE TABLE transcript_documents (
+  id VARCHAR(64) PRIMARY KEY,
+  student_id INT NOT NULL,
+  issued_by_id INT NOT NULL,
+  issued_by_role VARCHAR(50) NOT NULL,
+  issued_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  payload TEXT NOT NULL,
+  signature TEXT NOT NULL,
+  key_id VARCHAR(64) NOT NULL,
+  pdf_sha256 VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX transcript_documents_student_idx ON transcript_documents (student_id);
+
+-- Reference data
+INSERT INTO roles (name, description) VALUES
+('admin', 'Full access, including faculty and role management'),
+('registrar', 'Manages student records, courses and enrollments'),
+('instructor', 'Teaches courses and grades enrollments'),
+('advisor', 'Advises students and manages their enrollments'),
+('student', 'Access to own records only');
+
+INSERT INTO permissions (name, description) VALUES
+('students:read', 'View all student records'),
+('students:write', 'Create and update student records'),
+('students:delete', 'Delete student records'),
+('courses:write', 'Create and update courses'),
+('courses:delete', 'Delete courses'),
+('enrollments:read', 'View all enrollments'),
+('enrollments:write', 'Enroll students into courses'),
+('enrollments:delete', 'Delete enrollments'),
+('grades:read', 'View all grades'),
+('grades:write', 'Add and update grades'),
+('grades:delete', 'Delete grades'),
+('grades:override', 'Grade enrollments of courses without teaching them'),
+('grading_scales:manage', 'Define grading scales and assign them to programs'),
+('terms:manage', 'Create academic terms and set their enrollment and grading deadlines'),
+('prerequisites:override', 'Enroll students who do not meet the prerequisites of a course'),
+('transcripts:read', 'View transcripts and GPA of any student'),
+('faculty:manage', 'Manage faculty accounts and their roles'),
+('accounts:unlock', 'Lift login lockouts');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES
+('registrar', 'students:read'), ('registrar', 'students:write'), ('registrar', 'students:delete'),
+('registrar', 'courses:write'), ('registrar', 'courses:delete'),
+('registrar', 'enrollments:read'), ('registrar', 'enrollments:write'), ('registrar', 'enrollments:delete'),
+('registrar', 'grades:read'), ('registrar', 'grades:write'), ('registrar', 'grades:delete'), ('registrar', 'grades:override'),
+('registrar', 'transcripts:read'), ('registrar', 'accounts:unlock'), ('registrar', 'grading_scales:manage'),
+('registrar', 'terms:manage'), ('registrar', 'prerequisites:override'),
+('instructor', 'students:read'), ('instructor', 'enrollments:read'),
+('instructor', 'grades:read'), ('instructor', 'grades:write'), ('instructor', 'grades:delete'),
+('instructor', 'transcripts:read'),
+('advisor', 'students:read'), ('advisor', 'enrollments:read'), ('advisor', 'enrollments:write'),
+('advisor', 'grades:read'), ('advisor', 'transcripts:read'), ('advisor', 'prerequisites:override');
+
+INSERT INTO grading_scales (name, is_default) VALUES
+('Letter (4.0)', TRUE),
+('Ten point', FALSE);
+
+INSERT INTO grading_scale_marks (scale_id, mark, description, points, kind) VALUES
+(1, 'A', 'Excellent', 4.00, 'graded'),
+(1, 'A-', '', 3.70, 'graded'),
+(1, 'B+', '', 3.30, 'graded'),
+(1, 'B', 'Good', 3.00, 'graded'),
+(1, 'B-', '', 2.70, 'graded'),
+(1, 'C+', '', 2.30, 'graded'),
+(1, 'C', 'Satisfactory', 2.00, 'graded'),
+(1, 'C-', '', 1.70, 'graded'),
+(1, 'D+', '', 1.30, 'graded'),
+(1, 'D', 'Poor', 1.00, 'graded'),
+(1, 'F', 'Fail', 0.00, 'graded'),
+(1, 'P', 'Pass', NULL, 'pass'),
+(1, 'NP', 'No pass', NULL, 'fail'),
+(1, 'I', 'Incomplete', NULL, 'incomplete'),
+(1, 'W', 'Withdrawn', NULL, 'withdrawn'),
+(2, 'O', 'Outstanding', 10.00, 'graded'),
+(2, 'A+', 'Excellent', 9.00, 'graded'),
+(2, 'A', 'Very good', 8.00, 'graded'),
+(2, 'B+', 'Good', 7.00, 'graded'),
+(2, 'B', 'Above average', 6.00, 'graded'),
+(2, 'C', 'Average', 5.00, 'graded'),
+(2, 'D', 'Pass', 4.00, 'graded'),
+(2, 'F', 'Fail', 0.00, 'graded'),
+(2, 'P', 'Pass', NULL, 'pass'),
+(2, 'NP', 'No pass', NULL, 'fail'),
+(2, 'I', 'Incomplete', NULL, 'incomplete'),
+(2, 'W', 'Withdrawn', NULL, 'withdrawn');
+
+INSERT INTO user_roles (user_id, user_role, role)
+SELECT id, 'faculty', 'admin' FROM faculty;
+
+-- Each semester graded so far becomes a term, starting with its first enrollment. Start dates are moved forward where
+-- needed so they strictly follow the order of the IDs, which validate_term requires. Each term ends the day before the
+-- next one starts, the last one after about four months.
+WITH found AS (
+  SELECT g.semester AS id, MIN(e.enrollment_date) AS first_enrollment
+  FROM grades g
+  JOIN enrollments e ON e.id = g.enrollment_id
+  GROUP BY g.semester
+  UNION ALL
+  SELECT (SELECT COALESCE(MAX(g.semester), 0) + 1 FROM grades g), MIN(e.enrollment_date)
+  FROM enrollments e
+  WHERE NOT EXISTS (SELECT 1 FROM grades g WHERE g.enrollment_id = e.id)
+  HAVING COUNT(*) > 0
+),
+numbered AS (
+  SELECT id, first_enrollment, row_number() OVER (ORDER BY id)::INT AS n FROM found
+),
+started AS (
+  SELECT id, MAX(first_enrollment - n) OVER (ORDER BY id) + n AS start_date FROM numbered
+),
+dated AS (
+  SELECT id, start_date, COALESCE(LEAD(start_date) OVER (ORDER BY id) - 1, start_date + 120) AS end_date FROM started
+)
+INSERT INTO terms (id, name, start_date, end_date, enrollment_opens, enrollment_closes, grades_due)
+SELECT id, 'Term ' || id, start_date, end_date, start_date, start_date, end_date
+FROM dated;
+
+-- An enrollment belongs to the first semester it was graded in, ungraded ones to the term added after the last semester
+UPDATE enrollments e
+SET term_id = COALESCE(
+  (SELECT MIN(g.semester) FROM grades g WHERE g.enrollment_id = e.id),
+  (SELECT MAX(t.id) FROM terms t)
+);
+
+ALTER TABLE enrollments
+  ALTER COLUMN term_id SET NOT NULL,
+  ADD UNIQUE (student_id, course_id, term_id);
+
+CREATE INDEX enrollments_term_idx ON enrollments (term_id);
+CREATE INDEX enrollments_section_idx ON enrollments (section_id);
+
+ALTER TABLE grades ADD FOREIGN KEY (semester) REFERENCES terms(id);
+
+-- The backend rehashes these with its own cost on the next login. The date of birth was the default password when none
+-- was set, it may only be used once.
+UPDATE students
+SET password = crypt(to_char(date_of_birth, 'YYYY-MM-DD'), gen_salt('bf', 10)), must_change_password = TRUE
+WHERE password = '';
+
+UPDATE students
+SET password = crypt(password, gen_salt('bf', 10))
+WHERE password !~ '^\$2[aby]\$';
+
+UPDATE faculty
+SET password = crypt(to_char(date_of_birth, 'YYYY-MM-DD'), gen_salt('bf', 10)), must_change_password = TRUE
+WHERE password = '';
+
+UPDATE faculty
+SET password = crypt(password, gen_salt('bf', 10))
+WHERE password !~ '^\$2[aby]\$';
+
+CREATE OR REPLACE FUNCTION get_user_credentials(
+  p_id INT,
+  p_role VARCHAR
+)
+RETURNS TABLE (
+  user_id INT,
+  user_role VARCHAR,
+  password VARCHAR,
+  date_of_birth DATE,
+  must_change_password BOOLEAN
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_role = 'student' THEN
+    RETURN QUERY SELECT s.id, p_role, s.password, s.date_of_birth, s.must_change_password FROM students s WHERE s.id = p_id;
+  ELSIF p_role = 'faculty' THEN
+    RETURN QUERY SELECT f.id, p_role, f.password, f.date_of_birth, f.must_change_password FROM faculty f WHERE f.id = p_id AND f.active;
+  ELSE
+    RAISE EXCEPTION 'Invalid role specified';
+  END IF;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid credentials';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE set_user_password(
+  p_id INT,
+  p_role VARCHAR,
+  p_password_hash VARCHAR,
+  p_must_change_password BOOLEAN
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_password_hash IS NULL OR p_password_hash = '' THEN
+    RAISE EXCEPTION 'Password is required';
+  END IF;
+
+  IF p_role = 'student' THEN
+    UPDATE students SET password = p_password_hash, must_change_password = p_must_change_password WHERE id = p_id;
+  ELSIF p_role = 'faculty' THEN
+    UPDATE faculty SET password = p_password_hash, must_change_password = p_must_change_password WHERE id = p_id;
+  ELSE
+    RAISE EXCEPTION 'Invalid role specified';
+  END IF;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid credentials';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE create_session(
+  p_id VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_refresh_token_hash VARCHAR,
+  p_expires_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  INSERT INTO sessions (id, user_id, user_role, refresh_token_hash, expires_at)
+  VALUES (p_id, p_user_id, p_user_role, p_refresh_token_hash, p_expires_at);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_active_session(
+  p_id VARCHAR
+)
+RETURNS TABLE (
+  user_id INT,
+  user_role VARCHAR,
+  refresh_token_hash VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY
+  SELECT s.user_id, s.user_role, s.refresh_token_hash
+  FROM sessions s
+  WHERE s.id = p_id AND s.revoked_at IS NULL AND s.expires_at > NOW();
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid refresh token';
+  END IF;
+END;
+$$;
+
+-- Only succeeds if the session still holds p_old_hash, so two concurrent refreshes can not both win
+CREATE OR REPLACE PROCEDURE rotate_session(
+  p_id VARCHAR,
+  p_old_hash VARCHAR,
+  p_new_hash VARCHAR,
+  p_expires_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE sessions
+  SET refresh_token_hash = p_new_hash,
+    expires_at = p_expires_at
+  WHERE id = p_id AND refresh_token_hash = p_old_hash AND revoked_at IS NULL;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid refresh token';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE revoke_session(
+  p_id VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE sessions SET revoked_at = NOW() WHERE id = p_id AND revoked_at IS NULL;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION revoke_user_sessions(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF VARCHAR
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY
+  UPDATE sessions SET revoked_at = NOW()
+  WHERE user_id = p_user_id AND user_role = p_user_role AND revoked_at IS NULL
+  RETURNING id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_revoked_sessions(
+  p_since TIMESTAMPTZ
+)
+RETURNS TABLE (
+  id VARCHAR,
+  revoked_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT s.id, s.revoked_at FROM sessions s WHERE s.revoked_at >= p_since;
+END;
+$$;
+
+-- Counters idle for longer than p_window start over
+CREATE OR REPLACE FUNCTION record_login_failure(
+  p_key VARCHAR,
+  p_window INTERVAL
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_failures INT;
+BEGIN
+  INSERT INTO login_attempts AS a (key, failures, last_failure)
+  VALUES (p_key, 1, NOW())
+  ON CONFLICT (key) DO UPDATE
+  SET failures = CASE WHEN a.last_failure < NOW() - p_window THEN 1 ELSE a.failures + 1 END,
+    last_failure = NOW()
+  RETURNING a.failures INTO v_failures;
+
+  RETURN v_failures;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE lock_login_key(
+  p_key VARCHAR,
+  p_locked_until TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE login_attempts SET locked_until = p_locked_until WHERE key = p_key;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_login_locked_until(
+  p_key VARCHAR
+)
+RETURNS TIMESTAMPTZ
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_locked_until TIMESTAMPTZ;
+BEGIN
+  SELECT locked_until INTO v_locked_until FROM login_attempts WHERE key = p_key;
+  RETURN v_locked_until;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE reset_login_key(
+  p_key VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM login_attempts WHERE key = p_key;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_mfa_factor(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  secret VARCHAR,
+  enabled BOOLEAN,
+  last_used_step BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY
+  SELECT f.secret, f.enabled, f.last_used_step
+  FROM mfa_factors f
+  WHERE f.user_id = p_user_id AND f.user_role = p_user_role;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE set_mfa_factor(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_secret VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF EXISTS(SELECT 1 FROM mfa_factors WHERE user_id = p_user_id AND user_role = p_user_role AND enabled) THEN
+    RAISE EXCEPTION 'Two-factor authentication is already enabled';
+  END IF;
+
+  INSERT INTO mfa_factors (user_id, user_role, secret)
+  VALUES (p_user_id, p_user_role, p_secret)
+  ON CONFLICT (user_id, user_role) DO UPDATE
+  SET secret = EXCLUDED.secret,
+    last_used_step = 0,
+    created_at = NOW();
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE enable_mfa_factor(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_step BIGINT,
+  p_recovery_code_hashes VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE mfa_factors
+  SET enabled = TRUE,
+    last_used_step = p_step
+  WHERE user_id = p_user_id AND user_role = p_user_role AND NOT enabled;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Two-factor authentication is already enabled';
+  END IF;
+
+  DELETE FROM mfa_recovery_codes WHERE user_id = p_user_id AND user_role = p_user_role;
+  INSERT INTO mfa_recovery_codes (user_id, user_role, code_hash)
+  SELECT p_user_id, p_user_role, h FROM unnest(p_recovery_code_hashes) AS h;
+END;
+$$;
+
+-- Fails for steps that were already used, so a code can not be replayed
+CREATE OR REPLACE PROCEDURE use_mfa_step(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_step BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE mfa_factors
+  SET last_used_step = p_step
+  WHERE user_id = p_user_id AND user_role = p_user_role AND enabled AND last_used_step < p_step;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid verification code';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE use_recovery_code(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_code_hash VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  UPDATE mfa_recovery_codes
+  SET used_at = NOW()
+  WHERE id = (
+    SELECT id FROM mfa_recovery_codes
+    WHERE user_id = p_user_id AND user_role = p_user_role AND code_hash = p_code_hash AND used_at IS NULL
+    LIMIT 1
+  );
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid verification code';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_mfa_factor(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  DELETE FROM mfa_factors WHERE user_id = p_user_id AND user_role = p_user_role;
+END;
+$$;
+
+-- Effective roles of a user, deactivated faculty hold none
+CREATE OR REPLACE FUNCTION get_user_roles(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF VARCHAR
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role = 'faculty' AND NOT EXISTS(SELECT 1 FROM faculty WHERE id = p_user_id AND active) THEN
+    RETURN;
+  END IF;
+
+  RETURN QUERY
+  SELECT ur.role FROM user_roles ur WHERE ur.user_id = p_user_id AND ur.user_role = p_user_role
+  UNION
+  SELECT 'student'::VARCHAR WHERE p_user_role = 'student';
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_user_permissions(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF VARCHAR
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY
+  SELECT DISTINCT rp.permission
+  FROM role_permissions rp
+  WHERE rp.role IN (SELECT get_user_roles(p_user_id, p_user_role))
+  ORDER BY rp.permission;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION has_permission(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_permission VARCHAR
+)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN EXISTS(SELECT 1 FROM get_user_permissions(p_user_id, p_user_role) AS p WHERE p = p_permission);
+END;
+$$;
+
+-- Raises insufficient_privilege, so catch all exception handlers can let it through unchanged
+CREATE OR REPLACE PROCEDURE require_permission(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_permission VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NOT has_permission(p_user_id, p_user_role, p_permission) THEN
+    RAISE EXCEPTION 'Access denied. Missing permission %.', p_permission USING ERRCODE = 'insufficient_privilege';
+  END IF;
+END;
+$$;
+
+-- Replaces all role assignments of a user
+CREATE OR REPLACE PROCEDURE set_user_roles(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_roles VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_unknown VARCHAR;
+BEGIN
+  SELECT r INTO v_unknown FROM unnest(COALESCE(p_roles, '{}')) AS r WHERE r NOT IN (SELECT name FROM roles) LIMIT 1;
+  IF FOUND THEN
+    RAISE EXCEPTION 'Invalid role %', v_unknown;
+  END IF;
+
+  DELETE FROM user_roles WHERE user_id = p_user_id AND user_role = p_user_role;
+  INSERT INTO user_roles (user_id, user_role, role)
+  SELECT DISTINCT p_user_id, p_user_role, r FROM unnest(COALESCE(p_roles, '{}')) AS r;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_roles(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  name VARCHAR,
+  description TEXT,
+  permissions VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  RETURN QUERY
+  SELECT r.name, r.description,
+    ARRAY(SELECT rp.permission FROM role_permissions rp WHERE rp.role = r.name ORDER BY rp.permission)::VARCHAR[]
+  FROM roles r
+  ORDER BY r.name;
+END;
+$$;
+
+-- p_password is expected to already be hashed by the backend
+CREATE OR REPLACE FUNCTION create_student(
+  p_name VARCHAR,
+  p_password VARCHAR,
+  p_date_of_birth DATE,
+  p_address TEXT,
+  p_contact VARCHAR,
+  p_program VARCHAR,
+  p_must_change_password BOOLEAN,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'students:write');
+
+  IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Student name is required';
+  END IF;
+  IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Student date of birth is required';
+  END IF;
+
+  IF p_password IS NULL OR p_password = '' THEN
+    RAISE EXCEPTION 'Password is required';
+  END IF;
+
+  INSERT INTO students (name, password, must_change_password, date_of_birth, address, contact, program)
+  VALUES (p_name, p_password, p_must_change_password, p_date_of_birth, p_address, p_contact, p_program)
+  RETURNING id INTO v_student_id;
+
+  RETURN v_student_id;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to create student: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_students(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF students
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'students:read') THEN
+    RETURN QUERY SELECT * FROM students;
+  ELSIF p_user_role = 'student' THEN
+    RETURN QUERY SELECT * FROM students WHERE id = p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+-- Keyset paginated student list. Rows are ordered by (sort key, id) and the page starts after the
+-- (p_after_value, p_after_id) cursor. total_count counts all rows matching the filters, ignoring the cursor.
+CREATE OR REPLACE FUNCTION get_students_page(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_program VARCHAR,
+  p_name_prefix VARCHAR,
+  p_sort VARCHAR,
+  p_descending BOOLEAN,
+  p_after_value TEXT,
+  p_after_id INT,
+  p_limit INT
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  address TEXT,
+  contact VARCHAR,
+  program VARCHAR,
+  sort_value TEXT,
+  total_count BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_own_id INT;
+  v_sort_key TEXT;
+  v_sort_type TEXT;
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'students:read') THEN
+    v_own_id := NULL;
+  ELSIF p_user_role = 'student' THEN
+    v_own_id := p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  -- Whitelisted sort keys, never interpolate p_sort itself
+  CASE p_sort
+    WHEN 'id' THEN v_sort_key := 's.id'; v_sort_type := 'INT';
+    WHEN 'name' THEN v_sort_key := 's.name'; v_sort_type := 'VARCHAR';
+    WHEN 'date_of_birth' THEN v_sort_key := 's.date_of_birth'; v_sort_type := 'DATE';
+    WHEN 'program' THEN v_sort_key := 's.program'; v_sort_type := 'VARCHAR';
+    ELSE RAISE EXCEPTION 'Invalid sort field';
+  END CASE;
+
+  RETURN QUERY EXECUTE format($query$
+    SELECT f.id, f.name, f.date_of_birth, f.address, f.contact, f.program, f.sort_key::TEXT, f.total_count
+    FROM (
+      SELECT s.*, %1$s AS sort_key, count(*) OVER () AS total_count
+      FROM students s
+      WHERE ($1::INT IS NULL OR s.id = $1)
+        AND ($2::VARCHAR IS NULL OR s.program = $2)
+        AND ($3::VARCHAR IS NULL OR starts_with(lower(s.name), lower($3)))
+    ) f
+    WHERE $4::TEXT IS NULL OR (f.sort_key, f.id) %3$s (CAST($4 AS %2$s), $5)
+    ORDER BY f.sort_key %4$s, f.id %4$s
+    LIMIT $6
+  $query$, v_sort_key, v_sort_type, CASE WHEN p_descending THEN '<' ELSE '>' END, CASE WHEN p_descending THEN 'DESC' ELSE 'ASC' END)
+  USING v_own_id, p_program, p_name_prefix, p_after_value, p_after_id, p_limit;
+
+EXCEPTION
+  WHEN data_exception THEN
+    RAISE EXCEPTION 'Invalid cursor';
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_student_by_id(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF students
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'students:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own details.';
+  END IF;
+
+  RETURN QUERY SELECT * FROM students WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_student(
+  p_student_id INT,
+  p_name VARCHAR,
+  p_date_of_birth DATE,
+  p_address TEXT,
+  p_contact VARCHAR,
+  p_program VARCHAR,
+  p_password_hash VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'students:write');
+
+   IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Student name is required';
+  END IF;
+   IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Student date of birth is required';
+  END IF;
+
+  UPDATE students
+  SET name = p_name,
+    date_of_birth = p_date_of_birth,
+    address = p_address,
+    contact = p_contact,
+    program = p_program,
+    password = COALESCE(NULLIF(p_password_hash, ''), password),
+    must_change_password = must_change_password OR COALESCE(p_password_hash, '') != ''
+  WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update student: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_student(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'students:delete');
+
+  DELETE FROM students WHERE id = p_student_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete student: %', SQLERRM;
+END;
+$$;
+
+-- p_password is expected to already be hashed by the backend
+CREATE OR REPLACE FUNCTION create_faculty(
+  p_name VARCHAR,
+  p_password VARCHAR,
+  p_date_of_birth DATE,
+  p_info TEXT,
+  p_roles VARCHAR[],
+  p_must_change_password BOOLEAN,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_faculty_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Faculty name is required';
+  END IF;
+  IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Faculty date of birth is required';
+  END IF;
+  IF p_password IS NULL OR p_password = '' THEN
+    RAISE EXCEPTION 'Password is required';
+  END IF;
+
+  INSERT INTO faculty (name, password, must_change_password, date_of_birth, info)
+  VALUES (p_name, p_password, p_must_change_password, p_date_of_birth, p_info)
+  RETURNING id INTO v_faculty_id;
+
+  CALL set_user_roles(v_faculty_id, 'faculty', p_roles);
+
+  RETURN v_faculty_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_faculty(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  info TEXT,
+  active BOOLEAN,
+  roles VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  RETURN QUERY
+  SELECT f.id, f.name, f.date_of_birth, f.info, f.active,
+    ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = f.id AND ur.user_role = 'faculty' ORDER BY ur.role)::VARCHAR[]
+  FROM faculty f
+  ORDER BY f.id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_faculty_by_id(
+  p_faculty_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  info TEXT,
+  active BOOLEAN,
+  roles VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  RETURN QUERY
+  SELECT f.id, f.name, f.date_of_birth, f.info, f.active,
+    ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = f.id AND ur.user_role = 'faculty' ORDER BY ur.role)::VARCHAR[]
+  FROM faculty f
+  WHERE f.id = p_faculty_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+END;
+$$;
+
+-- Profile of the requesting faculty member, does not need faculty:manage
+CREATE OR REPLACE FUNCTION get_faculty_profile(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  info TEXT,
+  active BOOLEAN,
+  roles VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_user_role != 'faculty' THEN
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  RETURN QUERY
+  SELECT f.id, f.name, f.date_of_birth, f.info, f.active,
+    ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = f.id AND ur.user_role = 'faculty' ORDER BY ur.role)::VARCHAR[]
+  FROM faculty f
+  WHERE f.id = p_user_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_faculty(
+  p_faculty_id INT,
+  p_name VARCHAR,
+  p_date_of_birth DATE,
+  p_info TEXT,
+  p_roles VARCHAR[],
+  p_password_hash VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  IF p_name IS NULL OR p_name = '' THEN
+    RAISE EXCEPTION 'Faculty name is required';
+  END IF;
+  IF p_date_of_birth IS NULL THEN
+    RAISE EXCEPTION 'Faculty date of birth is required';
+  END IF;
+  IF p_roles IS NOT NULL AND p_faculty_id = p_user_id AND p_user_role = 'faculty' AND NOT ('admin' = ANY(p_roles)) THEN
+    RAISE EXCEPTION 'Administrators can not revoke their own access';
+  END IF;
+
+  UPDATE faculty
+  SET name = p_name,
+    date_of_birth = p_date_of_birth,
+    info = p_info,
+    password = COALESCE(NULLIF(p_password_hash, ''), password),
+    must_change_password = must_change_password OR COALESCE(p_password_hash, '') != ''
+  WHERE id = p_faculty_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+
+  -- Roles are left untouched when none are given
+  IF p_roles IS NOT NULL THEN
+    CALL set_user_roles(p_faculty_id, 'faculty', p_roles);
+  END IF;
+END;
+$$;
+
+-- Faculty are never deleted as grades and history refer to them, deactivated faculty can no longer log in
+CREATE OR REPLACE PROCEDURE deactivate_faculty(
+  p_faculty_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  IF p_faculty_id = p_user_id AND p_user_role = 'faculty' THEN
+    RAISE EXCEPTION 'Administrators can not revoke their own access';
+  END IF;
+
+  UPDATE faculty SET active = FALSE WHERE id = p_faculty_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_course(
+  p_code VARCHAR,
+  p_title VARCHAR,
+  p_credits DECIMAL(3, 2),
+  p_grading_scale_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_course_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  IF p_code IS NULL OR p_code = '' THEN
+    RAISE EXCEPTION 'Course code is required';
+  END IF;
+  IF p_title IS NULL OR p_title = '' THEN
+    RAISE EXCEPTION 'Course title is required';
+  END IF;
+  IF p_credits IS NULL OR p_credits <= 0 THEN
+    RAISE EXCEPTION 'Positive credits are required';
+  END IF;
+
+  INSERT INTO courses (code, title, credits, grading_scale_id)
+  VALUES (p_code, p_title, p_credits, p_grading_scale_id)
+  RETURNING id INTO v_course_id;
+
+  RETURN v_course_id;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Course with code % already exists', p_code;
+  WHEN foreign_key_violation THEN
+    RAISE EXCEPTION 'Invalid grading scale ID';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to create course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_all_courses()
+RETURNS SETOF courses
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM courses;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_course_by_id(
+  p_course_id INT
+)
+RETURNS SETOF courses
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM courses WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+END;
+$$;
+
+-- Ranked search over students and courses. Matches either the full text index or, for typos and
+-- partial words, trigram word similarity. Students are only visible with students:read, or to themselves.
+CREATE OR REPLACE FUNCTION search(
+  p_query TEXT,
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_limit INT
+)
+RETURNS TABLE (
+  kind VARCHAR,
+  id INT,
+  label VARCHAR,
+  detail TEXT,
+  rank REAL
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+  v_tsquery TSQUERY;
+  v_all_students BOOLEAN;
+BEGIN
+  IF p_query IS NULL OR btrim(p_query) = '' THEN
+    RAISE EXCEPTION 'Search query is required';
+  END IF;
+
+  v_tsquery := websearch_to_tsquery('simple', p_query);
+  v_all_students := has_permission(p_user_id, p_user_role, 'students:read');
+
+  RETURN QUERY
+  SELECT r.kind, r.id, r.label, r.detail, r.rank
+  FROM (
+    SELECT 'student'::VARCHAR AS kind, s.id, s.name AS label, s.program::TEXT AS detail,
+      (ts_rank(s.search_vector, v_tsquery)
+        + GREATEST(word_similarity(p_query, s.name), word_similarity(p_query, s.contact), word_similarity(p_query, s.program)))::REAL AS rank
+    FROM students s
+    WHERE (v_all_students OR (p_user_role = 'student' AND s.id = p_user_id))
+      AND (s.search_vector @@ v_tsquery OR p_query <% s.name OR p_query <% s.contact OR p_query <% s.program)
+
+    UNION ALL
+
+    SELECT 'course'::VARCHAR, c.id, c.code, c.title::TEXT,
+      (ts_rank(c.search_vector, v_tsquery)
+        + GREATEST(word_similarity(p_query, c.code), word_similarity(p_query, c.title)))::REAL
+    FROM courses c
+    WHERE c.search_vector @@ v_tsquery OR p_query <% c.code OR p_query <% c.title
+  ) r
+  ORDER BY r.rank DESC, r.kind, r.id
+  LIMIT p_limit;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_course(
+  p_course_id INT,
+  p_code VARCHAR,
+  p_title VARCHAR,
+  p_credits DECIMAL(3, 2),
+  p_grading_scale_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  IF p_code IS NULL OR p_code = '' THEN
+    RAISE EXCEPTION 'Course code is required';
+  END IF;
+  IF p_title IS NULL OR p_title = '' THEN
+    RAISE EXCEPTION 'Course title is required';
+  END IF;
+  IF p_credits IS NULL OR p_credits <= 0 THEN
+    RAISE EXCEPTION 'Positive credits are required';
+  END IF;
+
+  UPDATE courses
+  SET code = p_code,
+    title = p_title,
+    credits = p_credits,
+    grading_scale_id = p_grading_scale_id
+  WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Course with code % already exists', p_code;
+  WHEN foreign_key_violation THEN
+    RAISE EXCEPTION 'Invalid grading scale ID';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_course(
+  p_course_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:delete');
+
+  DELETE FROM courses WHERE id = p_course_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete course: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_course_instructors(
+  p_course_id INT
+)
+RETURNS TABLE (
+  faculty_id INT,
+  name VARCHAR,
+  assigned_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM courses c WHERE c.id = p_course_id) THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT f.id, f.name, ci.assigned_at
+  FROM course_instructors ci
+  JOIN faculty f ON f.id = ci.faculty_id
+  WHERE ci.course_id = p_course_id
+  ORDER BY f.name;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE assign_course_instructor(
+  p_course_id INT,
+  p_faculty_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  IF NOT EXISTS (SELECT 1 FROM courses WHERE id = p_course_id) THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM faculty WHERE id = p_faculty_id AND active) THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+
+  INSERT INTO course_instructors (course_id, faculty_id)
+  VALUES (p_course_id, p_faculty_id);
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Instructor is already assigned to this course';
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE unassign_course_instructor(
+  p_course_id INT,
+  p_faculty_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  DELETE FROM course_instructors WHERE course_id = p_course_id AND faculty_id = p_faculty_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Instructor is not assigned to this course';
+  END IF;
+END;
+$$;
+
+-- Grades of an enrollment may only be changed by instructors of its course or section, unless the user holds grades:override
+CREATE OR REPLACE PROCEDURE require_course_instructor(
+  p_enrollment_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'grades:override') THEN
+    RETURN;
+  END IF;
+
+  IF p_user_role != 'faculty' OR NOT EXISTS (
+    SELECT 1
+    FROM enrollments e
+    WHERE e.id = p_enrollment_id AND (
+      EXISTS (SELECT 1 FROM course_instructors ci WHERE ci.course_id = e.course_id AND ci.faculty_id = p_user_id)
+      OR EXISTS (SELECT 1 FROM course_sections cs WHERE cs.id = e.section_id AND cs.instructor_id = p_user_id)
+    )
+  ) THEN
+    RAISE EXCEPTION 'Access denied. Only instructors of the course can grade this enrollment.'
+      USING ERRCODE = 'insufficient_privilege';
+  END IF;
+END;
+$$;
+
+-- Requirements of a course ordered by group, with the codes of the required courses
+CREATE OR REPLACE FUNCTION get_course_prerequisites(
+  p_course_id INT
+)
+RETURNS TABLE (
+  group_number INT,
+  required_course_id INT,
+  required_course_code VARCHAR,
+  min_grade DECIMAL,
+  is_corequisite BOOLEAN
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM courses WHERE id = p_course_id) THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT cp.group_number, cp.required_course_id, c.code, cp.min_grade, cp.is_corequisite
+  FROM course_prerequisites cp
+  JOIN courses c ON c.id = cp.required_course_id
+  WHERE cp.course_id = p_course_id
+  ORDER BY cp.group_number, c.code;
+END;
+$$;
+
+-- Replace the requirements of a course, p_requirements is a JSON array of {group, required_course_id, min_grade, corequisite}.
+-- Prerequisites (not corequisites, which are often mutual) may not lead back to the course.
+CREATE OR REPLACE PROCEDURE set_course_prerequisites(
+  p_course_id INT,
+  p_requirements JSONB,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  IF NOT EXISTS (SELECT 1 FROM courses WHERE id = p_course_id) THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+
+  IF p_requirements IS NULL OR jsonb_typeof(p_requirements) <> 'array' THEN
+    RAISE EXCEPTION 'Invalid prerequisite definition';
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM jsonb_to_recordset(p_requirements) AS x("group" INT, required_course_id INT, min_grade DECIMAL)
+    WHERE x."group" IS NULL OR x."group" <= 0 OR x.required_course_id IS NULL OR x.min_grade < 0 OR x.min_grade >= 100
+  ) THEN
+    RAISE EXCEPTION 'Invalid prerequisite definition';
+  END IF;
+
+  IF EXISTS (SELECT 1 FROM jsonb_to_recordset(p_requirements) AS x(required_course_id INT) WHERE x.required_course_id = p_course_id) THEN
+    RAISE EXCEPTION 'A course can not require itself';
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM jsonb_to_recordset(p_requirements) AS x(required_course_id INT)
+    WHERE NOT EXISTS (SELECT 1 FROM courses c WHERE c.id = x.required_course_id)
+  ) THEN
+    RAISE EXCEPTION 'Invalid prerequisite course ID';
+  END IF;
+
+  DELETE FROM course_prerequisites WHERE course_id = p_course_id;
+  INSERT INTO course_prerequisites (course_id, group_number, required_course_id, min_grade, is_corequisite)
+  SELECT p_course_id, x."group", x.required_course_id, x.min_grade, COALESCE(x.corequisite, FALSE)
+  FROM jsonb_to_recordset(p_requirements) AS x("group" INT, required_course_id INT, min_grade DECIMAL, corequisite BOOLEAN);
+
+  IF EXISTS (
+    WITH RECURSIVE required (course_id) AS (
+      SELECT cp.required_course_id FROM course_prerequisites cp WHERE cp.course_id = p_course_id AND NOT cp.is_corequisite
+      UNION
+      SELECT cp.required_course_id
+      FROM required r
+      JOIN course_prerequisites cp ON cp.course_id = r.course_id AND NOT cp.is_corequisite
+    )
+    SELECT 1 FROM required WHERE course_id = p_course_id
+  ) THEN
+    RAISE EXCEPTION 'Prerequisites can not form a cycle';
+  END IF;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Duplicate prerequisite in group';
+END;
+$$;
+
+-- Requirements of every group of p_course_id the student does not meet for enrolling in p_term_id. A prerequisite is
+-- met by a passing grade (points above 0 or a pass mark, or at least min_grade points) in an earlier term, a
+-- corequisite also by a grade in or an enrollment into the same term.
+CREATE OR REPLACE FUNCTION get_unmet_prerequisites(
+  p_student_id INT,
+  p_course_id INT,
+  p_term_id INT
+)
+RETURNS TABLE (
+  group_number INT,
+  required_course_id INT,
+  required_course_code VARCHAR,
+  min_grade DECIMAL,
+  is_corequisite BOOLEAN
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  WITH requirements AS (
+    SELECT
+      cp.*,
+      EXISTS (
+        SELECT 1
+        FROM enrollments e
+        JOIN grades g ON g.enrollment_id = e.id
+        WHERE e.student_id = p_student_id AND e.course_id = cp.required_course_id
+          AND (g.semester < p_term_id OR (cp.is_corequisite AND g.semester = p_term_id))
+          AND CASE WHEN cp.min_grade IS NULL THEN g.grade > 0 OR g.mark_kind = 'pass' ELSE g.grade >= cp.min_grade END
+      ) OR (cp.is_corequisite AND EXISTS (
+        SELECT 1 FROM enrollments e
+        WHERE e.student_id = p_student_id AND e.course_id = cp.required_course_id AND e.term_id = p_term_id
+      )) AS met
+    FROM course_prerequisites cp
+    WHERE cp.course_id = p_course_id
+  )
+  SELECT r.group_number, r.required_course_id, c.code, r.min_grade, r.is_corequisite
+  FROM requirements r
+  JOIN courses c ON c.id = r.required_course_id
+  WHERE NOT EXISTS (SELECT 1 FROM requirements m WHERE m.group_number = r.group_number AND m.met)
+  ORDER BY r.group_number, c.code;
+END;
+$$;
+
+-- Overrides filtered by student and course, newest first
+CREATE OR REPLACE FUNCTION get_prerequisite_overrides(
+  p_student_id INT,
+  p_course_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF prerequisite_overrides
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NOT has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  RETURN QUERY
+  SELECT *
+  FROM prerequisite_overrides po
+  WHERE (p_student_id IS NULL OR po.student_id = p_student_id)
+    AND (p_course_id IS NULL OR po.course_id = p_course_id)
+  ORDER BY po.created_at DESC, po.id DESC;
+END;
+$$;
+
+-- Lookups used by bulk imports to validate rows before they are copied in
+CREATE OR REPLACE FUNCTION get_existing_course_codes(
+  p_codes VARCHAR[]
+)
+RETURNS SETOF VARCHAR
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT c.code FROM courses c WHERE c.code = ANY(p_codes);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_existing_student_ids(
+  p_ids INT[]
+)
+RETURNS SETOF INT
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT s.id FROM students s WHERE s.id = ANY(p_ids);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_existing_course_ids(
+  p_ids INT[]
+)
+RETURNS SETOF INT
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT c.id FROM courses c WHERE c.id = ANY(p_ids);
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_existing_term_ids(
+  p_ids INT[]
+)
+RETURNS SETOF INT
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT t.id FROM terms t WHERE t.id = ANY(p_ids);
+END;
+$$;
+
+-- p_student_ids, p_course_ids and p_term_ids are parallel arrays of (student, course, term) triples
+CREATE OR REPLACE FUNCTION get_existing_enrollments(
+  p_student_ids INT[],
+  p_course_ids INT[],
+  p_term_ids INT[]
+)
+RETURNS TABLE (
+  student_id INT,
+  course_id INT,
+  term_id INT
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  SELECT e.student_id, e.course_id, e.term_id
+  FROM enrollments e
+  JOIN unnest(p_student_ids, p_course_ids, p_term_ids) AS p(student_id, course_id, term_id)
+    ON e.student_id = p.student_id AND e.course_id = p.course_id AND e.term_id = p.term_id;
+END;
+$$;
+
+-- All terms, or only p_term_id
+CREATE OR REPLACE FUNCTION get_terms(
+  p_term_id INT DEFAULT NULL
+)
+RETURNS SETOF terms
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM terms WHERE p_term_id IS NULL OR id = p_term_id ORDER BY id;
+
+  IF NOT FOUND AND p_term_id IS NOT NULL THEN
+    RAISE EXCEPTION 'Term not found';
+  END IF;
+END;
+$$;
+
+-- Checks shared by create_term and update_term. Term IDs must sort like the start dates, see the terms table.
+CREATE OR REPLACE PROCEDURE validate_term(
+  p_term_id INT,
+  p_name VARCHAR,
+  p_start_date DATE,
+  p_end_date DATE,
+  p_enrollment_opens DATE,
+  p_enrollment_closes DATE,
+  p_grades_due DATE
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_term_id IS NULL OR p_term_id <= 0 THEN
+    RAISE EXCEPTION 'Term ID is required';
+  END IF;
+
+  IF p_name IS NULL OR btrim(p_name) = '' THEN
+    RAISE EXCEPTION 'Term name is required';
+  END IF;
+
+  IF p_start_date IS NULL OR p_end_date IS NULL OR p_enrollment_opens IS NULL OR p_enrollment_closes IS NULL OR p_grades_due IS NULL THEN
+    RAISE EXCEPTION 'Term dates are required';
+  END IF;
+
+  IF p_start_date > p_end_date THEN
+    RAISE EXCEPTION 'Term must start before it ends';
+  END IF;
+
+  IF p_enrollment_opens > p_enrollment_closes THEN
+    RAISE EXCEPTION 'Enrollment must open before it closes';
+  END IF;
+
+  IF p_grades_due < p_start_date THEN
+    RAISE EXCEPTION 'Grades can not be due before the term starts';
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM terms t
+    WHERE t.id <> p_term_id AND (t.start_date = p_start_date OR (t.id < p_term_id) <> (t.start_date < p_start_date))
+  ) THEN
+    RAISE EXCEPTION 'Term IDs must follow the order of start dates';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE create_term(
+  p_term_id INT,
+  p_name VARCHAR,
+  p_start_date DATE,
+  p_end_date DATE,
+  p_enrollment_opens DATE,
+  p_enrollment_closes DATE,
+  p_grades_due DATE,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'terms:manage');
+  CALL validate_term(p_term_id, p_name, p_start_date, p_end_date, p_enrollment_opens, p_enrollment_closes, p_grades_due);
+
+  INSERT INTO terms (id, name, start_date, end_date, enrollment_opens, enrollment_closes, grades_due)
+  VALUES (p_term_id, btrim(p_name), p_start_date, p_end_date, p_enrollment_opens, p_enrollment_closes, p_grades_due);
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Term with ID or name already exists';
+END;
+$$;
+
+-- The ID can not change, enrollments and grades refer to it. Moving a deadline reopens or closes the window right away.
+CREATE OR REPLACE PROCEDURE update_term(
+  p_term_id INT,
+  p_name VARCHAR,
+  p_start_date DATE,
+  p_end_date DATE,
+  p_enrollment_opens DATE,
+  p_enrollment_closes DATE,
+  p_grades_due DATE,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'terms:manage');
+  CALL validate_term(p_term_id, p_name, p_start_date, p_end_date, p_enrollment_opens, p_enrollment_closes, p_grades_due);
+
+  UPDATE terms
+  SET name = btrim(p_name),
+    start_date = p_start_date,
+    end_date = p_end_date,
+    enrollment_opens = p_enrollment_opens,
+    enrollment_closes = p_enrollment_closes,
+    grades_due = p_grades_due
+  WHERE id = p_term_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Term not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Term with ID or name already exists';
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_term(
+  p_term_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'terms:manage');
+
+  DELETE FROM terms WHERE id = p_term_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Term not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN foreign_key_violation THEN
+    RAISE EXCEPTION 'Term has enrollments or grades';
+END;
+$$;
+
+-- Raise unless today is within the enrollment window of the term. Both errors carry their own SQLSTATE so they
+-- pass through the WHEN OTHERS handlers of the callers.
+CREATE OR REPLACE PROCEDURE require_enrollment_open(
+  p_term_id INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_term terms;
+BEGIN
+  SELECT * INTO v_term FROM terms WHERE id = p_term_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid term ID' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  IF CURRENT_DATE NOT BETWEEN v_term.enrollment_opens AND v_term.enrollment_closes THEN
+    RAISE EXCEPTION 'Enrollment for % is open from % to %', v_term.name, v_term.enrollment_opens, v_term.enrollment_closes
+      USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+END;
+$$;
+
+-- Raise unless today is within the grade submission window of the term, see require_enrollment_open
+CREATE OR REPLACE PROCEDURE require_grading_open(
+  p_term_id INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_term terms;
+BEGIN
+  SELECT * INTO v_term FROM terms WHERE id = p_term_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid term ID' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  IF CURRENT_DATE NOT BETWEEN v_term.start_date AND v_term.grades_due THEN
+    RAISE EXCEPTION 'Grades for % are accepted from % to %', v_term.name, v_term.start_date, v_term.grades_due
+      USING ERRCODE = 'object_not_in_prerequisite_state';
+  END IF;
+END;
+$$;
+
+-- Sections filtered by course and term, or only p_section_id, with their number of enrolled and waitlisted students
+CREATE OR REPLACE FUNCTION get_course_sections(
+  p_course_id INT DEFAULT NULL,
+  p_term_id INT DEFAULT NULL,
+  p_section_id INT DEFAULT NULL
+)
+RETURNS TABLE (
+  id INT,
+  course_id INT,
+  term_id INT,
+  section_number VARCHAR,
+  instructor_id INT,
+  capacity INT,
+  room VARCHAR,
+  meeting_times VARCHAR,
+  enrolled INT,
+  waitlisted INT
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  SELECT
+    cs.id,
+    cs.course_id,
+    cs.term_id,
+    cs.section_number,
+    cs.instructor_id,
+    cs.capacity,
+    cs.room,
+    cs.meeting_times,
+    (SELECT COUNT(*) FROM enrollments e WHERE e.section_id = cs.id)::INT,
+    (SELECT COUNT(*) FROM section_waitlist w WHERE w.section_id = cs.id)::INT
+  FROM course_sections cs
+  WHERE (p_course_id IS NULL OR cs.course_id = p_course_id)
+    AND (p_term_id IS NULL OR cs.term_id = p_term_id)
+    AND (p_section_id IS NULL OR cs.id = p_section_id)
+  ORDER BY cs.term_id, cs.course_id, cs.section_number;
+
+  IF NOT FOUND AND p_section_id IS NOT NULL THEN
+    RAISE EXCEPTION 'Section not found';
+  END IF;
+END;
+$$;
+
+-- Checks shared by create_course_section and update_course_section
+CREATE OR REPLACE PROCEDURE validate_course_section(
+  p_section_number VARCHAR,
+  p_instructor_id INT,
+  p_capacity INT
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_section_number IS NULL OR btrim(p_section_number) = '' THEN
+    RAISE EXCEPTION 'Section number is required';
+  END IF;
+
+  IF p_capacity IS NULL OR p_capacity <= 0 THEN
+    RAISE EXCEPTION 'Positive capacity is required';
+  END IF;
+
+  IF p_instructor_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM faculty WHERE id = p_instructor_id AND active) THEN
+    RAISE EXCEPTION 'Faculty not found';
+  END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_course_section(
+  p_course_id INT,
+  p_term_id INT,
+  p_section_number VARCHAR,
+  p_instructor_id INT,
+  p_capacity INT,
+  p_room VARCHAR,
+  p_meeting_times VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_section_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+
+  IF NOT EXISTS (SELECT 1 FROM courses WHERE id = p_course_id) THEN
+    RAISE EXCEPTION 'Course not found';
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM terms WHERE id = p_term_id) THEN
+    RAISE EXCEPTION 'Invalid term ID';
+  END IF;
+  CALL validate_course_section(p_section_number, p_instructor_id, p_capacity);
+
+  INSERT INTO course_sections (course_id, term_id, section_number, instructor_id, capacity, room, meeting_times)
+  VALUES (p_course_id, p_term_id, btrim(p_section_number), p_instructor_id, p_capacity, COALESCE(p_room, ''), COALESCE(p_meeting_times, ''))
+  RETURNING id INTO v_section_id;
+
+  RETURN v_section_id;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Section already exists for this course and term';
+END;
+$$;
+
+-- Course and term of a section can not change. Lowering the capacity keeps the enrolled students, raising it
+-- promotes waitlisted students right away.
+CREATE OR REPLACE PROCEDURE update_course_section(
+  p_section_id INT,
+  p_section_number VARCHAR,
+  p_instructor_id INT,
+  p_capacity INT,
+  p_room VARCHAR,
+  p_meeting_times VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:write');
+  CALL validate_course_section(p_section_number, p_instructor_id, p_capacity);
+
+  UPDATE course_sections
+  SET section_number = btrim(p_section_number),
+    instructor_id = p_instructor_id,
+    capacity = p_capacity,
+    room = COALESCE(p_room, ''),
+    meeting_times = COALESCE(p_meeting_times, '')
+  WHERE id = p_section_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Section not found';
+  END IF;
+
+  CALL fill_section_from_waitlist(p_section_id);
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Section already exists for this course and term';
+END;
+$$;
+
+-- The waitlist of the section is deleted with it
+CREATE OR REPLACE PROCEDURE delete_course_section(
+  p_section_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'courses:delete');
+
+  DELETE FROM course_sections WHERE id = p_section_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Section not found';
+  END IF;
+
+EXCEPTION
+  WHEN foreign_key_violation THEN
+    RAISE EXCEPTION 'Section has enrollments';
+END;
+$$;
+
+-- 1 based position of a waitlist entry within its section
+CREATE OR REPLACE FUNCTION waitlist_position(
+  p_waitlist_id INT
+)
+RETURNS INT
+LANGUAGE sql
+AS $$
+  SELECT COUNT(*)::INT
+  FROM section_waitlist w
+  JOIN section_waitlist me ON me.section_id = w.section_id
+  WHERE me.id = p_waitlist_id AND (w.created_at, w.id) <= (me.created_at, me.id);
+$$;
+
+-- Enroll waitlisted students into the free seats of a section in waitlist order, the caller must hold a lock on the
+-- section row. Only while the enrollment window of the term is open, afterwards the waitlist is left as it is.
+CREATE OR REPLACE PROCEDURE fill_section_from_waitlist(
+  p_section_id INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_section course_sections;
+  v_entry section_waitlist;
+  v_free INT;
+BEGIN
+  SELECT * INTO v_section FROM course_sections WHERE id = p_section_id;
+
+  IF NOT EXISTS (
+    SELECT 1 FROM terms t WHERE t.id = v_section.term_id AND CURRENT_DATE BETWEEN t.enrollment_opens AND t.enrollment_closes
+  ) THEN
+    RETURN;
+  END IF;
+
+  v_free := v_section.capacity - (SELECT COUNT(*) FROM enrollments WHERE section_id = p_section_id);
+
+  FOR v_entry IN
+    SELECT * FROM section_waitlist WHERE section_id = p_section_id ORDER BY created_at, id
+  LOOP
+    EXIT WHEN v_free <= 0;
+
+    DELETE FROM section_waitlist WHERE id = v_entry.id;
+
+    -- Students enrolled into another section of the course meanwhile just leave the waitlist
+    CONTINUE WHEN EXISTS (
+      SELECT 1 FROM enrollments
+      WHERE student_id = v_entry.student_id AND course_id = v_section.course_id AND term_id = v_section.term_id
+    );
+
+    INSERT INTO enrollments (student_id, course_id, term_id, section_id)
+    VALUES (v_entry.student_id, v_section.course_id, v_section.term_id, p_section_id);
+
+    DELETE FROM section_waitlist w
+    USING course_sections cs
+    WHERE w.section_id = cs.id AND cs.course_id = v_section.course_id AND cs.term_id = v_section.term_id
+      AND w.student_id = v_entry.student_id;
+
+    v_free := v_free - 1;
+  END LOOP;
+END;
+$$;
+
+-- Enrolls into p_section_id when given, taking course and term from it; a course with sections in the term can only
+-- be enrolled into through one of them. A full section puts the student on its waitlist instead, then v_id and v_date
+-- are NULL and v_waitlist_id and v_waitlist_position are set.
+-- Unmet prerequisites raise 'Prerequisites not met' with the JSON array of get_unmet_prerequisites as DETAIL, unless
+-- p_override_prerequisites is set by a user holding prerequisites:override. Every override is kept in prerequisite_overrides.
+CREATE OR REPLACE FUNCTION create_enrollment(
+  p_student_id INT,
+  p_course_id INT,
+  p_term_id INT,
+  p_section_id INT,
+  p_override_prerequisites BOOLEAN,
+  p_override_reason TEXT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  v_id INT,
+  v_date DATE,
+  v_waitlist_id INT,
+  v_waitlist_position INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_enrollment_id INT;
+  v_enrollment_date DATE;
+  v_student_exists BOOLEAN;
+  v_course_exists BOOLEAN;
+  v_section course_sections;
+  v_entry_id INT;
+  v_unmet JSONB;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'enrollments:write');
+
+  IF p_section_id IS NOT NULL AND p_section_id <> 0 THEN
+    -- Serializes enrollments into the section, so the seat count below stays valid until commit
+    SELECT * INTO v_section FROM course_sections WHERE id = p_section_id FOR UPDATE;
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'Invalid section ID';
+    END IF;
+    IF (p_course_id IS NOT NULL AND p_course_id <> 0 AND p_course_id <> v_section.course_id)
+      OR (p_term_id IS NOT NULL AND p_term_id <> 0 AND p_term_id <> v_section.term_id) THEN
+      RAISE EXCEPTION 'Section does not belong to the course and term';
+    END IF;
+    p_course_id := v_section.course_id;
+    p_term_id := v_section.term_id;
+  END IF;
+
+  IF p_student_id IS NULL OR p_student_id = 0 OR p_course_id IS NULL OR p_course_id = 0 THEN
+    RAISE EXCEPTION 'Student ID and Course ID are required';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  SELECT EXISTS(SELECT 1 FROM courses WHERE id = p_course_id) INTO v_course_exists;
+
+  IF NOT v_student_exists OR NOT v_course_exists THEN
+    RAISE EXCEPTION 'Invalid student ID or course ID';
+  END IF;
+
+  CALL require_enrollment_open(p_term_id);
+
+  IF v_section.id IS NULL AND EXISTS (SELECT 1 FROM course_sections WHERE course_id = p_course_id AND term_id = p_term_id) THEN
+    RAISE EXCEPTION 'Section ID is required for this course';
+  END IF;
+
+  IF EXISTS (SELECT 1 FROM enrollments WHERE student_id = p_student_id AND course_id = p_course_id AND term_id = p_term_id) THEN
+    RAISE EXCEPTION 'Student is already enrolled in this course';
+  END IF;
+
+  SELECT jsonb_agg(jsonb_build_object(
+      'group', u.group_number,
+      'required_course_id', u.required_course_id,
+      'required_course_code', u.required_course_code,
+      'min_grade', u.min_grade,
+      'corequisite', u.is_corequisite
+    ))
+  INTO v_unmet
+  FROM get_unmet_prerequisites(p_student_id, p_course_id, p_term_id) u;
+
+  IF v_unmet IS NOT NULL THEN
+    IF NOT COALESCE(p_override_prerequisites, FALSE) THEN
+      RAISE EXCEPTION 'Prerequisites not met' USING DETAIL = v_unmet::TEXT;
+    END IF;
+    CALL require_permission(p_user_id, p_user_role, 'prerequisites:override');
+  END IF;
+
+  IF v_section.id IS NOT NULL AND (SELECT COUNT(*) FROM enrollments WHERE section_id = v_section.id) >= v_section.capacity THEN
+    IF EXISTS (SELECT 1 FROM section_waitlist WHERE section_id = v_section.id AND student_id = p_student_id) THEN
+      RAISE EXCEPTION 'Student is already on the waitlist of this section';
+    END IF;
+
+    INSERT INTO section_waitlist (section_id, student_id)
+    VALUES (v_section.id, p_student_id)
+    RETURNING id INTO v_entry_id;
+
+    -- Promotion from the waitlist does not check prerequisites again
+    IF v_unmet IS NOT NULL THEN
+      INSERT INTO prerequisite_overrides (student_id, course_id, term_id, unmet, reason, overridden_by)
+      VALUES (p_student_id, p_course_id, p_term_id, v_unmet, COALESCE(p_override_reason, ''), p_user_id);
+    END IF;
+
+    RETURN QUERY SELECT NULL::INT, NULL::DATE, v_entry_id, waitlist_position(v_entry_id);
+    RETURN;
+  END IF;
+
+  INSERT INTO enrollments (student_id, course_id, term_id, section_id)
+  VALUES (p_student_id, p_course_id, p_term_id, v_section.id)
+  RETURNING id, enrollment_date INTO v_enrollment_id, v_enrollment_date;
+
+  IF v_unmet IS NOT NULL THEN
+    INSERT INTO prerequisite_overrides (student_id, course_id, term_id, enrollment_id, unmet, reason, overridden_by)
+    VALUES (p_student_id, p_course_id, p_term_id, v_enrollment_id, v_unmet, COALESCE(p_override_reason, ''), p_user_id);
+  END IF;
+
+  -- A seat in one section ends waiting for the others
+  DELETE FROM section_waitlist w
+  USING course_sections cs
+  WHERE w.section_id = cs.id AND cs.course_id = p_course_id AND cs.term_id = p_term_id AND w.student_id = p_student_id;
+
+  RETURN QUERY SELECT v_enrollment_id, v_enrollment_date, NULL::INT, NULL::INT;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Student is already enrolled in this course';
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_enrollments(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_filter_student_id INT DEFAULT NULL
+)
+RETURNS SETOF enrollments
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    IF p_filter_student_id IS NOT NULL THEN
+      RETURN QUERY SELECT * FROM enrollments WHERE student_id = p_filter_student_id;
+    ELSE
+      RETURN QUERY SELECT * FROM enrollments;
+    END IF;
+  ELSIF p_user_role = 'student' THEN
+    RETURN QUERY SELECT * FROM enrollments WHERE student_id = p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+-- Keyset paginated enrollment list, see get_students_page
+CREATE OR REPLACE FUNCTION get_enrollments_page(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_filter_student_id INT,
+  p_course_id INT,
+  p_term_id INT,
+  p_section_id INT,
+  p_enrolled_from DATE,
+  p_enrolled_to DATE,
+  p_sort VARCHAR,
+  p_descending BOOLEAN,
+  p_after_value TEXT,
+  p_after_id INT,
+  p_limit INT
+)
+RETURNS TABLE (
+  id INT,
+  student_id INT,
+  course_id INT,
+  term_id INT,
+  section_id INT,
+  enrollment_date DATE,
+  sort_value TEXT,
+  total_count BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_sort_key TEXT;
+  v_sort_type TEXT;
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    NULL;
+  ELSIF p_user_role = 'student' THEN
+    p_filter_student_id := p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  CASE p_sort
+    WHEN 'id' THEN v_sort_key := 'e.id'; v_sort_type := 'INT';
+    WHEN 'enrollment_date' THEN v_sort_key := 'e.enrollment_date'; v_sort_type := 'DATE';
+    WHEN 'student_id' THEN v_sort_key := 'e.student_id'; v_sort_type := 'INT';
+    WHEN 'course_id' THEN v_sort_key := 'e.course_id'; v_sort_type := 'INT';
+    WHEN 'term_id' THEN v_sort_key := 'e.term_id'; v_sort_type := 'INT';
+    ELSE RAISE EXCEPTION 'Invalid sort field';
+  END CASE;
+
+  RETURN QUERY EXECUTE format($query$
+    SELECT f.id, f.student_id, f.course_id, f.term_id, f.section_id, f.enrollment_date, f.sort_key::TEXT, f.total_count
+    FROM (
+      SELECT e.*, %1$s AS sort_key, count(*) OVER () AS total_count
+      FROM enrollments e
+      WHERE ($1::INT IS NULL OR e.student_id = $1)
+        AND ($2::INT IS NULL OR e.course_id = $2)
+        AND ($3::INT IS NULL OR e.term_id = $3)
+        AND ($4::INT IS NULL OR e.section_id = $4)
+        AND ($5::DATE IS NULL OR e.enrollment_date >= $5)
+        AND ($6::DATE IS NULL OR e.enrollment_date <= $6)
+    ) f
+    WHERE $7::TEXT IS NULL OR (f.sort_key, f.id) %3$s (CAST($7 AS %2$s), $8)
+    ORDER BY f.sort_key %4$s, f.id %4$s
+    LIMIT $9
+  $query$, v_sort_key, v_sort_type, CASE WHEN p_descending THEN '<' ELSE '>' END, CASE WHEN p_descending THEN 'DESC' ELSE 'ASC' END)
+  USING p_filter_student_id, p_course_id, p_term_id, p_section_id, p_enrolled_from, p_enrolled_to, p_after_value, p_after_id, p_limit;
+
+EXCEPTION
+  WHEN data_exception THEN
+    RAISE EXCEPTION 'Invalid cursor';
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_enrollment_by_id(
+  p_enrollment_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF enrollments
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_id INT;
+  v_enrollment enrollments;
+BEGIN
+  SELECT * INTO v_enrollment FROM enrollments WHERE id = p_enrollment_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Enrollment not found';
+  END IF;
+
+  IF NOT (p_user_role = 'student' AND v_enrollment.student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own enrollments.';
+  END IF;
+
+  RETURN NEXT v_enrollment;
+END;
+$$;
+
+-- The seat freed in a section goes to the next waitlisted student in the same transaction
+CREATE OR REPLACE PROCEDURE delete_enrollment(
+  p_enrollment_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_section_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'enrollments:delete');
+
+  SELECT section_id INTO v_section_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Enrollment not found';
+  END IF;
+
+  IF v_section_id IS NOT NULL THEN
+    -- Same lock as create_enrollment, so a concurrent enrollment can not take the seat twice
+    PERFORM 1 FROM course_sections WHERE id = v_section_id FOR UPDATE;
+  END IF;
+
+  DELETE FROM enrollments WHERE id = p_enrollment_id;
+
+  IF v_section_id IS NOT NULL THEN
+    CALL fill_section_from_waitlist(v_section_id);
+  END IF;
+END;
+$$;
+
+-- Waitlist of a section in order
+CREATE OR REPLACE FUNCTION get_section_waitlist(
+  p_section_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  student_id INT,
+  section_id INT,
+  course_id INT,
+  term_id INT,
+  section_number VARCHAR,
+  waitlist_position INT,
+  created_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  IF NOT has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM course_sections cs WHERE cs.id = p_section_id) THEN
+    RAISE EXCEPTION 'Section not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT w.id, w.student_id, w.section_id, cs.course_id, cs.term_id, cs.section_number,
+    (row_number() OVER (ORDER BY w.created_at, w.id))::INT, w.created_at
+  FROM section_waitlist w
+  JOIN course_sections cs ON cs.id = w.section_id
+  WHERE w.section_id = p_section_id
+  ORDER BY w.created_at, w.id;
+END;
+$$;
+
+-- Waitlist entries of a student with their position in each section
+CREATE OR REPLACE FUNCTION get_student_waitlist(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  student_id INT,
+  section_id INT,
+  course_id INT,
+  term_id INT,
+  section_number VARCHAR,
+  waitlist_position INT,
+  created_at TIMESTAMPTZ
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'enrollments:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own enrollments.';
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM students s WHERE s.id = p_student_id) THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT w.id, w.student_id, w.section_id, cs.course_id, cs.term_id, cs.section_number,
+    waitlist_position(w.id), w.created_at
+  FROM section_waitlist w
+  JOIN course_sections cs ON cs.id = w.section_id
+  WHERE w.student_id = p_student_id
+  ORDER BY cs.term_id, cs.course_id, cs.section_number;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_waitlist_entry(
+  p_waitlist_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'enrollments:delete');
+
+  DELETE FROM section_waitlist WHERE id = p_waitlist_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Waitlist entry not found';
+  END IF;
+END;
+$$;
+
+-- Grading scale used for an enrollment: the course's scale, else the scale of the student's program, else the default scale
+CREATE OR REPLACE FUNCTION enrollment_grading_scale(
+  p_enrollment_id INT
+)
+RETURNS INT
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT COALESCE(
+    c.grading_scale_id,
+    (SELECT pgs.scale_id FROM program_grading_scales pgs WHERE pgs.program = s.program),
+    (SELECT gs.id FROM grading_scales gs WHERE gs.is_default)
+  )
+  FROM enrollments e
+  JOIN courses c ON e.course_id = c.id
+  JOIN students s ON e.student_id = s.id
+  WHERE e.id = p_enrollment_id;
+$$;
+
+-- Grading scale a student's GPA is expressed in: the scale of their program, else the default scale
+CREATE OR REPLACE FUNCTION student_grading_scale(
+  p_student_id INT
+)
+RETURNS INT
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT COALESCE(
+    (SELECT pgs.scale_id FROM program_grading_scales pgs JOIN students s ON s.program = pgs.program WHERE s.id = p_student_id),
+    (SELECT gs.id FROM grading_scales gs WHERE gs.is_default)
+  );
+$$;
+
+-- Highest graded mark of the scale whose points do not exceed p_points
+CREATE OR REPLACE FUNCTION points_to_mark(
+  p_scale_id INT,
+  p_points DECIMAL
+)
+RETURNS VARCHAR
+LANGUAGE sql
+STABLE
+AS $$
+  SELECT m.mark
+  FROM grading_scale_marks m
+  WHERE m.scale_id = p_scale_id AND m.kind = 'graded' AND m.points <= p_points
+  ORDER BY m.points DESC
+  LIMIT 1;
+$$;
+
+-- Grade points, mark and mark kind to store for a grade given as a mark, as points, or both (they must agree).
+-- Without either the enrollment is not graded yet. Invalid grades raise invalid_parameter_value.
+CREATE OR REPLACE FUNCTION resolve_grade(
+  p_enrollment_id INT,
+  p_grade DECIMAL,
+  p_mark VARCHAR
+)
+RETURNS TABLE (
+  grade DECIMAL(4, 2),
+  mark VARCHAR,
+  mark_kind VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+  v_scale_id INT;
+  v_mark grading_scale_marks;
+  v_max_points DECIMAL(4, 2);
+BEGIN
+  IF p_grade IS NULL AND (p_mark IS NULL OR btrim(p_mark) = '') THEN
+    RETURN QUERY SELECT NULL::DECIMAL(4, 2), NULL::VARCHAR, NULL::VARCHAR;
+    RETURN;
+  END IF;
+
+  v_scale_id := enrollment_grading_scale(p_enrollment_id);
+
+  IF p_mark IS NOT NULL AND btrim(p_mark) <> '' THEN
+    SELECT * INTO v_mark FROM grading_scale_marks m WHERE m.scale_id = v_scale_id AND m.mark = upper(btrim(p_mark));
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'Invalid mark' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+    IF p_grade IS NOT NULL AND (v_mark.points IS NULL OR v_mark.points <> p_grade) THEN
+      RAISE EXCEPTION 'Grade does not match mark' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+    RETURN QUERY SELECT v_mark.points, v_mark.mark, v_mark.kind;
+    RETURN;
+  END IF;
+
+  -- Without any scale numeric grades are stored as given
+  IF v_scale_id IS NULL THEN
+    RETURN QUERY SELECT p_grade::DECIMAL(4, 2), NULL::VARCHAR, 'graded'::VARCHAR;
+    RETURN;
+  END IF;
+
+  SELECT MAX(m.points) INTO v_max_points FROM grading_scale_marks m WHERE m.scale_id = v_scale_id;
+  IF p_grade < 0 OR p_grade > v_max_points THEN
+    RAISE EXCEPTION 'Grade is out of range for the grading scale' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  RETURN QUERY SELECT p_grade::DECIMAL(4, 2), points_to_mark(v_scale_id, p_grade), 'graded'::VARCHAR;
+END;
+$$;
+
+-- All scales, or only p_scale_id
+CREATE OR REPLACE FUNCTION get_grading_scales(
+  p_scale_id INT DEFAULT NULL
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  is_default BOOLEAN,
+  programs VARCHAR[],
+  marks JSONB
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  SELECT
+    gs.id,
+    gs.name,
+    gs.is_default,
+    COALESCE((SELECT array_agg(pgs.program ORDER BY pgs.program) FROM program_grading_scales pgs WHERE pgs.scale_id = gs.id), '{}'),
+    COALESCE((
+      SELECT jsonb_agg(jsonb_build_object('mark', m.mark, 'description', m.description, 'points', m.points, 'kind', m.kind)
+        ORDER BY m.points DESC NULLS LAST, m.mark)
+      FROM grading_scale_marks m WHERE m.scale_id = gs.id
+    ), '[]')
+  FROM grading_scales gs
+  WHERE p_scale_id IS NULL OR gs.id = p_scale_id
+  ORDER BY gs.id;
+
+  IF NOT FOUND AND p_scale_id IS NOT NULL THEN
+    RAISE EXCEPTION 'Grading scale not found';
+  END IF;
+END;
+$$;
+
+-- Replace the marks and programs of a scale, p_marks is a JSON array of {mark, description, points, kind}.
+-- Programs assigned to another scale are moved to this one.
+CREATE OR REPLACE PROCEDURE store_grading_scale(
+  p_scale_id INT,
+  p_is_default BOOLEAN,
+  p_programs VARCHAR[],
+  p_marks JSONB
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_marks IS NULL OR jsonb_typeof(p_marks) <> 'array' THEN
+    RAISE EXCEPTION 'Invalid mark definition';
+  END IF;
+
+  IF EXISTS (
+    SELECT 1 FROM jsonb_to_recordset(p_marks) AS x(mark VARCHAR, points DECIMAL, kind VARCHAR)
+    WHERE x.mark IS NULL OR btrim(x.mark) = '' OR length(btrim(x.mark)) > 10
+      OR x.kind IS NULL OR x.kind NOT IN ('graded', 'pass', 'fail', 'incomplete', 'withdrawn')
+      OR (x.kind = 'graded') <> (x.points IS NOT NULL) OR x.points < 0 OR x.points >= 100
+  ) THEN
+    RAISE EXCEPTION 'Invalid mark definition';
+  END IF;
+
+  IF (SELECT COUNT(DISTINCT upper(btrim(x.mark))) FROM jsonb_to_recordset(p_marks) AS x(mark VARCHAR)) <> jsonb_array_length(p_marks) THEN
+    RAISE EXCEPTION 'Duplicate mark in grading scale';
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM jsonb_to_recordset(p_marks) AS x(kind VARCHAR) WHERE x.kind = 'graded') THEN
+    RAISE EXCEPTION 'Grading scale needs at least one graded mark';
+  END IF;
+
+  DELETE FROM grading_scale_marks WHERE scale_id = p_scale_id;
+  INSERT INTO grading_scale_marks (scale_id, mark, description, points, kind)
+  SELECT p_scale_id, upper(btrim(x.mark)), COALESCE(x.description, ''), x.points, x.kind
+  FROM jsonb_to_recordset(p_marks) AS x(mark VARCHAR, description VARCHAR, points DECIMAL, kind VARCHAR);
+
+  DELETE FROM program_grading_scales WHERE scale_id = p_scale_id;
+  INSERT INTO program_grading_scales (program, scale_id)
+  SELECT DISTINCT p, p_scale_id FROM unnest(COALESCE(p_programs, '{}')) AS p WHERE btrim(p) <> ''
+  ON CONFLICT (program) DO UPDATE SET scale_id = EXCLUDED.scale_id;
+
+  IF p_is_default THEN
+    UPDATE grading_scales SET is_default = FALSE WHERE is_default AND id <> p_scale_id;
+  END IF;
+  UPDATE grading_scales SET is_default = COALESCE(p_is_default, FALSE) WHERE id = p_scale_id;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION create_grading_scale(
+  p_name VARCHAR,
+  p_is_default BOOLEAN,
+  p_programs VARCHAR[],
+  p_marks JSONB,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_scale_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grading_scales:manage');
+
+  IF p_name IS NULL OR btrim(p_name) = '' THEN
+    RAISE EXCEPTION 'Grading scale name is required';
+  END IF;
+
+  INSERT INTO grading_scales (name) VALUES (btrim(p_name)) RETURNING id INTO v_scale_id;
+  CALL store_grading_scale(v_scale_id, p_is_default, p_programs, p_marks);
+
+  RETURN v_scale_id;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grading scale with name already exists';
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_grading_scale(
+  p_scale_id INT,
+  p_name VARCHAR,
+  p_is_default BOOLEAN,
+  p_programs VARCHAR[],
+  p_marks JSONB,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grading_scales:manage');
+
+  IF p_name IS NULL OR btrim(p_name) = '' THEN
+    RAISE EXCEPTION 'Grading scale name is required';
+  END IF;
+
+  UPDATE grading_scales SET name = btrim(p_name) WHERE id = p_scale_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grading scale not found';
+  END IF;
+
+  CALL store_grading_scale(p_scale_id, p_is_default, p_programs, p_marks);
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grading scale with name already exists';
+END;
+$$;
+
+-- Courses using the scale fall back to the program or default scale, existing grades keep their marks
+CREATE OR REPLACE PROCEDURE delete_grading_scale(
+  p_scale_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_is_default BOOLEAN;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grading_scales:manage');
+
+  SELECT is_default INTO v_is_default FROM grading_scales WHERE id = p_scale_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grading scale not found';
+  END IF;
+  IF v_is_default THEN
+    RAISE EXCEPTION 'The default grading scale can not be deleted';
+  END IF;
+
+  DELETE FROM grading_scales WHERE id = p_scale_id;
+END;
+$$;
+
+-- p_semester is the term the grade is given in, NULL uses the term of the enrollment
+
+CREATE OR REPLACE FUNCTION add_grade(
+  p_enrollment_id INT,
+  p_grade DECIMAL(4, 2),
+  p_mark VARCHAR,
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_grade_id INT;
+  v_enrollment_term_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grades:write');
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID is required';
+  END IF;
+
+  SELECT term_id INTO v_enrollment_term_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  CALL require_course_instructor(p_enrollment_id, p_user_id, p_user_role);
+
+  p_semester := COALESCE(NULLIF(p_semester, 0), v_enrollment_term_id);
+  IF p_semester < v_enrollment_term_id THEN
+    RAISE EXCEPTION 'Grade can not be given before the term of the enrollment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  CALL require_grading_open(p_semester);
+
+  INSERT INTO grades (enrollment_id, grade, mark, mark_kind, semester)
+  SELECT p_enrollment_id, r.grade, r.mark, r.mark_kind, p_semester
+  FROM resolve_grade(p_enrollment_id, p_grade, p_mark) r
+  RETURNING id INTO v_grade_id;
+
+  RETURN v_grade_id;
+
+EXCEPTION
+  WHEN insufficient_privilege OR invalid_parameter_value OR object_not_in_prerequisite_state THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to add grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_all_grades(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF grades
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'grades:read') THEN
+    RETURN QUERY SELECT * FROM grades;
+  ELSIF p_user_role = 'student' THEN
+    RETURN QUERY
+    SELECT g.*
+    FROM grades g
+    JOIN enrollments e ON g.enrollment_id = e.id
+    WHERE e.student_id = p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+END;
+$$;
+
+-- Keyset paginated grade list, see get_students_page. Ungraded rows and special marks sort before all grades.
+CREATE OR REPLACE FUNCTION get_grades_page(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_semester INT,
+  p_min_grade DECIMAL(4, 2),
+  p_max_grade DECIMAL(4, 2),
+  p_sort VARCHAR,
+  p_descending BOOLEAN,
+  p_after_value TEXT,
+  p_after_id INT,
+  p_limit INT
+)
+RETURNS TABLE (
+  id INT,
+  enrollment_id INT,
+  grade DECIMAL(4, 2),
+  mark VARCHAR,
+  semester INT,
+  sort_value TEXT,
+  total_count BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_own_id INT;
+  v_sort_key TEXT;
+  v_sort_type TEXT;
+BEGIN
+  IF has_permission(p_user_id, p_user_role, 'grades:read') THEN
+    v_own_id := NULL;
+  ELSIF p_user_role = 'student' THEN
+    v_own_id := p_user_id;
+  ELSE
+    RAISE EXCEPTION 'Access denied. Invalid user role.';
+  END IF;
+
+  CASE p_sort
+    WHEN 'id' THEN v_sort_key := 'g.id'; v_sort_type := 'INT';
+    WHEN 'semester' THEN v_sort_key := 'g.semester'; v_sort_type := 'INT';
+    WHEN 'grade' THEN v_sort_key := 'COALESCE(g.grade, -1)'; v_sort_type := 'DECIMAL';
+    WHEN 'enrollment_id' THEN v_sort_key := 'g.enrollment_id'; v_sort_type := 'INT';
+    ELSE RAISE EXCEPTION 'Invalid sort field';
+  END CASE;
+
+  RETURN QUERY EXECUTE format($query$
+    SELECT f.id, f.enrollment_id, f.grade, f.mark, f.semester, f.sort_key::TEXT, f.total_count
+    FROM (
+      SELECT g.*, %1$s AS sort_key, count(*) OVER () AS total_count
+      FROM grades g
+      WHERE ($1::INT IS NULL OR EXISTS (SELECT 1 FROM enrollments e WHERE e.id = g.enrollment_id AND e.student_id = $1))
+        AND ($2::INT IS NULL OR g.semester = $2)
+        AND ($3::DECIMAL IS NULL OR g.grade >= $3)
+        AND ($4::DECIMAL IS NULL OR g.grade <= $4)
+    ) f
+    WHERE $5::TEXT IS NULL OR (f.sort_key, f.id) %3$s (CAST($5 AS %2$s), $6)
+    ORDER BY f.sort_key %4$s, f.id %4$s
+    LIMIT $7
+  $query$, v_sort_key, v_sort_type, CASE WHEN p_descending THEN '<' ELSE '>' END, CASE WHEN p_descending THEN 'DESC' ELSE 'ASC' END)
+  USING v_own_id, p_semester, p_min_grade, p_max_grade, p_after_value, p_after_id, p_limit;
+
+EXCEPTION
+  WHEN data_exception THEN
+    RAISE EXCEPTION 'Invalid cursor';
+END;
+$$;
+
+-- Corrected function definition (removed duplicate OR)
+CREATE OR REPLACE FUNCTION get_grade_by_id(
+  p_grade_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS SETOF grades
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_grade grades;
+  v_enrollment_student_id INT;
+BEGIN
+  SELECT * INTO v_grade FROM grades WHERE id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+  IF NOT has_permission(p_user_id, p_user_role, 'grades:read') THEN
+    SELECT student_id INTO v_enrollment_student_id FROM enrollments WHERE id = v_grade.enrollment_id;
+    IF NOT FOUND THEN
+     RAISE EXCEPTION 'Internal error: Enrollment not found for grade.';
+    END IF;
+    IF p_user_role != 'student' OR v_enrollment_student_id != p_user_id THEN
+     RAISE EXCEPTION 'Access denied. Students can only view grades for their own enrollments.';
+    END IF;
+  END IF;
+
+  RETURN NEXT v_grade;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_grade(
+  p_grade_id INT,
+  p_enrollment_id INT,
+  p_grade DECIMAL(4, 2),
+  p_mark VARCHAR,
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+   v_enrollment_term_id INT;
+   v_current_enrollment_id INT;
+   v_current_semester INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grades:write');
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID is required';
+  END IF;
+
+  SELECT term_id INTO v_enrollment_term_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  SELECT enrollment_id, semester INTO v_current_enrollment_id, v_current_semester FROM grades WHERE id = p_grade_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+  -- Both the enrollment the grade belongs to and the one it is moved to must be taught by the user
+  CALL require_course_instructor(v_current_enrollment_id, p_user_id, p_user_role);
+  CALL require_course_instructor(p_enrollment_id, p_user_id, p_user_role);
+
+  -- Likewise the grading windows of both the current and the new term must be open
+  p_semester := COALESCE(NULLIF(p_semester, 0), v_enrollment_term_id);
+  IF p_semester < v_enrollment_term_id THEN
+    RAISE EXCEPTION 'Grade can not be given before the term of the enrollment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  CALL require_grading_open(v_current_semester);
+  CALL require_grading_open(p_semester);
+
+  UPDATE grades
+  SET enrollment_id = p_enrollment_id,
+    grade = r.grade,
+    mark = r.mark,
+    mark_kind = r.mark_kind,
+    semester = p_semester
+  FROM resolve_grade(p_enrollment_id, p_grade, p_mark) r
+  WHERE grades.id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege OR invalid_parameter_value OR object_not_in_prerequisite_state THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE delete_grade(
+  p_grade_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_enrollment_id INT;
+  v_semester INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grades:delete');
+
+  SELECT enrollment_id, semester INTO v_enrollment_id, v_semester FROM grades WHERE id = p_grade_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+  CALL require_course_instructor(v_enrollment_id, p_user_id, p_user_role);
+  CALL require_grading_open(v_semester);
+
+  DELETE FROM grades WHERE id = p_grade_id;
+
+EXCEPTION
+  WHEN insufficient_privilege OR object_not_in_prerequisite_state THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to delete grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_student_transcript(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  enrollment_id INT,
+  course_code VARCHAR,
+  course_title VARCHAR,
+  credits DECIMAL(3, 2),
+  grade_id INT,
+  grade DECIMAL(4, 2),
+  mark VARCHAR,
+  semester INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_exists BOOLEAN;
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'transcripts:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own transcript.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  RETURN QUERY
+  SELECT
+    e.id AS enrollment_id,
+    c.code,
+    c.title,
+    c.credits,
+    g.id AS grade_id,
+    g.grade,
+    g.mark,
+    COALESCE(g.semester, e.term_id)
+  FROM
+    enrollments e
+  JOIN
+    courses c ON e.course_id = c.id
+  LEFT JOIN
+    grades g ON e.id = g.enrollment_id
+  WHERE
+    e.student_id = p_student_id
+  ORDER BY
+    COALESCE(g.semester, e.term_id), g.id IS NULL, c.code;
+
+END;
+$$;
+
+-- Grade that counts towards the GPA for each graded course of a student, considering semesters up to p_through_semester (all if NULL).
+-- A course graded in several semesters, in one enrollment or in enrollments of several terms, is a retake.
+-- p_retake_policy picks the 'latest' attempt, the 'best' attempt or the 'average' of all attempts.
+CREATE OR REPLACE FUNCTION student_effective_grades(
+  p_student_id INT,
+  p_retake_policy VARCHAR,
+  p_through_semester INT
+)
+RETURNS TABLE (
+  course_id INT,
+  credits DECIMAL(3, 2),
+  grade DECIMAL
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_retake_policy IS NULL OR p_retake_policy NOT IN ('latest', 'best', 'average') THEN
+    RAISE EXCEPTION 'Invalid retake policy';
+  END IF;
+
+  RETURN QUERY
+  SELECT
+    c.id,
+    c.credits,
+    CASE p_retake_policy
+      WHEN 'latest' THEN (array_agg(g.grade ORDER BY g.semester DESC))[1]
+      WHEN 'best' THEN MAX(g.grade)
+      ELSE AVG(g.grade)
+    END
+  FROM
+    enrollments e
+  JOIN
+    courses c ON e.course_id = c.id
+  JOIN
+    grades g ON e.id = g.enrollment_id
+  WHERE
+    e.student_id = p_student_id AND g.grade IS NOT NULL
+    AND (p_through_semester IS NULL OR g.semester <= p_through_semester)
+  GROUP BY
+    c.id, c.credits;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION calculate_student_gpa(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_retake_policy VARCHAR DEFAULT 'latest'
+)
+RETURNS DECIMAL(4, 2)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_gpa DECIMAL(4, 2);
+  v_student_exists BOOLEAN;
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'transcripts:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only calculate their own GPA.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  SELECT
+    SUM(eg.grade * eg.credits) / NULLIF(SUM(eg.credits), 0)
+  INTO v_gpa
+  FROM
+    student_effective_grades(p_student_id, p_retake_policy, NULL) eg;
+
+  IF v_gpa IS NULL THEN
+    RETURN 0.0;
+  END IF;
+
+  RETURN v_gpa;
+
+EXCEPTION
+  WHEN insufficient_privilege THEN
+    RAISE;
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to calculate GPA: %', SQLERRM;
+END;
+$$;
+
+-- One row per graded semester with the name of its term, including semesters with only special marks. sgpa covers every attempt graded
+-- with points in the semester (NULL without any), credits_attempted also includes pass and fail marks.
+-- A course's credits are earned once, in the first semester it was passed (points above 0 or a pass mark).
+-- cgpa is the GPA over all semesters up to this one under the retake policy, the last row matches calculate_student_gpa.
+-- Marks are the equivalents on the student's grading scale.
+CREATE OR REPLACE FUNCTION get_student_gpa_breakdown(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_retake_policy VARCHAR DEFAULT 'latest'
+)
+RETURNS TABLE (
+  semester INT,
+  term_name VARCHAR,
+  sgpa DECIMAL(4, 2),
+  sgpa_mark VARCHAR,
+  credits_attempted DECIMAL,
+  credits_earned DECIMAL,
+  cgpa DECIMAL(4, 2),
+  cgpa_mark VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+  v_student_exists BOOLEAN;
+  v_scale_id INT;
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'transcripts:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only calculate their own GPA.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  IF p_retake_policy IS NULL OR p_retake_policy NOT IN ('latest', 'best', 'average') THEN
+    RAISE EXCEPTION 'Invalid retake policy';
+  END IF;
+
+  v_scale_id := student_grading_scale(p_student_id);
+
+  RETURN QUERY
+  WITH attempts AS (
+    SELECT c.id AS course_id, c.credits, g.grade, g.mark_kind, g.semester
+    FROM enrollments e
+    JOIN courses c ON e.course_id = c.id
+    JOIN grades g ON e.id = g.enrollment_id
+    WHERE e.student_id = p_student_id AND (g.grade IS NOT NULL OR g.mark IS NOT NULL)
+  ),
+  first_passed AS (
+    SELECT a.course_id, MIN(a.semester) AS passed_semester
+    FROM attempts a
+    WHERE a.grade > 0 OR a.mark_kind = 'pass'
+    GROUP BY a.course_id
+  ),
+  semesters AS (
+    SELECT
+      a.semester,
+      (SUM(a.grade * a.credits) / NULLIF(SUM(a.credits) FILTER (WHERE a.grade IS NOT NULL), 0))::DECIMAL(4, 2) AS sgpa,
+      COALESCE(SUM(a.credits) FILTER (WHERE a.grade IS NOT NULL OR a.mark_kind IN ('pass', 'fail')), 0)::DECIMAL AS credits_attempted,
+      COALESCE(SUM(a.credits) FILTER (WHERE fp.passed_semester = a.semester), 0)::DECIMAL AS credits_earned,
+      (
+        SELECT SUM(eg.grade * eg.credits) / NULLIF(SUM(eg.credits), 0)
+        FROM student_effective_grades(p_student_id, p_retake_policy, a.semester) eg
+      )::DECIMAL(4, 2) AS cgpa
+    FROM
+      attempts a
+    LEFT JOIN
+      first_passed fp ON fp.course_id = a.course_id
+    GROUP BY
+      a.semester
+  )
+  SELECT
+    sm.semester,
+    t.name,
+    sm.sgpa,
+    points_to_mark(v_scale_id, sm.sgpa),
+    sm.credits_attempted,
+    sm.credits_earned,
+    COALESCE(sm.cgpa, 0),
+    points_to_mark(v_scale_id, sm.cgpa)
+  FROM
+    semesters sm
+  JOIN
+    terms t ON t.id = sm.semester
+  ORDER BY
+    sm.semester;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE create_transcript_document(
+  p_id VARCHAR,
+  p_student_id INT,
+  p_payload TEXT,
+  p_signature TEXT,
+  p_key_id VARCHAR,
+  p_pdf_sha256 VARCHAR,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'transcripts:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only view their own transcript.';
+  END IF;
+
+  INSERT INTO transcript_documents (id, student_id, issued_by_id, issued_by_role, payload, signature, key_id, pdf_sha256)
+  VALUES (p_id, p_student_id, p_user_id, p_user_role, p_payload, p_signature, p_key_id, p_pdf_sha256);
+END;
+$$;
+
+-- Public, the document ID is the only thing a third party has
+CREATE OR REPLACE FUNCTION get_transcript_document(
+  p_id VARCHAR
+)
+RETURNS TABLE (
+  id VARCHAR,
+  student_id INT,
+  issued_at TIMESTAMPTZ,
+  payload TEXT,
+  signature TEXT,
+  key_id VARCHAR,
+  pdf_sha256 VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  SELECT d.id, d.student_id, d.issued_at, d.payload, d.signature, d.key_id, d.pdf_sha256
+  FROM transcript_documents d
+  WHERE d.id = p_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Transcript document not found';
+  END IF;
+END;
+$$;
+
+-- Numeric grades given before scales existed were on the default scale
+UPDATE grades g
+SET mark = points_to_mark(enrollment_grading_scale(g.enrollment_id), g.grade), mark_kind = 'graded'
+WHERE g.grade IS NOT NULL;
@@ -0,0 +1,360 @@
+-- Restores the definitions of 0002_upgrade_baseline, GPAs average grade points as stored again.
+
+DROP FUNCTION resolve_grade;
+
+-- Grade points, mark and mark kind to store for a grade given as a mark, as points, or both (they must agree).
+-- Without either the enrollment is not graded yet. Invalid grades raise invalid_parameter_value.
+CREATE OR REPLACE FUNCTION resolve_grade(
+  p_enrollment_id INT,
+  p_grade DECIMAL,
+  p_mark VARCHAR
+)
+RETURNS TABLE (
+  grade DECIMAL(4, 2),
+  mark VARCHAR,
+  mark_kind VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+  v_scale_id INT;
+  v_mark grading_scale_marks;
+  v_max_points DECIMAL(4, 2);
+BEGIN
+  IF p_grade IS NULL AND (p_mark IS NULL OR btrim(p_mark) = '') THEN
+    RETURN QUERY SELECT NULL::DECIMAL(4, 2), NULL::VARCHAR, NULL::VARCHAR;
+    RETURN;
+  END IF;
+
+  v_scale_id := enrollment_grading_scale(p_enrollment_id);
+
+  IF p_mark IS NOT NULL AND btrim(p_mark) <> '' THEN
+    SELECT * INTO v_mark FROM grading_scale_marks m WHERE m.scale_id = v_scale_id AND m.mark = upper(btrim(p_mark));
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'Invalid mark' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+    IF p_grade IS NOT NULL AND (v_mark.points IS NULL OR v_mark.points <> p_grade) THEN
+      RAISE EXCEPTION 'Grade does not match mark' USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+    RETURN QUERY SELECT v_mark.points, v_mark.mark, v_mark.kind;
+    RETURN;
+  END IF;
+
+  -- Without any scale numeric grades are stored as given
+  IF v_scale_id IS NULL THEN
+    RETURN QUERY SELECT p_grade::DECIMAL(4, 2), NULL::VARCHAR, 'graded'::VARCHAR;
+    RETURN;
+  END IF;
+
+  SELECT MAX(m.points) INTO v_max_points FROM grading_scale_marks m WHERE m.scale_id = v_scale_id;
+  IF p_grade < 0 OR p_grade > v_max_points THEN
+    RAISE EXCEPTION 'Grade is out of range for the grading scale' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+
+  RETURN QUERY SELECT p_grade::DECIMAL(4, 2), points_to_mark(v_scale_id, p_grade), 'graded'::VARCHAR;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION add_grade(
+  p_enrollment_id INT,
+  p_grade DECIMAL(4, 2),
+  p_mark VARCHAR,
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS INT
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_grade_id INT;
+  v_enrollment_term_id INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grades:write');
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID is required';
+  END IF;
+
+  SELECT term_id INTO v_enrollment_term_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  CALL require_course_instructor(p_enrollment_id, p_user_id, p_user_role);
+
+  p_semester := COALESCE(NULLIF(p_semester, 0), v_enrollment_term_id);
+  IF p_semester < v_enrollment_term_id THEN
+    RAISE EXCEPTION 'Grade can not be given before the term of the enrollment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  CALL require_grading_open(p_semester);
+
+  INSERT INTO grades (enrollment_id, grade, mark, mark_kind, semester)
+  SELECT p_enrollment_id, r.grade, r.mark, r.mark_kind, p_semester
+  FROM resolve_grade(p_enrollment_id, p_grade, p_mark) r
+  RETURNING id INTO v_grade_id;
+
+  RETURN v_grade_id;
+
+EXCEPTION
+  WHEN insufficient_privilege OR invalid_parameter_value OR object_not_in_prerequisite_state THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to add grade: %', SQLERRM;
+END;
+$$;
+
+CREATE OR REPLACE PROCEDURE update_grade(
+  p_grade_id INT,
+  p_enrollment_id INT,
+  p_grade DECIMAL(4, 2),
+  p_mark VARCHAR,
+  p_semester INT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+   v_enrollment_term_id INT;
+   v_current_enrollment_id INT;
+   v_current_semester INT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'grades:write');
+
+  IF p_enrollment_id IS NULL OR p_enrollment_id = 0 THEN
+    RAISE EXCEPTION 'Enrollment ID is required';
+  END IF;
+
+  SELECT term_id INTO v_enrollment_term_id FROM enrollments WHERE id = p_enrollment_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Invalid enrollment ID';
+  END IF;
+
+  SELECT enrollment_id, semester INTO v_current_enrollment_id, v_current_semester FROM grades WHERE id = p_grade_id;
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+  -- Both the enrollment the grade belongs to and the one it is moved to must be taught by the user
+  CALL require_course_instructor(v_current_enrollment_id, p_user_id, p_user_role);
+  CALL require_course_instructor(p_enrollment_id, p_user_id, p_user_role);
+
+  -- Likewise the grading windows of both the current and the new term must be open
+  p_semester := COALESCE(NULLIF(p_semester, 0), v_enrollment_term_id);
+  IF p_semester < v_enrollment_term_id THEN
+    RAISE EXCEPTION 'Grade can not be given before the term of the enrollment' USING ERRCODE = 'invalid_parameter_value';
+  END IF;
+  CALL require_grading_open(v_current_semester);
+  CALL require_grading_open(p_semester);
+
+  UPDATE grades
+  SET enrollment_id = p_enrollment_id,
+    grade = r.grade,
+    mark = r.mark,
+    mark_kind = r.mark_kind,
+    semester = p_semester
+  FROM resolve_grade(p_enrollment_id, p_grade, p_mark) r
+  WHERE grades.id = p_grade_id;
+
+  IF NOT FOUND THEN
+    RAISE EXCEPTION 'Grade not found';
+  END IF;
+
+EXCEPTION
+  WHEN insufficient_privilege OR invalid_parameter_value OR object_not_in_prerequisite_state THEN
+    RAISE;
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Grade for this enrollment and semester already exists';
+  WHEN OTHERS THEN
+    RAISE EXCEPTION 'Failed to update grade: %', SQLERRM;
+END;
+$$;
+
+-- Grade that counts towards the GPA for each graded course of a student, considering semesters up to p_through_semester (all if NULL).
+-- A course graded in several semesters, in one enrollment or in enrollments of several terms, is a retake.
+-- p_retake_policy picks the 'latest' attempt, the 'best' attempt or the 'average' of all attempts.
+CREATE OR REPLACE FUNCTION student_effective_grades(
+  p_student_id INT,
+  p_retake_policy VARCHAR,
+  p_through_semester INT
+)
+RETURNS TABLE (
+  course_id INT,
+  credits DECIMAL(3, 2),
+  grade DECIMAL
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  IF p_retake_policy IS NULL OR p_retake_policy NOT IN ('latest', 'best', 'average') THEN
+    RAISE EXCEPTION 'Invalid retake policy';
+  END IF;
+
+  RETURN QUERY
+  SELECT
+    c.id,
+    c.credits,
+    CASE p_retake_policy
+      WHEN 'latest' THEN (array_agg(g.grade ORDER BY g.semester DESC))[1]
+      WHEN 'best' THEN MAX(g.grade)
+      ELSE AVG(g.grade)
+    END
+  FROM
+    enrollments e
+  JOIN
+    courses c ON e.course_id = c.id
+  JOIN
+    grades g ON e.id = g.enrollment_id
+  WHERE
+    e.student_id = p_student_id AND g.grade IS NOT NULL
+    AND (p_through_semester IS NULL OR g.semester <= p_through_semester)
+  GROUP BY
+    c.id, c.credits;
+END;
+$$;
+
+-- One row per graded semester with the name of its term, including semesters with only special marks. sgpa covers every attempt graded
+-- with points in the semester (NULL without any), credits_attempted also includes pass and fail marks.
+-- A course's credits are earned once, in the first semester it was passed (points above 0 or a pass mark).
+-- cgpa is the GPA over all semesters up to this one under the retake policy, the last row matches calculate_student_gpa.
+-- Marks are the equivalents on the student's grading scale.
+CREATE OR REPLACE FUNCTION get_student_gpa_breakdown(
+  p_student_id INT,
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_retake_policy VARCHAR DEFAULT 'latest'
+)
+RETURNS TABLE (
+  semester INT,
+  term_name VARCHAR,
+  sgpa DECIMAL(4, 2),
+  sgpa_mark VARCHAR,
+  credits_attempted DECIMAL,
+  credits_earned DECIMAL,
+  cgpa DECIMAL(4, 2),
+  cgpa_mark VARCHAR
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+DECLARE
+  v_student_exists BOOLEAN;
+  v_scale_id INT;
+BEGIN
+  IF NOT (p_user_role = 'student' AND p_student_id = p_user_id) AND NOT has_permission(p_user_id, p_user_role, 'transcripts:read') THEN
+    RAISE EXCEPTION 'Access denied. Students can only calculate their own GPA.';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  IF NOT v_student_exists THEN
+    RAISE EXCEPTION 'Student not found';
+  END IF;
+
+  IF p_retake_policy IS NULL OR p_retake_policy NOT IN ('latest', 'best', 'average') THEN
+    RAISE EXCEPTION 'Invalid retake policy';
+  END IF;
+
+  v_scale_id := student_grading_scale(p_student_id);
+
+  RETURN QUERY
+  WITH attempts AS (
+    SELECT c.id AS course_id, c.credits, g.grade, g.mark_kind, g.semester
+    FROM enrollments e
+    JOIN courses c ON e.course_id = c.id
+    JOIN grades g ON e.id = g.enrollment_id
+    WHERE e.student_id = p_student_id AND (g.grade IS NOT NULL OR g.mark IS NOT NULL)
+  ),
+  first_passed AS (
+    SELECT a.course_id, MIN(a.semester) AS passed_semester
+    FROM attempts a
+    WHERE a.grade > 0 OR a.mark_kind = 'pass'
+    GROUP BY a.course_id
+  ),
+  semesters AS (
+    SELECT
+      a.semester,
+      (SUM(a.grade * a.credits) / NULLIF(SUM(a.credits) FILTER (WHERE a.grade IS NOT NULL), 0))::DECIMAL(4, 2) AS sgpa,
+      COALESCE(SUM(a.credits) FILTER (WHERE a.grade IS NOT NULL OR a.mark_kind IN ('pass', 'fail')), 0)::DECIMAL AS credits_attempted,
+      COALESCE(SUM(a.credits) FILTER (WHERE fp.passed_semester = a.semester), 0)::DECIMAL AS credits_earned,
+      (
+        SELECT SUM(eg.grade * eg.credits) / NULLIF(SUM(eg.credits), 0)
+        FROM student_effective_grades(p_student_id, p_retake_policy, a.semester) eg
+      )::DECIMAL(4, 2) AS cgpa
+    FROM
+      attempts a
+    LEFT JOIN
+      first_passed fp ON fp.course_id = a.course_id
+    GROUP BY
+      a.semester
+  )
+  SELECT
+    sm.semester,
+    t.name,
+    sm.sgpa,
+    points_to_mark(v_scale_id, sm.sgpa),
+    sm.credits_attempted,
+    sm.credits_earned,
+    COALESCE(sm.cgpa, 0),
+    points_to_mark(v_scale_id, sm.cgpa)
+  FROM
+    semesters sm
+  JOIN
+    terms t ON t.id = sm.semester
+  ORDER BY
+    sm.semester;
+END;
+$$;
+
+-- Requirements of every group of p_course_id the student does not meet for enrolling in p_term_id. A prerequisite is
+-- met by a passing grade (points above 0 or a pass mark, or at least min_grade points) in an earlier term, a
+-- corequisite also by a grade in or an enrollment into the same term.
+CREATE OR REPLACE FUNCTION get_unmet_prerequisites(
+  p_student_id INT,
+  p_course_id INT,
+  p_term_id INT
+)
+RETURNS TABLE (
+  group_number INT,
+  required_course_id INT,
+  required_course_code VARCHAR,
+  min_grade DECIMAL,
+  is_corequisite BOOLEAN
+)
+LANGUAGE plpgsql
+AS $$
+#variable_conflict use_column
+BEGIN
+  RETURN QUERY
+  WITH requirements AS (
+    SELECT
+      cp.*,
+      EXISTS (
+        SELECT 1
+        FROM enrollments e
+        JOIN grades g ON g.enrollment_id = e.id
+        WHERE e.student_id = p_student_id AND e.course_id = cp.required_course_id
+          AND (g.semester < p_term_id OR (cp.is_corequisite AND g.semester = p_term_id))
+          AND CASE WHEN cp.min_grade IS NULL THEN g.grade > 0 OR g.mark_kind = 'pass' ELSE g.grade >= cp.min_grade END
+      ) OR (cp.is_corequisite AND EXISTS (
+        SELECT 1 FROM enrollments e
+        WHERE e.student_id = p_student_id AND e.course_id = cp.required_course_id AND e.term_id = p_term_id
+      )) AS met
+    FROM course_prerequisites cp
+    WHERE cp.course_id = p_course_id
+  )
+  SELECT r.group_number, r.required_course_id, c.code, r.min_grade, r.is_corequisite
+  FROM requirements r
+  JOIN courses c ON c.id = r.required_course_id
+  WHERE NOT EXISTS (SELECT 1 FROM requirements m WHERE m.group_number = r.group_number AND m.met)
+  ORDER BY r.group_number, c.code;
+END;
+$$;
+
+DROP FUNCTION convert_grade_points;
+DROP FUNCTION grading_scale_max_points;
+
+ALTER TABLE grades DROP COLUMN max_points;
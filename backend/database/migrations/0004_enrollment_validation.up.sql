@@ -0,0 +1,156 @@
+-- Enrollment imports used to copy rows into enrollments directly, skipping the enrollment window, sections, capacity
+-- and prerequisites. The checks of create_enrollment move into validate_enrollment, and imports enroll every row
+-- through create_enrollment.
+
+-- Checks shared by create_enrollment and the enrollment import: the student and course exist, enrollment into the term
+-- is open, a course with sections in the term is enrolled into through one (p_section_id, already checked to belong to
+-- the course and term) and the student is not enrolled yet. Unmet prerequisites raise 'Prerequisites not met' with the
+-- JSON array of get_unmet_prerequisites as DETAIL, unless p_override_prerequisites is set by a user holding
+-- prerequisites:override; the overridden requirements are returned then, NULL when all are met.
+CREATE OR REPLACE FUNCTION validate_enrollment(
+  p_student_id INT,
+  p_course_id INT,
+  p_term_id INT,
+  p_section_id INT,
+  p_override_prerequisites BOOLEAN,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS JSONB
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_student_exists BOOLEAN;
+  v_course_exists BOOLEAN;
+  v_unmet JSONB;
+BEGIN
+  IF p_student_id IS NULL OR p_student_id = 0 OR p_course_id IS NULL OR p_course_id = 0 THEN
+    RAISE EXCEPTION 'Student ID and Course ID are required';
+  END IF;
+
+  SELECT EXISTS(SELECT 1 FROM students WHERE id = p_student_id) INTO v_student_exists;
+  SELECT EXISTS(SELECT 1 FROM courses WHERE id = p_course_id) INTO v_course_exists;
+
+  IF NOT v_student_exists OR NOT v_course_exists THEN
+    RAISE EXCEPTION 'Invalid student ID or course ID';
+  END IF;
+
+  CALL require_enrollment_open(p_term_id);
+
+  IF p_section_id IS NULL AND EXISTS (SELECT 1 FROM course_sections WHERE course_id = p_course_id AND term_id = p_term_id) THEN
+    RAISE EXCEPTION 'Section ID is required for this course';
+  END IF;
+
+  IF EXISTS (SELECT 1 FROM enrollments WHERE student_id = p_student_id AND course_id = p_course_id AND term_id = p_term_id) THEN
+    RAISE EXCEPTION 'Student is already enrolled in this course';
+  END IF;
+
+  SELECT jsonb_agg(jsonb_build_object(
+      'group', u.group_number,
+      'required_course_id', u.required_course_id,
+      'required_course_code', u.required_course_code,
+      'min_grade', u.min_grade,
+      'corequisite', u.is_corequisite
+    ))
+  INTO v_unmet
+  FROM get_unmet_prerequisites(p_student_id, p_course_id, p_term_id) u;
+
+  IF v_unmet IS NOT NULL THEN
+    IF NOT COALESCE(p_override_prerequisites, FALSE) THEN
+      RAISE EXCEPTION 'Prerequisites not met' USING DETAIL = v_unmet::TEXT;
+    END IF;
+    CALL require_permission(p_user_id, p_user_role, 'prerequisites:override');
+  END IF;
+
+  RETURN v_unmet;
+END;
+$$;
+
+-- Enrolls into p_section_id when given, taking course and term from it; a course with sections in the term can only
+-- be enrolled into through one of them. A full section puts the student on its waitlist instead, then v_id and v_date
+-- are NULL and v_waitlist_id and v_waitlist_position are set.
+-- The student, course and term are checked by validate_enrollment. Every prerequisite override is kept in
+-- prerequisite_overrides.
+CREATE OR REPLACE FUNCTION create_enrollment(
+  p_student_id INT,
+  p_course_id INT,
+  p_term_id INT,
+  p_section_id INT,
+  p_override_prerequisites BOOLEAN,
+  p_override_reason TEXT,
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  v_id INT,
+  v_date DATE,
+  v_waitlist_id INT,
+  v_waitlist_position INT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_enrollment_id INT;
+  v_enrollment_date DATE;
+  v_section course_sections;
+  v_entry_id INT;
+  v_unmet JSONB;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'enrollments:write');
+
+  IF p_section_id IS NOT NULL AND p_section_id <> 0 THEN
+    -- Serializes enrollments into the section, so the seat count below stays valid until commit
+    SELECT * INTO v_section FROM course_sections WHERE id = p_section_id FOR UPDATE;
+    IF NOT FOUND THEN
+      RAISE EXCEPTION 'Invalid section ID';
+    END IF;
+    IF (p_course_id IS NOT NULL AND p_course_id <> 0 AND p_course_id <> v_section.course_id)
+      OR (p_term_id IS NOT NULL AND p_term_id <> 0 AND p_term_id <> v_section.term_id) THEN
+      RAISE EXCEPTION 'Section does not belong to the course and term';
+    END IF;
+    p_course_id := v_section.course_id;
+    p_term_id := v_section.term_id;
+  END IF;
+
+  v_unmet := validate_enrollment(p_student_id, p_course_id, p_term_id, v_section.id, p_override_prerequisites, p_user_id, p_user_role);
+
+  IF v_section.id IS NOT NULL AND (SELECT COUNT(*) FROM enrollments WHERE section_id = v_section.id) >= v_section.capacity THEN
+    IF EXISTS (SELECT 1 FROM section_waitlist WHERE section_id = v_section.id AND student_id = p_student_id) THEN
+      RAISE EXCEPTION 'Student is already on the waitlist of this section';
+    END IF;
+
+    INSERT INTO section_waitlist (section_id, student_id)
+    VALUES (v_section.id, p_student_id)
+    RETURNING id INTO v_entry_id;
+
+    -- Promotion from the waitlist does not check prerequisites again
+    IF v_unmet IS NOT NULL THEN
+      INSERT INTO prerequisite_overrides (student_id, course_id, term_id, unmet, reason, overridden_by)
+      VALUES (p_student_id, p_course_id, p_term_id, v_unmet, COALESCE(p_override_reason, ''), p_user_id);
+    END IF;
+
+    RETURN QUERY SELECT NULL::INT, NULL::DATE, v_entry_id, waitlist_position(v_entry_id);
+    RETURN;
+  END IF;
+
+  INSERT INTO enrollments (student_id, course_id, term_id, section_id)
+  VALUES (p_student_id, p_course_id, p_term_id, v_section.id)
+  RETURNING id, enrollment_date INTO v_enrollment_id, v_enrollment_date;
+
+  IF v_unmet IS NOT NULL THEN
+    INSERT INTO prerequisite_overrides (student_id, course_id, term_id, enrollment_id, unmet, reason, overridden_by)
+    VALUES (p_student_id, p_course_id, p_term_id, v_enrollment_id, v_unmet, COALESCE(p_override_reason, ''), p_user_id);
+  END IF;
+
+  -- A seat in one section ends waiting for the others
+  DELETE FROM section_waitlist w
+  USING course_sections cs
+  WHERE w.section_id = cs.id AND cs.course_id = p_course_id AND cs.term_id = p_term_id AND w.student_id = p_student_id;
+
+  RETURN QUERY SELECT v_enrollment_id, v_enrollment_date, NULL::INT, NULL::INT;
+
+EXCEPTION
+  WHEN unique_violation THEN
+    RAISE EXCEPTION 'Student is already enrolled in this course';
+END;
+$$;
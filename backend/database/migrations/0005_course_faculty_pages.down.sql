@@ -0,0 +1,38 @@
+-- Restores the unpaginated course and faculty lists of 0002_upgrade_baseline.
+
+DROP FUNCTION get_faculty_page;
+DROP FUNCTION get_courses_page;
+
+CREATE OR REPLACE FUNCTION get_all_courses()
+RETURNS SETOF courses
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  RETURN QUERY SELECT * FROM courses;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION get_faculty(
+  p_user_id INT,
+  p_user_role VARCHAR
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  info TEXT,
+  active BOOLEAN,
+  roles VARCHAR[]
+)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  RETURN QUERY
+  SELECT f.id, f.name, f.date_of_birth, f.info, f.active,
+    ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = f.id AND ur.user_role = 'faculty' ORDER BY ur.role)::VARCHAR[]
+  FROM faculty f
+  ORDER BY f.id;
+END;
+$$;
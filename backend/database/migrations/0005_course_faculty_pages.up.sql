@@ -0,0 +1,120 @@
+-- GET /courses and GET /faculty return pages like the other list endpoints, see get_students_page
+
+DROP FUNCTION get_all_courses;
+DROP FUNCTION get_faculty;
+
+-- Keyset paginated course list filtered by case insensitive code prefix and grading scale, see get_students_page.
+-- Courses are visible to every signed in user.
+CREATE OR REPLACE FUNCTION get_courses_page(
+  p_code_prefix VARCHAR,
+  p_grading_scale_id INT,
+  p_sort VARCHAR,
+  p_descending BOOLEAN,
+  p_after_value TEXT,
+  p_after_id INT,
+  p_limit INT
+)
+RETURNS TABLE (
+  id INT,
+  code VARCHAR,
+  title VARCHAR,
+  credits DECIMAL(3, 2),
+  grading_scale_id INT,
+  sort_value TEXT,
+  total_count BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_sort_key TEXT;
+  v_sort_type TEXT;
+BEGIN
+  CASE p_sort
+    WHEN 'id' THEN v_sort_key := 'c.id'; v_sort_type := 'INT';
+    WHEN 'code' THEN v_sort_key := 'c.code'; v_sort_type := 'VARCHAR';
+    WHEN 'title' THEN v_sort_key := 'c.title'; v_sort_type := 'VARCHAR';
+    WHEN 'credits' THEN v_sort_key := 'c.credits'; v_sort_type := 'DECIMAL';
+    ELSE RAISE EXCEPTION 'Invalid sort field';
+  END CASE;
+
+  RETURN QUERY EXECUTE format($query$
+    SELECT f.id, f.code, f.title, f.credits, f.grading_scale_id, f.sort_key::TEXT, f.total_count
+    FROM (
+      SELECT c.*, %1$s AS sort_key, count(*) OVER () AS total_count
+      FROM courses c
+      WHERE ($1::VARCHAR IS NULL OR starts_with(lower(c.code), lower($1)))
+        AND ($2::INT IS NULL OR c.grading_scale_id = $2)
+    ) f
+    WHERE $3::TEXT IS NULL OR (f.sort_key, f.id) %3$s (CAST($3 AS %2$s), $4)
+    ORDER BY f.sort_key %4$s, f.id %4$s
+    LIMIT $5
+  $query$, v_sort_key, v_sort_type, CASE WHEN p_descending THEN '<' ELSE '>' END, CASE WHEN p_descending THEN 'DESC' ELSE 'ASC' END)
+  USING p_code_prefix, p_grading_scale_id, p_after_value, p_after_id, p_limit;
+
+EXCEPTION
+  WHEN data_exception THEN
+    RAISE EXCEPTION 'Invalid cursor';
+END;
+$$;
+
+-- Keyset paginated faculty list with their roles, filtered by active state, role and case insensitive name prefix,
+-- see get_students_page
+CREATE OR REPLACE FUNCTION get_faculty_page(
+  p_user_id INT,
+  p_user_role VARCHAR,
+  p_active BOOLEAN,
+  p_role VARCHAR,
+  p_name_prefix VARCHAR,
+  p_sort VARCHAR,
+  p_descending BOOLEAN,
+  p_after_value TEXT,
+  p_after_id INT,
+  p_limit INT
+)
+RETURNS TABLE (
+  id INT,
+  name VARCHAR,
+  date_of_birth DATE,
+  info TEXT,
+  active BOOLEAN,
+  roles VARCHAR[],
+  sort_value TEXT,
+  total_count BIGINT
+)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+  v_sort_key TEXT;
+  v_sort_type TEXT;
+BEGIN
+  CALL require_permission(p_user_id, p_user_role, 'faculty:manage');
+
+  CASE p_sort
+    WHEN 'id' THEN v_sort_key := 'f.id'; v_sort_type := 'INT';
+    WHEN 'name' THEN v_sort_key := 'f.name'; v_sort_type := 'VARCHAR';
+    WHEN 'date_of_birth' THEN v_sort_key := 'f.date_of_birth'; v_sort_type := 'DATE';
+    ELSE RAISE EXCEPTION 'Invalid sort field';
+  END CASE;
+
+  RETURN QUERY EXECUTE format($query$
+    SELECT p.id, p.name, p.date_of_birth, p.info, p.active,
+      ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = p.id AND ur.user_role = 'faculty' ORDER BY ur.role)::VARCHAR[],
+      p.sort_key::TEXT, p.total_count
+    FROM (
+      SELECT f.*, %1$s AS sort_key, count(*) OVER () AS total_count
+      FROM faculty f
+      WHERE ($1::BOOLEAN IS NULL OR f.active = $1)
+        AND ($2::VARCHAR IS NULL OR EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = f.id AND ur.user_role = 'faculty' AND ur.role = $2))
+        AND ($3::VARCHAR IS NULL OR starts_with(lower(f.name), lower($3)))
+    ) p
+    WHERE $4::TEXT IS NULL OR (p.sort_key, p.id) %3$s (CAST($4 AS %2$s), $5)
+    ORDER BY p.sort_key %4$s, p.id %4$s
+    LIMIT $6
+  $query$, v_sort_key, v_sort_type, CASE WHEN p_descending THEN '<' ELSE '>' END, CASE WHEN p_descending THEN 'DESC' ELSE 'ASC' END)
+  USING p_active, p_role, p_name_prefix, p_after_value, p_after_id, p_limit;
+
+EXCEPTION
+  WHEN data_exception THEN
+    RAISE EXCEPTION 'Invalid cursor';
+END;
+$$;
@@ -0,0 +1,66 @@
+-- Demo data loaded by `migrate seed` into an empty database at the latest schema version.
+-- Every password is the hashed date of birth (YYYY-MM-DD), which has to be changed on first login.
+
+INSERT INTO students (name, password, must_change_password, date_of_birth, address, contact, program) VALUES
+('Alice Smith', '$2a$12$Ycindqsw/4pr4KKbuSEEpe.VivixeRkyehwgFPREcf.v7b/h8MiHa', TRUE, '2002-05-15', '123 Main St, Anytown', '555-1234', 'Computer Science'),
+('Bob Johnson', '$2a$12$VZCRKIVaaJPh5LxwnQ.lMO12LMkuAhRcpKi4Avv.gg/uyP9vpTZsm', TRUE, '2003-11-20', '456 Oak Ave, Somewhere', '555-5678', 'Electrical Engineering'),
+('Charlie Brown', '$2a$12$gA0DOHYtfnv84wnkMp7V3OKxvLk2CKgyBOn3mnp2FroGJAFGGmc9m', TRUE, '2001-07-01', '789 Pine Ln, Nowhere', '555-9012', 'Physics'),
+('Diana Prince', '$2a$12$IJyouvfzOglRi2wiq.uHG.a0UI08vAVhpA7JIz.KQooA59yA8siaq', TRUE, '2004-03-10', '101 Hero Way, Themyscira', '555-3456', 'History'),
+('Ethan Hunt', '$2a$12$JAS86zOBDIob9nm5l.sUXOiufIjkydbQUglV3RAVMD5GwFEh9HIHa', TRUE, '2003-09-25', '246 Spy Blvd, IMF HQ', '555-7890', 'International Relations');
+
+INSERT INTO faculty (name, password, must_change_password, date_of_birth, info) VALUES
+('prof_davis', '$2a$12$pIqoNHKJ/FZn1clkBWd34eIh4fYdlGaVBJ2PKY85TD2kxTIF37Wca', TRUE, '1975-08-22', 'Dr. Emily Davis, Head of Computer Science'),
+('dr_wilson', '$2a$12$8ENnMdkNgbWrxoCXNhzLkeuf5MgHFqWHtL/hFDKNZMcRPZvB7nMcm', TRUE, '1968-04-11', 'Dr. John Wilson, Professor of Electrical Engineering'),
+('prof_jones', '$2a$12$NSUgfy1EFqu/TZ8spHI8luyFo/cOTqe.nhfOt6CNVp3nM8RGIg9Va', TRUE, '1980-12-03', 'Dr. Sarah Jones, Professor of History');
+
+INSERT INTO user_roles (user_id, user_role, role) VALUES
+(1, 'faculty', 'admin'),
+(2, 'faculty', 'instructor'),
+(3, 'faculty', 'instructor');
+
+INSERT INTO terms (id, name, start_date, end_date, enrollment_opens, enrollment_closes, grades_due) VALUES
+(20231, 'Fall 2023', '2023-09-01', '2023-12-20', '2023-08-01', '2023-09-15', '2024-01-10'),
+(20242, 'Spring 2024', '2024-01-15', '2024-05-15', '2024-01-02', '2024-01-31', '2024-06-01');
+
+INSERT INTO courses (code, title, credits) VALUES
+('CS101', 'Introduction to Programming', 3.00),
+('EE201', 'Circuit Analysis', 4.00),
+('PHY101', 'General Physics I', 4.00),
+('HIS201', 'World History II', 3.00),
+('IR301', 'Global Politics', 3.00);
+
+INSERT INTO course_instructors (course_id, faculty_id) VALUES
+(1, 1),
+(2, 2),
+(3, 2),
+(4, 3),
+(5, 3);
+
+-- EE201 needs CS101 with at least 2.00, and PHY101 before or alongside it. IR301 needs HIS201.
+INSERT INTO course_prerequisites (course_id, group_number, required_course_id, min_grade, is_corequisite) VALUES
+(2, 1, 1, 2.00, FALSE),
+(2, 2, 3, NULL, TRUE),
+(5, 1, 4, NULL, FALSE);
+
+INSERT INTO course_sections (course_id, term_id, section_number, instructor_id, capacity, room, meeting_times) VALUES
+(1, 20242, '001', 1, 30, 'CS Lab 1', 'Mon/Wed 09:00-10:30'),
+(4, 20242, '001', 3, 25, 'Humanities 204', 'Tue/Thu 13:00-14:30');
+
+INSERT INTO enrollments (student_id, course_id, term_id, section_id, enrollment_date) VALUES
+(1, 1, 20231, NULL, '2023-09-01'),
+(1, 3, 20231, NULL, '2023-09-01'),
+(2, 2, 20231, NULL, '2023-09-01'),
+(3, 3, 20231, NULL, '2023-09-01'),
+(4, 4, 20231, NULL, '2023-09-01'),
+(5, 5, 20231, NULL, '2023-09-01'),
+(1, 4, 20242, 2, '2024-01-15'),
+(2, 1, 20242, 1, '2024-01-15');
+
+INSERT INTO grades (enrollment_id, grade, mark, mark_kind, max_points, semester) VALUES
+(1, 3.80, 'A-', 'graded', 4.00, 20231),
+(2, 3.50, 'B+', 'graded', 4.00, 20231),
+(3, 4.00, 'A', 'graded', 4.00, 20231),
+(4, 3.20, 'B', 'graded', 4.00, 20231),
+(5, 3.90, 'A-', 'graded', 4.00, 20231),
+(6, 3.70, 'A-', 'graded', 4.00, 20231),
+(7, 3.00, 'B', 'graded', 4.00, 20242);
@@ -5,7 +5,7 @@ import (
   "errors"
   "time"
 
-  "backend/common"
+  "backend/config"
   "backend/database"
   "backend/models"
 
@@ -13,26 +13,46 @@ import (
   "github.com/golang-jwt/jwt/v5"
 )
 
-var JwtSecret = []byte(common.MustGetEnv("JWT_SECRET"))
-
+// Claims of an access token, the registered jti claim holds the session ID.
+// Role is the account type (student or faculty), Permissions are derived from the roles assigned to the account.
 type Claims struct {
-  ID   int    `json:"id"`
-  Role string `json:"role"`
+  ID                 int      `json:"id"`
+  Role               string   `json:"role"`
+  Permissions        []string `json:"permissions,omitempty"`
+  MustChangePassword bool     `json:"must_change_password,omitempty"`
+  MustEnrollMFA      bool     `json:"must_enroll_mfa,omitempty"`
   jwt.RegisteredClaims
 }
 
-func generateJWT(id int, role string) (string, error) {
-  claims := Claims{
-    ID:   id,
-    Role: role,
-    RegisteredClaims: jwt.RegisteredClaims{
-      ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-      IssuedAt:  jwt.NewNumericDate(time.Now()),
-    },
+/// Sign an access token for the session, filling in the registered claims
+func generateJWT(sessionID string, claims Claims) (string, time.Time, error) {
+  now := time.Now()
+  expiresAt := now.Add(config.Current.AccessTokenTTL)
+  claims.RegisteredClaims = jwt.RegisteredClaims{
+    ID:        sessionID,
+    ExpiresAt: jwt.NewNumericDate(expiresAt),
+    IssuedAt:  jwt.NewNumericDate(now),
   }
 
-  token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-  return token.SignedString(JwtSecret)
+  signed, err := Keys.Sign(claims)
+  return signed, expiresAt, err
+}
+
+func GetJWKS(c fiber.Ctx) error {
+  c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+  return c.JSON(Keys.JWKS())
+}
+
+/// Replace a hash of a lower cost with a fresh one
+func upgradePassword(id int, role string, password string, mustChange bool) error {
+  hash, err := hashPassword(password)
+  if err != nil {
+    return err
+  }
+
+  query := `CALL set_user_password($1, $2, $3, $4)`
+  _, err = database.DB.Exec(context.Background(), query, id, role, hash, mustChange)
+  return err
 }
 
 func Login(c fiber.Ctx) error {
@@ -46,25 +66,128 @@ func Login(c fiber.Ctx) error {
     return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ID, password, and valid role are required"})
   }
 
+  outcome := ""
+  defer func() { recordLogin(c, loginReq.Role, outcome) }()
+
+  accountKey := accountLimiterKey(loginReq.ID, loginReq.Role)
+  ipKey := ipLimiterKey(c.IP())
+
+  retryAfter, err := loginRetryAfter(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if retryAfter > 0 {
+    return sendTooManyAttempts(c, retryAfter)
+  }
+
   var authenticatedUserID int
   var authenticatedUserRole string
+  var storedPassword string
+  var mustChangePassword bool
 
-  query := `SELECT user_id, user_role FROM authenticate_user($1, $2, $3)`
-  err := database.DB.QueryRow(context.Background(), query,
+  query := `SELECT user_id, user_role, password, must_change_password FROM get_user_credentials($1, $2)`
+  err = database.DB.QueryRow(context.Background(), query,
     loginReq.ID,
-    loginReq.Password,
     loginReq.Role,
-  ).Scan(&authenticatedUserID, &authenticatedUserRole)
+  ).Scan(&authenticatedUserID, &authenticatedUserRole, &storedPassword, &mustChangePassword)
 
+  if isInvalidCredentials(err) {
+    // Answer as slowly as for a wrong password, the response time must not tell which IDs exist
+    rejectPassword(loginReq.Password)
+    return sendLoginFailed(c, accountKey, ipKey)
+  }
   if err != nil {
     return handleDatabaseError(c, err)
   }
 
-  token, err := generateJWT(authenticatedUserID, authenticatedUserRole)
+  ok, rehash := verifyPassword(storedPassword, loginReq.Password)
+  if !ok {
+    return sendLoginFailed(c, accountKey, ipKey)
+  }
+
+  if rehash {
+    if err := upgradePassword(authenticatedUserID, authenticatedUserRole, loginReq.Password, mustChangePassword); err != nil {
+      println("Failed to upgrade password hash:", err.Error())
+    }
+  }
+
+  factor, err := getMFAFactor(authenticatedUserID, authenticatedUserRole)
   if err != nil {
-    return sendInternalServerError(c, errors.New("Failed to generate token"))
+    return sendInternalServerError(c, err)
+  }
+  if factor != nil && factor.enabled {
+    // The password alone only buys a challenge, the session is started by VerifyLoginMFA
+    challenge, expiresAt, err := generateMFAChallenge(authenticatedUserID, authenticatedUserRole, mustChangePassword)
+    if err != nil {
+      return sendInternalServerError(c, errors.New("Failed to generate token"))
+    }
+    outcome = "mfa_required"
+    return c.JSON(models.MFAChallengeResponse{MFARequired: true, MFAToken: challenge, ExpiresAt: expiresAt})
   }
 
-  return c.JSON(models.AuthResponse{Token: token, Role: authenticatedUserRole, ID: authenticatedUserID})
+  if err := accountLimiter.Reset(context.Background(), accountKey); err != nil {
+    println("Failed to reset login attempts:", err.Error())
+  }
+
+  response, err := startSession(authenticatedUserID, authenticatedUserRole, mustChangePassword)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.JSON(response)
 }
 
+func ChangePassword(c fiber.Ctx) error {
+  req := new(models.ChangePasswordRequest)
+
+  if err := c.Bind().Body(req); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if req.CurrentPassword == "" || req.NewPassword == "" {
+    return sendBadRequestError(c, "Current and new password are required")
+  }
+  if len(req.NewPassword) < minPasswordLength {
+    return sendBadRequestError(c, "New password is too short")
+  }
+  if len(req.NewPassword) > maxPasswordLength {
+    return sendBadRequestError(c, "New password is too long")
+  }
+  if req.NewPassword == req.CurrentPassword {
+    return sendBadRequestError(c, "New password must differ from the current password")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  var storedPassword string
+  var dateOfBirth time.Time
+  query := `SELECT password, date_of_birth FROM get_user_credentials($1, $2)`
+  err := database.DB.QueryRow(context.Background(), query, userID, userRole).Scan(&storedPassword, &dateOfBirth)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  if ok, _ := verifyPassword(storedPassword, req.CurrentPassword); !ok {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+  }
+  if req.NewPassword == dateOfBirth.Format(dobPasswordLayout) {
+    return sendBadRequestError(c, "New password must not be the date of birth")
+  }
+
+  if err := upgradePassword(userID, userRole, req.NewPassword, false); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  // Sign out everywhere else, the old tokens may also still carry the must change password flag
+  if err := revokeUserSessions(userID, userRole); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  response, err := startSession(userID, userRole, false)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.JSON(response)
+}
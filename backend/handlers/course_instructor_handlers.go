@@ -0,0 +1,91 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+func GetCourseInstructors(c fiber.Ctx) error {
+  courseID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid course ID")
+  }
+
+  query := `SELECT faculty_id, name, assigned_at FROM get_course_instructors($1)`
+  rows, err := database.DB.Query(context.Background(), query, courseID)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  instructors := []models.CourseInstructor{}
+  for rows.Next() {
+    instructor := models.CourseInstructor{}
+    if err := rows.Scan(&instructor.FacultyID, &instructor.Name, &instructor.AssignedAt); err != nil {
+      return sendInternalServerError(c, err)
+    }
+    instructors = append(instructors, instructor)
+  }
+
+  // The course check is raised on the first row
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(instructors)
+}
+
+func AssignCourseInstructor(c fiber.Ctx) error {
+  courseID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid course ID")
+  }
+
+  instructor := new(models.CourseInstructor)
+  if err := c.Bind().JSON(instructor); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+  if instructor.FacultyID == 0 {
+    return sendBadRequestError(c, "Faculty ID is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL assign_course_instructor($1, $2, $3, $4)`
+  _, err = database.DB.Exec(context.Background(), query, courseID, instructor.FacultyID, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Instructor assigned successfully"})
+}
+
+func UnassignCourseInstructor(c fiber.Ctx) error {
+  courseID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid course ID")
+  }
+  facultyID, err := strconv.Atoi(c.Params("facultyId"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid faculty ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL unassign_course_instructor($1, $2, $3, $4)`
+  _, err = database.DB.Exec(context.Background(), query, courseID, facultyID, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Instructor unassigned successfully"})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "strings"
+
+  "backend/models"
+  "backend/tabular"
+
+  "github.com/gofiber/fiber/v3"
+  "github.com/jackc/pgx/v5"
+)
+
+// A column of an exported CSV or XLSX file
+type exportColumn[T any] struct {
+  name  string
+  value func(*T) any
+}
+
+var studentExportColumns = []exportColumn[models.Student]{
+  {"id", func(s *models.Student) any { return s.ID }},
+  {"name", func(s *models.Student) any { return s.Name }},
+  {"date_of_birth", func(s *models.Student) any { return s.DateOfBirth }},
+  {"address", func(s *models.Student) any { return s.Address }},
+  {"contact", func(s *models.Student) any { return s.Contact }},
+  {"program", func(s *models.Student) any { return s.Program }},
+}
+
+var courseExportColumns = []exportColumn[models.Course]{
+  {"id", func(c *models.Course) any { return c.ID }},
+  {"code", func(c *models.Course) any { return c.Code }},
+  {"title", func(c *models.Course) any { return c.Title }},
+  {"credits", func(c *models.Course) any { return c.Credits }},
+  {"grading_scale_id", func(c *models.Course) any { return c.GradingScaleID }},
+}
+
+var enrollmentExportColumns = []exportColumn[models.Enrollment]{
+  {"id", func(e *models.Enrollment) any { return e.ID }},
+  {"student_id", func(e *models.Enrollment) any { return e.StudentID }},
+  {"course_id", func(e *models.Enrollment) any { return e.CourseID }},
+  {"term_id", func(e *models.Enrollment) any { return e.TermID }},
+  {"section_id", func(e *models.Enrollment) any { return e.SectionID }},
+  {"enrollment_date", func(e *models.Enrollment) any { return e.EnrollmentDate }},
+}
+
+var gradeExportColumns = []exportColumn[models.Grade]{
+  {"id", func(g *models.Grade) any { return g.ID }},
+  {"enrollment_id", func(g *models.Grade) any { return g.EnrollmentID }},
+  {"grade", func(g *models.Grade) any { return g.Grade }},
+  {"mark", func(g *models.Grade) any { return g.Mark }},
+  {"semester", func(g *models.Grade) any { return g.Semester }},
+}
+
+var transcriptExportColumns = []exportColumn[models.TranscriptCourse]{
+  {"enrollment_id", func(t *models.TranscriptCourse) any { return t.EnrollmentID }},
+  {"course_code", func(t *models.TranscriptCourse) any { return t.CourseCode }},
+  {"course_title", func(t *models.TranscriptCourse) any { return t.CourseTitle }},
+  {"credits", func(t *models.TranscriptCourse) any { return t.Credits }},
+  {"grade", func(t *models.TranscriptCourse) any { return t.Grade }},
+  {"mark", func(t *models.TranscriptCourse) any { return t.Mark }},
+  {"semester", func(t *models.TranscriptCourse) any { return t.Semester }},
+}
+
+/// Export format asked for with ?format= or the Accept header, empty for the regular JSON response
+func exportFormat(c fiber.Ctx) (tabular.Format, error) {
+  // The same URL answers JSON or a file depending on Accept, caches must not hand one to a client asking for the other
+  c.Vary(fiber.HeaderAccept)
+
+  if format := c.Query("format"); format != "" {
+    switch tabular.Format(strings.ToLower(format)) {
+    case "json":
+      return "", nil
+    case tabular.CSV:
+      return tabular.CSV, nil
+    case tabular.XLSX:
+      return tabular.XLSX, nil
+    case tabular.NDJSON:
+      return tabular.NDJSON, nil
+    }
+    return "", errors.New("format must be one of json, csv, xlsx, ndjson")
+  }
+
+  // Without an Accept header the first offer, JSON, wins
+  switch c.Accepts(fiber.MIMEApplicationJSON, tabular.CSVContentType, tabular.XLSXContentType, tabular.NDJSONContentType) {
+  case tabular.CSVContentType:
+    return tabular.CSV, nil
+  case tabular.XLSXContentType:
+    return tabular.XLSX, nil
+  case tabular.NDJSONContentType:
+    return tabular.NDJSON, nil
+  }
+  return "", nil
+}
+
+/// Stream the rows of a query as an attachment, rows are scanned and written one at a time and closed when done.
+/// The first row is read before the response starts, so exceptions raised by the query still get a proper status.
+func streamExport[T any](c fiber.Ctx, format tabular.Format, name string, columns []exportColumn[T], rows pgx.Rows, scan func(pgx.Rows, *T) error) error {
+  hasRow := rows.Next()
+  if !hasRow {
+    if err := rows.Err(); err != nil {
+      rows.Close()
+      return handleDatabaseError(c, err)
+    }
+  }
+
+  names := make([]string, len(columns))
+  for i, column := range columns {
+    names[i] = column.name
+  }
+
+  c.Set(fiber.HeaderContentType, tabular.ContentType(format))
+  c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+
+  return c.SendStreamWriter(func(w *bufio.Writer) {
+    defer rows.Close()
+
+    // The status is already sent, failures can only be logged and end the download early
+    writer, err := tabular.NewWriter(w, format, names)
+    if err != nil {
+      println("Failed to start export:", err.Error())
+      return
+    }
+
+    for ok := hasRow; ok; ok = rows.Next() {
+      item := new(T)
+      if err := scan(rows, item); err != nil {
+        println("Failed to scan exported row:", err.Error())
+        return
+      }
+
+      if format == tabular.NDJSON {
+        err = writer.Write(item)
+      } else {
+        values := make([]any, len(columns))
+        for i, column := range columns {
+          values[i] = column.value(item)
+        }
+        err = writer.Write(values...)
+      }
+      if err != nil {
+        println("Failed to write exported row:", err.Error())
+        return
+      }
+    }
+
+    if err := rows.Err(); err != nil {
+      println("Failed to read exported rows:", err.Error())
+      return
+    }
+    if err := writer.Close(); err != nil {
+      println("Failed to finish export:", err.Error())
+    }
+  })
+}
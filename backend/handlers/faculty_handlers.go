@@ -0,0 +1,255 @@
+package handlers
+
+import (
+  "context"
+  "errors"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+const facultyColumns = `id, name, date_of_birth, info, roles, active`
+
+func scanFaculty(row interface{ Scan(dest ...any) error }, faculty *models.Faculty) error {
+  return row.Scan(
+    &faculty.ID,
+    &faculty.Name,
+    &faculty.DateOfBirth,
+    &faculty.Info,
+    &faculty.Roles,
+    &faculty.Active,
+  )
+}
+
+func CreateFacultyMember(c fiber.Ctx) error {
+  faculty := new(models.Faculty)
+
+  if err := c.Bind().JSON(faculty); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if faculty.Name == "" {
+    return sendBadRequestError(c, "Faculty name is required")
+  }
+  if faculty.DateOfBirth.IsZero() {
+    return sendBadRequestError(c, "Faculty date of birth is required")
+  }
+  if len(faculty.Password) > maxPasswordLength {
+    return sendBadRequestError(c, "Password is too long")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  if faculty.Roles == nil {
+    faculty.Roles = []string{"instructor"}
+  }
+
+  // Same as for students, the date of birth is a one time default password
+  password := faculty.Password
+  mustChangePassword := password == ""
+  if mustChangePassword {
+    password = faculty.DateOfBirth.Format(dobPasswordLayout)
+  }
+
+  passwordHash, err := hashPassword(password)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  var newFacultyID int
+  query := `SELECT create_faculty($1, $2, $3, $4, $5, $6, $7, $8)`
+  err = database.DB.QueryRow(context.Background(), query,
+    faculty.Name,
+    passwordHash,
+    faculty.DateOfBirth,
+    faculty.Info,
+    faculty.Roles,
+    mustChangePassword,
+    userID,
+    userRole,
+  ).Scan(&newFacultyID)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  createdFaculty := models.Faculty{}
+  getFacultyQuery := `SELECT ` + facultyColumns + ` FROM get_faculty_by_id($1, $2, $3)`
+  err = scanFaculty(database.DB.QueryRow(context.Background(), getFacultyQuery, newFacultyID, userID, userRole), &createdFaculty)
+  if err != nil {
+    return sendInternalServerError(c, errors.New("Failed to retrieve created faculty"))
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(createdFaculty)
+}
+
+func GetFacultyMembers(c fiber.Ctx) error {
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  page, err := parsePageRequest(c, []string{"id", "name", "date_of_birth"}, "id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  active, err := queryBool(c, "active")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  query := `SELECT ` + facultyColumns + `, sort_value, total_count FROM get_faculty_page($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+  rows, err := database.DB.Query(context.Background(), query,
+    userID,
+    userRole,
+    active,
+    queryString(c, "role"),
+    queryString(c, "name"),
+    page.sort,
+    page.descending,
+    page.afterValue,
+    page.afterID,
+    page.queryLimit(""),
+  )
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  facultyMembers := []models.Faculty{}
+  keys := []pageKey{}
+  var totalCount int64
+  for rows.Next() {
+    faculty := models.Faculty{}
+    key := pageKey{}
+    if err := rows.Scan(
+      &faculty.ID,
+      &faculty.Name,
+      &faculty.DateOfBirth,
+      &faculty.Info,
+      &faculty.Roles,
+      &faculty.Active,
+      &key.value,
+      &totalCount,
+    ); err != nil {
+      return sendInternalServerError(c, err)
+    }
+    key.id = faculty.ID
+    facultyMembers = append(facultyMembers, faculty)
+    keys = append(keys, key)
+  }
+
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(newPage(page, facultyMembers, keys, totalCount))
+}
+
+func GetFacultyMember(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid faculty ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  faculty := models.Faculty{}
+  query := `SELECT ` + facultyColumns + ` FROM get_faculty_by_id($1, $2, $3)`
+  err = scanFaculty(database.DB.QueryRow(context.Background(), query, id, userID, userRole), &faculty)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(faculty)
+}
+
+func UpdateFacultyMember(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid faculty ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  faculty := new(models.Faculty)
+  if err := c.Bind().JSON(faculty); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if faculty.Name == "" {
+    return sendBadRequestError(c, "Faculty name is required")
+  }
+  if faculty.DateOfBirth.IsZero() {
+    return sendBadRequestError(c, "Faculty date of birth is required")
+  }
+
+  if len(faculty.Password) > maxPasswordLength {
+    return sendBadRequestError(c, "Password is too long")
+  }
+
+  // A password set by an administrator is temporary
+  var passwordHash *string
+  if faculty.Password != "" {
+    hash, err := hashPassword(faculty.Password)
+    if err != nil {
+      return sendInternalServerError(c, err)
+    }
+    passwordHash = &hash
+  }
+
+  query := `CALL update_faculty($1, $2, $3, $4, $5, $6, $7, $8)`
+  _, err = database.DB.Exec(context.Background(), query,
+    id,
+    faculty.Name,
+    faculty.DateOfBirth,
+    faculty.Info,
+    faculty.Roles,
+    passwordHash,
+    userID,
+    userRole,
+  )
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  // Permissions are embedded in access tokens, so sign the member out to apply changed roles,
+  // and a reset password must not leave sessions opened with the old one
+  if faculty.Roles != nil || passwordHash != nil {
+    if err := revokeUserSessions(id, "faculty"); err != nil {
+      return handleDatabaseError(c, err)
+    }
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Faculty updated successfully"})
+}
+
+func DeactivateFacultyMember(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid faculty ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL deactivate_faculty($1, $2, $3)`
+  _, err = database.DB.Exec(context.Background(), query, id, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  // Sign the deactivated member out everywhere
+  if err := revokeUserSessions(id, "faculty"); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Faculty deactivated successfully"})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/config"
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Cumulative GPA and per semester breakdown, calculated by the same functions the transcript uses
+func loadGPAReport(studentID int, userID int, userRole string) (models.GPAReport, error) {
+  // How a course graded in several semesters counts towards the GPA
+  gpaRetakePolicy := config.Current.GPARetakePolicy
+  report := models.GPAReport{StudentID: studentID, RetakePolicy: gpaRetakePolicy, Semesters: []models.SemesterGPA{}}
+
+  query := `SELECT calculate_student_gpa($1, $2, $3, $4)`
+  err := database.DB.QueryRow(context.Background(), query, studentID, userID, userRole, gpaRetakePolicy).Scan(&report.GPA)
+  if err != nil {
+    return models.GPAReport{}, err
+  }
+
+  query = `SELECT semester, term_name, sgpa, sgpa_mark, credits_attempted, credits_earned, cgpa, cgpa_mark FROM get_student_gpa_breakdown($1, $2, $3, $4)`
+  rows, err := database.DB.Query(context.Background(), query, studentID, userID, userRole, gpaRetakePolicy)
+  if err != nil {
+    return models.GPAReport{}, err
+  }
+  defer rows.Close()
+
+  for rows.Next() {
+    semester := models.SemesterGPA{}
+    err := rows.Scan(
+      &semester.Semester,
+      &semester.TermName,
+      &semester.SGPA,
+      &semester.SGPAMark,
+      &semester.CreditsAttempted,
+      &semester.CreditsEarned,
+      &semester.CGPA,
+      &semester.CGPAMark,
+    )
+    if err != nil {
+      return models.GPAReport{}, err
+    }
+    report.CreditsAttempted += semester.CreditsAttempted
+    report.CreditsEarned += semester.CreditsEarned
+    // The cumulative GPA after the last semester is the GPA
+    report.GPAMark = semester.CGPAMark
+    report.Semesters = append(report.Semesters, semester)
+  }
+
+  return report, rows.Err()
+}
+
+func CalculateGPA(c fiber.Ctx) error {
+  studentID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid student ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  report, err := loadGPAReport(studentID, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(report)
+}
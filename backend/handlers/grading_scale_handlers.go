@@ -0,0 +1,146 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Scales with their programs and marks, scaleID nil loads all of them
+func loadGradingScales(scaleID *int) ([]models.GradingScale, error) {
+  query := `SELECT id, name, is_default, programs, marks FROM get_grading_scales($1)`
+  rows, err := database.DB.Query(context.Background(), query, scaleID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  scales := []models.GradingScale{}
+  for rows.Next() {
+    scale := models.GradingScale{}
+    if err := rows.Scan(&scale.ID, &scale.Name, &scale.IsDefault, &scale.Programs, &scale.Marks); err != nil {
+      return nil, err
+    }
+    scales = append(scales, scale)
+  }
+
+  return scales, rows.Err()
+}
+
+func GetGradingScales(c fiber.Ctx) error {
+  scales, err := loadGradingScales(nil)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(scales)
+}
+
+func GetGradingScale(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid grading scale ID")
+  }
+
+  scales, err := loadGradingScales(&id)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(scales[0])
+}
+
+func CreateGradingScale(c fiber.Ctx) error {
+  scale := new(models.GradingScale)
+  if err := c.Bind().JSON(scale); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if scale.Name == "" || len(scale.Marks) == 0 {
+    return sendBadRequestError(c, "Grading scale name and marks are required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  var newScaleID int
+  query := `SELECT create_grading_scale($1, $2, $3, $4, $5, $6)`
+  err := database.DB.QueryRow(context.Background(), query,
+    scale.Name,
+    scale.IsDefault,
+    scale.Programs,
+    scale.Marks,
+    userID,
+    userRole,
+  ).Scan(&newScaleID)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  scales, err := loadGradingScales(&newScaleID)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(scales[0])
+}
+
+func UpdateGradingScale(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid grading scale ID")
+  }
+
+  scale := new(models.GradingScale)
+  if err := c.Bind().JSON(scale); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if scale.Name == "" || len(scale.Marks) == 0 {
+    return sendBadRequestError(c, "Grading scale name and marks are required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL update_grading_scale($1, $2, $3, $4, $5, $6, $7)`
+  _, err = database.DB.Exec(context.Background(), query,
+    id,
+    scale.Name,
+    scale.IsDefault,
+    scale.Programs,
+    scale.Marks,
+    userID,
+    userRole,
+  )
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Grading scale updated successfully"})
+}
+
+func DeleteGradingScale(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid grading scale ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL delete_grading_scale($1, $2, $3)`
+  _, err = database.DB.Exec(context.Background(), query, id, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Grading scale deleted successfully"})
+}
@@ -3,13 +3,17 @@ package handlers
 import (
   "context"
   "errors"
+  "fmt"
   "strconv"
+  "strings"
   "time"
 
   "backend/database"
   "backend/models"
 
+  "github.com/goccy/go-json"
   "github.com/gofiber/fiber/v3"
+  "github.com/jackc/pgx/v5"
   "github.com/jackc/pgx/v5/pgconn"
 )
 
@@ -22,42 +26,75 @@ func sendBadRequestError(c fiber.Ctx, message string) error {
   return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": message})
 }
 
+/// Reports weather err is an exception raised by PL/SQL with exactly the given message
+func isRaisedException(err error, message string) bool {
+  var pgErr *pgconn.PgError
+  return errors.As(err, &pgErr) && pgErr.Code == "P0001" && pgErr.Message == message
+}
+
 func handleDatabaseError(c fiber.Ctx, err error) error {
   println("Database Error:", err.Error())
+  defer recordDatabaseError(c, err)
   if pgErr, ok := err.(*pgconn.PgError); ok {
     switch pgErr.Code {
     case "P0001":
       switch pgErr.Message {
-      case "Invalid credentials":
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
-      case "Student not found", "Course not found", "Enrollment not found", "Grade not found":
+      case "Prerequisites not met":
+        // create_enrollment lists the unmet requirements as JSON in the detail
+        unmet := []models.CoursePrerequisite{}
+        if err := json.Unmarshal([]byte(pgErr.Detail), &unmet); err != nil {
+          return sendInternalServerError(c, err)
+        }
+        return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": pgErr.Message, "unmet_requirements": unmet})
+      case "Invalid credentials", "Invalid refresh token":
+        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": pgErr.Message})
+      case "Student not found", "Course not found", "Enrollment not found", "Grade not found", "Faculty not found",
+        "Instructor is not assigned to this course", "Transcript document not found", "Grading scale not found", "Term not found",
+        "Section not found", "Waitlist entry not found":
         return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": pgErr.Message})
       case "Access denied. Invalid user role.",
         "Access denied. Students can only view their own details.",
-        "Access denied. Only faculty can update student details.",
-        "Access denied. Only faculty can create courses.",
-        "Access denied. Only faculty can update courses.",
-        "Access denied. Only faculty can delete courses.",
-        "Access denied. Only faculty can create enrollments.",
         "Access denied. Students can only view their own enrollments.",
-        "Access denied. Only faculty can delete enrollments.",
-        "Access denied. Only faculty can add grades.",
         "Access denied. Students can only view grades for their own enrollments.",
-        "Access denied. Only faculty can update grades.",
-        "Access denied. Only faculty can delete grades.",
         "Access denied. Students can only view their own transcript.",
         "Access denied. Students can only calculate their own GPA.":
         return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": pgErr.Message})
       case "Student name is required", "Student date of birth is required",
         "Course code is required", "Course title is required", "Positive credits are required",
         "Student ID and Course ID are required", "Invalid student ID or course ID",
-        "Enrollment ID and Semester are required", "Invalid enrollment ID":
+        "Enrollment ID is required", "Invalid enrollment ID", "Password is required",
+        "Faculty name is required", "Faculty date of birth is required", "Administrators can not revoke their own access",
+        "Invalid sort field", "Invalid cursor", "Search query is required", "Invalid retake policy",
+        "Grading scale name is required", "Invalid mark definition", "Duplicate mark in grading scale",
+        "Grading scale needs at least one graded mark", "Invalid grading scale ID",
+        "Term ID is required", "Term name is required", "Term dates are required", "Term must start before it ends",
+        "Enrollment must open before it closes", "Grades can not be due before the term starts", "Term IDs must follow the order of start dates",
+        "Invalid term ID", "Invalid section ID", "Section number is required", "Positive capacity is required",
+        "Section does not belong to the course and term", "Section ID is required for this course",
+        "Invalid prerequisite definition", "A course can not require itself", "Invalid prerequisite course ID":
         return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": pgErr.Message})
-      case "Course with code already exists", "Student is already enrolled in this course", "Grade for this enrollment and semester already exists":
+      case "Course with code already exists", "Student is already enrolled in this course", "Grade for this enrollment and semester already exists",
+        "Two-factor authentication is already enabled", "Instructor is already assigned to this course",
+        "Grading scale with name already exists", "The default grading scale can not be deleted",
+        "Term with ID or name already exists", "Term has enrollments or grades",
+        "Section already exists for this course and term", "Section has enrollments", "Student is already on the waitlist of this section",
+        "Duplicate prerequisite in group", "Prerequisites can not form a cycle":
         return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": pgErr.Message})
       default:
+        if strings.HasPrefix(pgErr.Message, "Invalid role ") {
+          return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": pgErr.Message})
+        }
         return sendInternalServerError(c, errors.New("Database operation failed"))
       }
+    case "42501":
+      // Raised by require_permission and require_course_instructor
+      return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": pgErr.Message})
+    case "22023":
+      // Raised by resolve_grade for grades that do not fit the grading scale, and for unknown terms
+      return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": pgErr.Message})
+    case "55000":
+      // Raised by require_enrollment_open and require_grading_open outside the windows of a term
+      return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": pgErr.Message})
     case "23505":
       return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Duplicate entry violates unique constraint"})
     default:
@@ -80,24 +117,43 @@ func CreateStudent(c fiber.Ctx) error {
   if student.DateOfBirth.IsZero() {
     return sendBadRequestError(c, "Student date of birth is required")
   }
+  if len(student.Password) > maxPasswordLength {
+    return sendBadRequestError(c, "Password is too long")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  // Without an explicit password the date of birth is used once, and must be changed on first login
+  password := student.Password
+  mustChangePassword := password == ""
+  if mustChangePassword {
+    password = student.DateOfBirth.Format(dobPasswordLayout)
+  }
+
+  passwordHash, err := hashPassword(password)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
 
   var newStudentID int
-  query := `SELECT create_student($1, $2, $3, $4, $5, $6)`
-  err := database.DB.QueryRow(context.Background(), query,
+  query := `SELECT create_student($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+  err = database.DB.QueryRow(context.Background(), query,
     student.Name,
-    student.Password,
+    passwordHash,
     student.DateOfBirth,
     student.Address,
     student.Contact,
     student.Program,
+    mustChangePassword,
+    userID,
+    userRole,
   ).Scan(&newStudentID)
 
   if err != nil {
     return handleDatabaseError(c, err)
   }
 
-  userRole := c.Locals("userRole").(string)
-  userID := c.Locals("userID").(int)
   createdStudent := models.Student{}
   getStudentQuery := `SELECT id, name, date_of_birth, address, contact, program FROM get_student_by_id($1, $2, $3)`
   err = database.DB.QueryRow(context.Background(), getStudentQuery, newStudentID, userID, userRole).Scan(
@@ -120,37 +176,68 @@ func GetStudents(c fiber.Ctx) error {
   userRole := c.Locals("userRole").(string)
   userID := c.Locals("userID").(int)
 
-  query := `SELECT id, name, password, date_of_birth, address, contact, program FROM get_students($1, $2)`
-  rows, err := database.DB.Query(context.Background(), query, userID, userRole)
+  page, err := parsePageRequest(c, []string{"id", "name", "date_of_birth", "program"}, "id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  format, err := exportFormat(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  query := `SELECT id, name, date_of_birth, address, contact, program, sort_value, total_count FROM get_students_page($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+  rows, err := database.DB.Query(context.Background(), query,
+    userID,
+    userRole,
+    queryString(c, "program"),
+    queryString(c, "name"),
+    page.sort,
+    page.descending,
+    page.afterValue,
+    page.afterID,
+    page.queryLimit(format),
+  )
   if err != nil {
     return handleDatabaseError(c, err)
   }
+
+  if format != "" {
+    return streamExport(c, format, "students", studentExportColumns, rows, func(rows pgx.Rows, student *models.Student) error {
+      var sortValue string
+      var totalCount int64
+      return rows.Scan(&student.ID, &student.Name, &student.DateOfBirth, &student.Address, &student.Contact, &student.Program, &sortValue, &totalCount)
+    })
+  }
   defer rows.Close()
 
   students := []models.Student{}
+  keys := []pageKey{}
+  var totalCount int64
   for rows.Next() {
     student := models.Student{}
-    var password string
+    key := pageKey{}
     if err := rows.Scan(
       &student.ID,
       &student.Name,
-      &password,
       &student.DateOfBirth,
       &student.Address,
       &student.Contact,
       &student.Program,
+      &key.value,
+      &totalCount,
     ); err != nil {
       return sendInternalServerError(c, err)
     }
-    student.Password = ""
+    key.id = student.ID
     students = append(students, student)
+    keys = append(keys, key)
   }
 
   if err := rows.Err(); err != nil {
-    return sendInternalServerError(c, err)
+    return handleDatabaseError(c, err)
   }
 
-  return c.JSON(students)
+  return c.JSON(newPage(page, students, keys, totalCount))
 }
 
 func GetStudent(c fiber.Ctx) error {
@@ -204,7 +291,21 @@ func UpdateStudent(c fiber.Ctx) error {
     return sendBadRequestError(c, "Student date of birth is required")
   }
 
-  query := `CALL update_student($1, $2, $3, $4, $5, $6, $7, $8)`
+  if len(student.Password) > maxPasswordLength {
+    return sendBadRequestError(c, "Password is too long")
+  }
+
+  // A password set by faculty is temporary, the student has to change it on next login
+  var passwordHash *string
+  if student.Password != "" {
+    hash, err := hashPassword(student.Password)
+    if err != nil {
+      return sendInternalServerError(c, err)
+    }
+    passwordHash = &hash
+  }
+
+  query := `CALL update_student($1, $2, $3, $4, $5, $6, $7, $8, $9)`
   _, err = database.DB.Exec(context.Background(), query,
     id,
     student.Name,
@@ -212,6 +313,7 @@ func UpdateStudent(c fiber.Ctx) error {
     student.Address,
     student.Contact,
     student.Program,
+    passwordHash,
     userID,
     userRole,
   )
@@ -257,11 +359,12 @@ func CreateCourse(c fiber.Ctx) error {
   }
 
   var newCourseID int
-  query := `SELECT create_course($1, $2, $3, $4, $5)`
+  query := `SELECT create_course($1, $2, $3, $4, $5, $6)`
   err := database.DB.QueryRow(context.Background(), query,
     course.Code,
     course.Title,
     course.Credits,
+    course.GradingScaleID,
     userID,
     userRole,
   ).Scan(&newCourseID)
@@ -271,12 +374,13 @@ func CreateCourse(c fiber.Ctx) error {
   }
 
   createdCourse := models.Course{}
-  getCourseQuery := `SELECT id, code, title, credits FROM get_course_by_id($1)`
+  getCourseQuery := `SELECT id, code, title, credits, grading_scale_id FROM get_course_by_id($1)`
   err = database.DB.QueryRow(context.Background(), getCourseQuery, newCourseID).Scan(
     &createdCourse.ID,
     &createdCourse.Code,
     &createdCourse.Title,
     &createdCourse.Credits,
+    &createdCourse.GradingScaleID,
   )
   if err != nil {
     return sendInternalServerError(c, errors.New("Failed to retrieve created course"))
@@ -286,27 +390,61 @@ func CreateCourse(c fiber.Ctx) error {
 }
 
 func GetCourses(c fiber.Ctx) error {
-  query := `SELECT id, code, title, credits FROM get_all_courses()`
-  rows, err := database.DB.Query(context.Background(), query)
+  page, err := parsePageRequest(c, []string{"id", "code", "title", "credits"}, "id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  gradingScaleID, err := queryInt(c, "grading_scale_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  format, err := exportFormat(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  query := `SELECT id, code, title, credits, grading_scale_id, sort_value, total_count FROM get_courses_page($1, $2, $3, $4, $5, $6, $7)`
+  rows, err := database.DB.Query(context.Background(), query,
+    queryString(c, "code"),
+    gradingScaleID,
+    page.sort,
+    page.descending,
+    page.afterValue,
+    page.afterID,
+    page.queryLimit(format),
+  )
   if err != nil {
     return handleDatabaseError(c, err)
   }
+
+  if format != "" {
+    return streamExport(c, format, "courses", courseExportColumns, rows, func(rows pgx.Rows, course *models.Course) error {
+      var sortValue string
+      var totalCount int64
+      return rows.Scan(&course.ID, &course.Code, &course.Title, &course.Credits, &course.GradingScaleID, &sortValue, &totalCount)
+    })
+  }
   defer rows.Close()
 
   courses := []models.Course{}
+  keys := []pageKey{}
+  var totalCount int64
   for rows.Next() {
     course := models.Course{}
-    if err := rows.Scan(&course.ID, &course.Code, &course.Title, &course.Credits); err != nil {
+    key := pageKey{}
+    if err := rows.Scan(&course.ID, &course.Code, &course.Title, &course.Credits, &course.GradingScaleID, &key.value, &totalCount); err != nil {
       return sendInternalServerError(c, err)
     }
+    key.id = course.ID
     courses = append(courses, course)
+    keys = append(keys, key)
   }
 
   if err := rows.Err(); err != nil {
-    return sendInternalServerError(c, err)
+    return handleDatabaseError(c, err)
   }
 
-  return c.JSON(courses)
+  return c.JSON(newPage(page, courses, keys, totalCount))
 }
 
 func GetCourse(c fiber.Ctx) error {
@@ -316,8 +454,8 @@ func GetCourse(c fiber.Ctx) error {
   }
 
   course := models.Course{}
-  query := `SELECT id, code, title, credits FROM get_course_by_id($1)`
-  err = database.DB.QueryRow(context.Background(), query, id).Scan(&course.ID, &course.Code, &course.Title, &course.Credits)
+  query := `SELECT id, code, title, credits, grading_scale_id FROM get_course_by_id($1)`
+  err = database.DB.QueryRow(context.Background(), query, id).Scan(&course.ID, &course.Code, &course.Title, &course.Credits, &course.GradingScaleID)
 
   if err != nil {
     return handleDatabaseError(c, err)
@@ -344,12 +482,13 @@ func UpdateCourse(c fiber.Ctx) error {
     return sendBadRequestError(c, "Course code, title, and positive credits are required")
   }
 
-  query := `CALL update_course($1, $2, $3, $4, $5, $6)`
+  query := `CALL update_course($1, $2, $3, $4, $5, $6, $7)`
   _, err = database.DB.Exec(context.Background(), query,
     id,
     course.Code,
     course.Title,
     course.Credits,
+    course.GradingScaleID,
     userID,
     userRole,
   )
@@ -393,26 +532,49 @@ func EnrollStudent(c fiber.Ctx) error {
   if enrollment.StudentID == 0 || enrollment.CourseID == 0 {
     return sendBadRequestError(c, "Student ID and Course ID are required")
   }
+  if enrollment.TermID == 0 {
+    return sendBadRequestError(c, "Term ID is required")
+  }
 
-  var newEnrollmentID int
-  var enrollmentDate time.Time
-  query := `SELECT v_id, v_date FROM create_enrollment($1, $2, $3, $4)`
+  var newEnrollmentID, waitlistID, waitlistPosition *int
+  var enrollmentDate *time.Time
+  query := `SELECT v_id, v_date, v_waitlist_id, v_waitlist_position FROM create_enrollment($1, $2, $3, $4, $5, $6, $7, $8)`
   err := database.DB.QueryRow(context.Background(), query,
     enrollment.StudentID,
     enrollment.CourseID,
+    enrollment.TermID,
+    enrollment.SectionID,
+    enrollment.OverridePrerequisites,
+    enrollment.OverrideReason,
     userID,
     userRole,
-  ).Scan(&newEnrollmentID, &enrollmentDate)
+  ).Scan(&newEnrollmentID, &enrollmentDate, &waitlistID, &waitlistPosition)
 
   if err != nil {
     return handleDatabaseError(c, err)
   }
 
+  // The section is full, the student is enrolled once a seat frees up
+  if newEnrollmentID == nil {
+    entries, err := loadStudentWaitlist(enrollment.StudentID, userID, userRole)
+    if err != nil {
+      return handleDatabaseError(c, err)
+    }
+    for _, entry := range entries {
+      if entry.ID == *waitlistID {
+        return c.Status(fiber.StatusAccepted).JSON(entry)
+      }
+    }
+    return sendInternalServerError(c, fmt.Errorf("waitlist entry %d not found", *waitlistID))
+  }
+
   createdEnrollment := models.Enrollment{
-    ID: newEnrollmentID,
+    ID: *newEnrollmentID,
     StudentID: enrollment.StudentID,
     CourseID: enrollment.CourseID,
-    EnrollmentDate: enrollmentDate,
+    TermID: enrollment.TermID,
+    SectionID: enrollment.SectionID,
+    EnrollmentDate: *enrollmentDate,
   }
 
   return c.Status(fiber.StatusCreated).JSON(createdEnrollment)
@@ -422,38 +584,89 @@ func GetEnrollments(c fiber.Ctx) error {
   userRole := c.Locals("userRole").(string)
   userID := c.Locals("userID").(int)
 
-  studentIDParam := c.Query("student_id")
-  var filterStudentID *int
-  if studentIDParam != "" {
-    id, err := strconv.Atoi(studentIDParam)
-    if err != nil {
-      return sendBadRequestError(c, "Invalid student_id query parameter")
-    }
-    filterStudentID = &id
+  page, err := parsePageRequest(c, []string{"id", "enrollment_date", "student_id", "course_id", "term_id"}, "id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  format, err := exportFormat(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  filterStudentID, err := queryInt(c, "student_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  courseID, err := queryInt(c, "course_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  termID, err := queryInt(c, "term_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  sectionID, err := queryInt(c, "section_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  enrolledFrom, err := queryDate(c, "from")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  enrolledTo, err := queryDate(c, "to")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
   }
 
-  query := `SELECT id, student_id, course_id, enrollment_date FROM get_enrollments($1, $2, $3)`
-  rows, err := database.DB.Query(context.Background(), query, userID, userRole, filterStudentID)
+  query := `SELECT id, student_id, course_id, term_id, section_id, enrollment_date, sort_value, total_count FROM get_enrollments_page($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+  rows, err := database.DB.Query(context.Background(), query,
+    userID,
+    userRole,
+    filterStudentID,
+    courseID,
+    termID,
+    sectionID,
+    enrolledFrom,
+    enrolledTo,
+    page.sort,
+    page.descending,
+    page.afterValue,
+    page.afterID,
+    page.queryLimit(format),
+  )
 
   if err != nil {
     return handleDatabaseError(c, err)
   }
+
+  if format != "" {
+    return streamExport(c, format, "enrollments", enrollmentExportColumns, rows, func(rows pgx.Rows, enrollment *models.Enrollment) error {
+      var sortValue string
+      var totalCount int64
+      return rows.Scan(&enrollment.ID, &enrollment.StudentID, &enrollment.CourseID, &enrollment.TermID, &enrollment.SectionID, &enrollment.EnrollmentDate, &sortValue, &totalCount)
+    })
+  }
   defer rows.Close()
 
   enrollments := []models.Enrollment{}
+  keys := []pageKey{}
+  var totalCount int64
   for rows.Next() {
     enrollment := models.Enrollment{}
-    if err := rows.Scan(&enrollment.ID, &enrollment.StudentID, &enrollment.CourseID, &enrollment.EnrollmentDate); err != nil {
+    key := pageKey{}
+    if err := rows.Scan(&enrollment.ID, &enrollment.StudentID, &enrollment.CourseID, &enrollment.TermID, &enrollment.SectionID, &enrollment.EnrollmentDate, &key.value, &totalCount); err != nil {
       return sendInternalServerError(c, err)
     }
+    key.id = enrollment.ID
     enrollments = append(enrollments, enrollment)
+    keys = append(keys, key)
   }
 
   if err := rows.Err(); err != nil {
-    return sendInternalServerError(c, err)
+    return handleDatabaseError(c, err)
   }
 
-  return c.JSON(enrollments)
+  return c.JSON(newPage(page, enrollments, keys, totalCount))
 }
 
 func GetEnrollment(c fiber.Ctx) error {
@@ -466,11 +679,13 @@ func GetEnrollment(c fiber.Ctx) error {
   userID := c.Locals("userID").(int)
 
   enrollment := models.Enrollment{}
-  query := `SELECT id, student_id, course_id, enrollment_date FROM get_enrollment_by_id($1, $2, $3)`
+  query := `SELECT id, student_id, course_id, term_id, section_id, enrollment_date FROM get_enrollment_by_id($1, $2, $3)`
   err = database.DB.QueryRow(context.Background(), query, id, userID, userRole).Scan(
     &enrollment.ID,
     &enrollment.StudentID,
     &enrollment.CourseID,
+    &enrollment.TermID,
+    &enrollment.SectionID,
     &enrollment.EnrollmentDate,
   )
 
@@ -510,15 +725,16 @@ func AddGrade(c fiber.Ctx) error {
   userRole := c.Locals("userRole").(string)
   userID := c.Locals("userID").(int)
 
-  if grade.EnrollmentID == 0 || grade.Semester == 0 {
-    return sendBadRequestError(c, "Enrollment ID and Semester are required")
+  if grade.EnrollmentID == 0 {
+    return sendBadRequestError(c, "Enrollment ID is required")
   }
 
   var newGradeID int
-  query := `SELECT add_grade($1, $2, $3, $4, $5)`
+  query := `SELECT add_grade($1, $2, $3, $4, $5, $6)`
   err := database.DB.QueryRow(context.Background(), query,
     grade.EnrollmentID,
     grade.Grade,
+    grade.Mark,
     grade.Semester,
     userID,
     userRole,
@@ -529,11 +745,12 @@ func AddGrade(c fiber.Ctx) error {
   }
 
   createdGrade := models.Grade{}
-  getGradeQuery := `SELECT id, enrollment_id, grade, semester FROM get_grade_by_id($1, $2, $3)`
+  getGradeQuery := `SELECT id, enrollment_id, grade, mark, semester FROM get_grade_by_id($1, $2, $3)`
   err = database.DB.QueryRow(context.Background(), getGradeQuery, newGradeID, userID, userRole).Scan(
     &createdGrade.ID,
     &createdGrade.EnrollmentID,
     &createdGrade.Grade,
+    &createdGrade.Mark,
     &createdGrade.Semester,
   )
   if err != nil {
@@ -547,28 +764,74 @@ func GetGrades(c fiber.Ctx) error {
   userRole := c.Locals("userRole").(string)
   userID := c.Locals("userID").(int)
 
-  query := `SELECT id, enrollment_id, grade, semester FROM get_all_grades($1, $2)`
-  rows, err := database.DB.Query(context.Background(), query, userID, userRole)
+  page, err := parsePageRequest(c, []string{"id", "semester", "grade", "enrollment_id"}, "id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  format, err := exportFormat(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  semester, err := queryInt(c, "semester")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  minGrade, err := queryFloat(c, "min_grade")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  maxGrade, err := queryFloat(c, "max_grade")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  query := `SELECT id, enrollment_id, grade, mark, semester, sort_value, total_count FROM get_grades_page($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+  rows, err := database.DB.Query(context.Background(), query,
+    userID,
+    userRole,
+    semester,
+    minGrade,
+    maxGrade,
+    page.sort,
+    page.descending,
+    page.afterValue,
+    page.afterID,
+    page.queryLimit(format),
+  )
 
   if err != nil {
     return handleDatabaseError(c, err)
   }
+
+  if format != "" {
+    return streamExport(c, format, "grades", gradeExportColumns, rows, func(rows pgx.Rows, grade *models.Grade) error {
+      var sortValue string
+      var totalCount int64
+      return rows.Scan(&grade.ID, &grade.EnrollmentID, &grade.Grade, &grade.Mark, &grade.Semester, &sortValue, &totalCount)
+    })
+  }
   defer rows.Close()
 
   grades := []models.Grade{}
+  keys := []pageKey{}
+  var totalCount int64
   for rows.Next() {
     grade := models.Grade{}
-    if err := rows.Scan(&grade.ID, &grade.EnrollmentID, &grade.Grade, &grade.Semester); err != nil {
+    key := pageKey{}
+    if err := rows.Scan(&grade.ID, &grade.EnrollmentID, &grade.Grade, &grade.Mark, &grade.Semester, &key.value, &totalCount); err != nil {
       return sendInternalServerError(c, err)
     }
+    key.id = grade.ID
     grades = append(grades, grade)
+    keys = append(keys, key)
   }
 
   if err := rows.Err(); err != nil {
-    return sendInternalServerError(c, err)
+    return handleDatabaseError(c, err)
   }
 
-  return c.JSON(grades)
+  return c.JSON(newPage(page, grades, keys, totalCount))
 }
 
 func GetGrade(c fiber.Ctx) error {
@@ -581,11 +844,12 @@ func GetGrade(c fiber.Ctx) error {
   userID := c.Locals("userID").(int)
 
   grade := models.Grade{}
-  query := `SELECT id, enrollment_id, grade, semester FROM get_grade_by_id($1, $2, $3)`
+  query := `SELECT id, enrollment_id, grade, mark, semester FROM get_grade_by_id($1, $2, $3)`
   err = database.DB.QueryRow(context.Background(), query, id, userID, userRole).Scan(
     &grade.ID,
     &grade.EnrollmentID,
     &grade.Grade,
+    &grade.Mark,
     &grade.Semester,
   )
 
@@ -610,15 +874,16 @@ func UpdateGrade(c fiber.Ctx) error {
     return sendBadRequestError(c, "Invalid request body")
   }
 
-  if grade.EnrollmentID == 0 || grade.Semester == 0 {
-    return sendBadRequestError(c, "Enrollment ID and Semester are required")
+  if grade.EnrollmentID == 0 {
+    return sendBadRequestError(c, "Enrollment ID is required")
   }
 
-  query := `CALL update_grade($1, $2, $3, $4, $5, $6)`
+  query := `CALL update_grade($1, $2, $3, $4, $5, $6, $7)`
   _, err = database.DB.Exec(context.Background(), query,
     id,
     grade.EnrollmentID,
     grade.Grade,
+    grade.Mark,
     grade.Semester,
     userID,
     userRole,
@@ -656,81 +921,77 @@ func GetStudentTranscript(c fiber.Ctx) error {
     return sendBadRequestError(c, "Invalid student ID")
   }
 
+  format, err := exportFormat(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
   userRole := c.Locals("userRole").(string)
   userID := c.Locals("userID").(int)
 
-  query := `SELECT enrollment_id, course_code, course_title, credits, grade_id, grade, semester FROM get_student_transcript($1, $2, $3)`
-  rows, err := database.DB.Query(context.Background(), query, studentID, userID, userRole)
+  if format != "" {
+    query := `SELECT enrollment_id, course_code, course_title, credits, grade_id, grade, mark, semester FROM get_student_transcript($1, $2, $3)`
+    rows, err := database.DB.Query(context.Background(), query, studentID, userID, userRole)
+    if err != nil {
+      return handleDatabaseError(c, err)
+    }
+    return streamExport(c, format, fmt.Sprintf("transcript-%d", studentID), transcriptExportColumns, rows, func(rows pgx.Rows, course *models.TranscriptCourse) error {
+      return rows.Scan(&course.EnrollmentID, &course.CourseCode, &course.CourseTitle, &course.Credits, &course.GradeID, &course.Grade, &course.Mark, &course.Semester)
+    })
+  }
+
+  transcript, err := loadTranscript(studentID, userID, userRole)
   if err != nil {
     return handleDatabaseError(c, err)
   }
+
+  return c.JSON(transcript)
+}
+
+/// Transcript rows of a student together with the student's name
+func loadTranscript(studentID int, userID int, userRole string) (models.StudentTranscript, error) {
+  query := `SELECT enrollment_id, course_code, course_title, credits, grade_id, grade, mark, semester FROM get_student_transcript($1, $2, $3)`
+  rows, err := database.DB.Query(context.Background(), query, studentID, userID, userRole)
+  if err != nil {
+    return models.StudentTranscript{}, err
+  }
   defer rows.Close()
 
   transcriptCourses := []models.TranscriptCourse{}
   for rows.Next() {
     course := models.TranscriptCourse{}
-    var gradeID *int
-    var grade *float64
-    var semester *int
-
     err := rows.Scan(
       &course.EnrollmentID,
       &course.CourseCode,
       &course.CourseTitle,
       &course.Credits,
-      &gradeID,
-      &grade,
-      &semester,
+      &course.GradeID,
+      &course.Grade,
+      &course.Mark,
+      &course.Semester,
     )
     if err != nil {
-      return sendInternalServerError(c, err)
+      return models.StudentTranscript{}, err
     }
 
-    course.GradeID = gradeID
-    course.Grade = grade
-    course.Semester = semester
-
     transcriptCourses = append(transcriptCourses, course)
   }
 
   if err := rows.Err(); err != nil {
-    return sendInternalServerError(c, err)
+    return models.StudentTranscript{}, err
   }
 
   student := models.Student{}
   getStudentQuery := `SELECT id, name FROM get_student_by_id($1, $2, $3)`
   err = database.DB.QueryRow(context.Background(), getStudentQuery, studentID, userID, userRole).Scan(&student.ID, &student.Name)
   if err != nil {
-    return handleDatabaseError(c, err)
+    return models.StudentTranscript{}, err
   }
 
-
-  transcript := models.StudentTranscript{
+  return models.StudentTranscript{
     StudentID:   student.ID,
     StudentName: student.Name,
     Courses:     transcriptCourses,
-  }
-
-  return c.JSON(transcript)
-}
-
-func CalculateGPA(c fiber.Ctx) error {
-  studentID, err := strconv.Atoi(c.Params("id"))
-  if err != nil {
-    return sendBadRequestError(c, "Invalid student ID")
-  }
-
-  userRole := c.Locals("userRole").(string)
-  userID := c.Locals("userID").(int)
-
-  var gpa float64
-  query := `SELECT calculate_student_gpa($1, $2, $3)`
-  err = database.DB.QueryRow(context.Background(), query, studentID, userID, userRole).Scan(&gpa)
-
-  if err != nil {
-    return handleDatabaseError(c, err)
-  }
-
-  return c.Status(fiber.StatusOK).JSON(fiber.Map{"student_id": studentID, "gpa": gpa})
+  }, nil
 }
 
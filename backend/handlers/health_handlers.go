@@ -0,0 +1,83 @@
+package handlers
+
+import (
+  "context"
+  "sync/atomic"
+  "time"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+// Bound on the readiness checks, a load balancer gives up on a probe after a few seconds anyway
+const readinessTimeout = 2 * time.Second
+
+var shuttingDown atomic.Bool
+
+/// Makes /readyz fail so load balancers stop sending new requests while in-flight ones drain
+func BeginShutdown() {
+  shuttingDown.Store(true)
+}
+
+/// Liveness, answers as long as the process serves requests
+func GetHealth(c fiber.Ctx) error {
+  return c.JSON(fiber.Map{"status": "ok"})
+}
+
+/// Readiness, 503 unless the database answers within readinessTimeout at the schema version of this binary
+func GetReadiness(c fiber.Ctx) error {
+  stat := database.DB.Stat()
+  readiness := models.Readiness{
+    Status:                "ready",
+    Database:              "ok",
+    ExpectedSchemaVersion: database.ExpectedSchemaVersion(),
+    Pool: models.PoolStats{
+      TotalConns:           stat.TotalConns(),
+      IdleConns:            stat.IdleConns(),
+      AcquiredConns:        stat.AcquiredConns(),
+      ConstructingConns:    stat.ConstructingConns(),
+      MaxConns:             stat.MaxConns(),
+      AcquireCount:         stat.AcquireCount(),
+      EmptyAcquireCount:    stat.EmptyAcquireCount(),
+      CanceledAcquireCount: stat.CanceledAcquireCount(),
+      AcquireDurationMs:    stat.AcquireDuration().Milliseconds(),
+    },
+  }
+
+  c.Set(fiber.HeaderCacheControl, "no-store")
+
+  if shuttingDown.Load() {
+    readiness.Status = "shutting_down"
+    readiness.Database = "not checked"
+    return c.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+  }
+
+  ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+  defer cancel()
+
+  // The details of connection errors stay in the log, this endpoint is public
+  if err := database.DB.Ping(ctx); err != nil {
+    println("Readiness ping failed:", err.Error())
+    readiness.Status = "not_ready"
+    readiness.Database = "unreachable"
+    return c.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+  }
+
+  version, err := database.SchemaVersion(ctx)
+  if err != nil {
+    println("Readiness schema check failed:", err.Error())
+    readiness.Status = "not_ready"
+    readiness.Database = "schema version unavailable"
+    return c.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+  }
+  readiness.SchemaVersion = version
+  if version != readiness.ExpectedSchemaVersion {
+    readiness.Status = "not_ready"
+    readiness.Database = "schema version mismatch"
+    return c.Status(fiber.StatusServiceUnavailable).JSON(readiness)
+  }
+
+  return c.JSON(readiness)
+}
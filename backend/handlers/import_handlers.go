@@ -0,0 +1,440 @@
+package handlers
+
+import (
+  "context"
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+  "time"
+
+  "backend/database"
+  "backend/models"
+  "backend/tabular"
+
+  "github.com/goccy/go-json"
+  "github.com/gofiber/fiber/v3"
+  "github.com/jackc/pgx/v5"
+  "github.com/jackc/pgx/v5/pgconn"
+)
+
+// A spreadsheet row being imported, line is the 1 based line in the file including the header
+type importRow struct {
+  line       int
+  key        string
+  values     []any
+  errors     []string
+  skipped    bool
+  waitlisted bool
+}
+
+// How one kind of record is imported. parse validates a row on its own like the matching create handler,
+// check validates all rows against the database inside the import transaction. Without create the rows are copied
+// into table, with it every row is created on its own like the create handler does, so it gets the same checks.
+// prepare fills in values of the copied rows that are too costly to compute for a dry run.
+type importer struct {
+  permission      string
+  table           string
+  columns         []string
+  required        []string
+  parse           func(table *tabular.Table, cells []string, row *importRow)
+  check           func(ctx context.Context, tx pgx.Tx, rows []*importRow) error
+  create          func(ctx context.Context, tx pgx.Tx, userID int, userRole string, row *importRow) error
+  prepare         func(values [][]any) error
+  initialPassword string
+}
+
+var studentImporter = importer{
+  permission:      "students:write",
+  table:           "students",
+  columns:         []string{"name", "password", "must_change_password", "date_of_birth", "address", "contact", "program"},
+  required:        []string{"name", "date_of_birth"},
+  initialPassword: "date_of_birth",
+  parse: func(table *tabular.Table, cells []string, row *importRow) {
+    name := table.Get(cells, "name")
+    if name == "" {
+      row.errors = append(row.errors, "Student name is required")
+    }
+    dateOfBirth, err := tabular.ParseDate(table.Get(cells, "date_of_birth"))
+    if table.Get(cells, "date_of_birth") == "" {
+      row.errors = append(row.errors, "Student date of birth is required")
+    } else if err != nil {
+      row.errors = append(row.errors, err.Error())
+    }
+
+    // As for CreateStudent without a password the date of birth is used once, prepare hashes it
+    row.values = []any{
+      name,
+      nil,
+      true,
+      dateOfBirth,
+      table.Get(cells, "address"),
+      table.Get(cells, "contact"),
+      table.Get(cells, "program"),
+    }
+  },
+  prepare: func(values [][]any) error {
+    passwords := []string{}
+    for _, row := range values {
+      passwords = append(passwords, row[3].(time.Time).Format(dobPasswordLayout))
+    }
+    hashes, err := hashPasswords(passwords)
+    if err != nil {
+      return err
+    }
+    for i, row := range values {
+      row[1] = hashes[i]
+    }
+    return nil
+  },
+}
+
+var courseImporter = importer{
+  permission: "courses:write",
+  table:      "courses",
+  columns:    []string{"code", "title", "credits"},
+  required:   []string{"code", "title", "credits"},
+  parse: func(table *tabular.Table, cells []string, row *importRow) {
+    code := table.Get(cells, "code")
+    title := table.Get(cells, "title")
+    if code == "" {
+      row.errors = append(row.errors, "Course code is required")
+    }
+    if title == "" {
+      row.errors = append(row.errors, "Course title is required")
+    }
+    credits, err := strconv.ParseFloat(table.Get(cells, "credits"), 64)
+    if err != nil || credits <= 0 {
+      row.errors = append(row.errors, "Positive credits are required")
+    } else if credits >= 10 {
+      row.errors = append(row.errors, "Credits must be less than 10")
+    }
+
+    row.key = code
+    row.values = []any{code, title, credits}
+  },
+  check: func(ctx context.Context, tx pgx.Tx, rows []*importRow) error {
+    codes := []string{}
+    for _, row := range rows {
+      codes = append(codes, row.key)
+    }
+    existing, err := collectSet[string](ctx, tx, `SELECT get_existing_course_codes($1)`, codes)
+    if err != nil {
+      return err
+    }
+
+    for _, row := range rows {
+      if existing[row.key] {
+        row.skipped = true
+      }
+    }
+    return nil
+  },
+}
+
+// Every row is enrolled through create_enrollment like EnrollStudent, with its enrollment window, section, capacity and
+// prerequisite checks. A row into a full section puts the student on the waitlist, prerequisites can not be overridden.
+var enrollmentImporter = importer{
+  permission: "enrollments:write",
+  required:   []string{"student_id", "course_id", "term_id"},
+  parse: func(table *tabular.Table, cells []string, row *importRow) {
+    studentID, studentErr := strconv.Atoi(table.Get(cells, "student_id"))
+    courseID, courseErr := strconv.Atoi(table.Get(cells, "course_id"))
+    if studentErr != nil || courseErr != nil || studentID == 0 || courseID == 0 {
+      row.errors = append(row.errors, "Student ID and Course ID are required")
+    }
+    termID, termErr := strconv.Atoi(table.Get(cells, "term_id"))
+    if termErr != nil || termID == 0 {
+      row.errors = append(row.errors, "Term ID is required")
+    }
+
+    var sectionID *int
+    if value := table.Get(cells, "section_id"); value != "" {
+      id, err := strconv.Atoi(value)
+      if err != nil || id == 0 {
+        row.errors = append(row.errors, "Invalid section ID")
+      }
+      sectionID = &id
+    }
+
+    if studentErr == nil && courseErr == nil && termErr == nil {
+      row.key = fmt.Sprintf("%d:%d:%d", studentID, courseID, termID)
+    }
+    row.values = []any{studentID, courseID, termID, sectionID}
+  },
+  check: func(ctx context.Context, tx pgx.Tx, rows []*importRow) error {
+    studentIDs := []int{}
+    courseIDs := []int{}
+    termIDs := []int{}
+    for _, row := range rows {
+      studentIDs = append(studentIDs, row.values[0].(int))
+      courseIDs = append(courseIDs, row.values[1].(int))
+      termIDs = append(termIDs, row.values[2].(int))
+    }
+
+    students, err := collectSet[int](ctx, tx, `SELECT get_existing_student_ids($1)`, studentIDs)
+    if err != nil {
+      return err
+    }
+    courses, err := collectSet[int](ctx, tx, `SELECT get_existing_course_ids($1)`, courseIDs)
+    if err != nil {
+      return err
+    }
+    terms, err := collectSet[int](ctx, tx, `SELECT get_existing_term_ids($1)`, termIDs)
+    if err != nil {
+      return err
+    }
+
+    enrolled := map[string]bool{}
+    existing, err := tx.Query(ctx, `SELECT student_id, course_id, term_id FROM get_existing_enrollments($1, $2, $3)`, studentIDs, courseIDs, termIDs)
+    if err != nil {
+      return err
+    }
+    defer existing.Close()
+    for existing.Next() {
+      var studentID, courseID, termID int
+      if err := existing.Scan(&studentID, &courseID, &termID); err != nil {
+        return err
+      }
+      enrolled[fmt.Sprintf("%d:%d:%d", studentID, courseID, termID)] = true
+    }
+    if err := existing.Err(); err != nil {
+      return err
+    }
+
+    for _, row := range rows {
+      if !students[row.values[0].(int)] || !courses[row.values[1].(int)] {
+        row.errors = append(row.errors, "Invalid student ID or course ID")
+      } else if !terms[row.values[2].(int)] {
+        row.errors = append(row.errors, "Invalid term ID")
+      } else if enrolled[row.key] {
+        row.skipped = true
+      }
+    }
+    return nil
+  },
+  create: func(ctx context.Context, tx pgx.Tx, userID int, userRole string, row *importRow) error {
+    var enrollmentID, waitlistID *int
+    query := `SELECT v_id, v_waitlist_id FROM create_enrollment($1, $2, $3, $4, FALSE, NULL, $5, $6)`
+    err := tx.QueryRow(ctx, query, row.values[0], row.values[1], row.values[2], row.values[3], userID, userRole).Scan(&enrollmentID, &waitlistID)
+    if err != nil {
+      return err
+    }
+    row.waitlisted = enrollmentID == nil
+    return nil
+  },
+}
+
+/// Message of an exception a create procedure raised for the row itself, false for anything else
+func importRowError(err error) (string, bool) {
+  pgErr, ok := err.(*pgconn.PgError)
+  if !ok {
+    return "", false
+  }
+  switch pgErr.Code {
+  case "P0001":
+    if pgErr.Message == "Prerequisites not met" {
+      // create_enrollment lists the unmet requirements as JSON in the detail
+      unmet := []models.CoursePrerequisite{}
+      if err := json.Unmarshal([]byte(pgErr.Detail), &unmet); err != nil {
+        return "", false
+      }
+      codes := []string{}
+      for _, requirement := range unmet {
+        codes = append(codes, requirement.RequiredCourseCode)
+      }
+      return pgErr.Message + ": " + strings.Join(codes, ", "), true
+    }
+    return pgErr.Message, true
+  case "22023", "55000":
+    // Unknown terms, and terms whose enrollment window is closed
+    return pgErr.Message, true
+  default:
+    return "", false
+  }
+}
+
+/// Run a single column query and collect the values into a set
+func collectSet[T comparable](ctx context.Context, tx pgx.Tx, query string, args ...any) (map[T]bool, error) {
+  rows, err := tx.Query(ctx, query, args...)
+  if err != nil {
+    return nil, err
+  }
+  values, err := pgx.CollectRows(rows, pgx.RowTo[T])
+  if err != nil {
+    return nil, err
+  }
+
+  set := map[T]bool{}
+  for _, value := range values {
+    set[value] = true
+  }
+  return set, nil
+}
+
+/// Read the uploaded spreadsheet, either the "file" field of a multipart form or the raw request body
+func readUpload(c fiber.Ctx) (*tabular.Table, error) {
+  if header, err := c.FormFile("file"); err == nil {
+    file, err := header.Open()
+    if err != nil {
+      return nil, err
+    }
+    defer file.Close()
+
+    data, err := io.ReadAll(file)
+    if err != nil {
+      return nil, err
+    }
+    return tabular.Read(data, tabular.DetectFormat(header.Filename, header.Header.Get(fiber.HeaderContentType)))
+  }
+
+  return tabular.Read(c.Body(), tabular.DetectFormat("", c.Get(fiber.HeaderContentType)))
+}
+
+func ImportStudents(c fiber.Ctx) error {
+  return runImport(c, studentImporter)
+}
+
+func ImportCourses(c fiber.Ctx) error {
+  return runImport(c, courseImporter)
+}
+
+func ImportEnrollments(c fiber.Ctx) error {
+  return runImport(c, enrollmentImporter)
+}
+
+/// Validate all rows and, unless it is a dry run or any row is invalid, write them in a single transaction.
+/// Rows of an importer with create are created one by one in both cases, a dry run rolls them back at the end.
+func runImport(c fiber.Ctx, imp importer) error {
+  dryRun := c.Query("dry_run") == "true"
+
+  table, err := readUpload(c)
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  if missing := table.Missing(imp.required...); len(missing) > 0 {
+    return sendBadRequestError(c, fmt.Sprintf("Missing required columns: %v", missing))
+  }
+
+  result := models.ImportResult{DryRun: dryRun, Errors: []models.ImportRowError{}}
+  rows := []*importRow{}
+  seen := map[string]int{}
+  for i, cells := range table.Rows {
+    line := i + 2
+    if tabular.IsBlank(cells) {
+      result.SkippedRows = append(result.SkippedRows, line)
+      continue
+    }
+
+    row := &importRow{line: line}
+    imp.parse(table, cells, row)
+    if row.key != "" {
+      if first, ok := seen[row.key]; ok {
+        row.errors = append(row.errors, fmt.Sprintf("Duplicate of row %d", first))
+      } else {
+        seen[row.key] = line
+      }
+    }
+    rows = append(rows, row)
+  }
+  result.Total = len(rows) + len(result.SkippedRows)
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  ctx := context.Background()
+  tx, err := database.DB.Begin(ctx)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  defer tx.Rollback(ctx)
+
+  // Copied rows bypass the procedures, so the permission is checked here for all importers
+  if _, err := tx.Exec(ctx, `CALL require_permission($1, $2, $3)`, userID, userRole, imp.permission); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  valid := []*importRow{}
+  for _, row := range rows {
+    if len(row.errors) == 0 {
+      valid = append(valid, row)
+    }
+  }
+  if imp.check != nil && len(valid) > 0 {
+    if err := imp.check(ctx, tx, valid); err != nil {
+      return handleDatabaseError(c, err)
+    }
+  }
+
+  if imp.create != nil {
+    for _, row := range valid {
+      if row.skipped || len(row.errors) > 0 {
+        continue
+      }
+      // A savepoint per row, so a rejected row does not abort the transaction and the remaining rows are still checked
+      savepoint, err := tx.Begin(ctx)
+      if err != nil {
+        return sendInternalServerError(c, err)
+      }
+      if err := imp.create(ctx, savepoint, userID, userRole, row); err != nil {
+        message, ok := importRowError(err)
+        if !ok {
+          return handleDatabaseError(c, err)
+        }
+        if err := savepoint.Rollback(ctx); err != nil {
+          return sendInternalServerError(c, err)
+        }
+        row.errors = append(row.errors, message)
+        continue
+      }
+      if err := savepoint.Commit(ctx); err != nil {
+        return handleDatabaseError(c, err)
+      }
+    }
+  }
+
+  values := [][]any{}
+  for _, row := range rows {
+    switch {
+    case len(row.errors) > 0:
+      result.Errors = append(result.Errors, models.ImportRowError{Row: row.line, Errors: row.errors})
+    case row.skipped:
+      result.SkippedRows = append(result.SkippedRows, row.line)
+    case row.waitlisted:
+      result.WaitlistedRows = append(result.WaitlistedRows, row.line)
+    default:
+      values = append(values, row.values)
+    }
+  }
+  result.Skipped = len(result.SkippedRows)
+  result.Waitlisted = len(result.WaitlistedRows)
+  result.Created = len(values)
+  result.InitialPassword = imp.initialPassword
+
+  if dryRun {
+    // Rows already created by imp.create are rolled back with the transaction
+    return c.JSON(result)
+  }
+  if len(result.Errors) > 0 {
+    // All or nothing, a single invalid row rejects the whole file
+    return c.Status(fiber.StatusUnprocessableEntity).JSON(result)
+  }
+
+  if imp.create == nil {
+    if imp.prepare != nil {
+      if err := imp.prepare(values); err != nil {
+        return sendInternalServerError(c, err)
+      }
+    }
+    copied, err := tx.CopyFrom(ctx, pgx.Identifier{imp.table}, imp.columns, pgx.CopyFromRows(values))
+    if err != nil {
+      return handleDatabaseError(c, err)
+    }
+    result.Created = int(copied)
+  }
+  if err := tx.Commit(ctx); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(result)
+}
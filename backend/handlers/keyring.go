@@ -0,0 +1,169 @@
+package handlers
+
+import (
+  "crypto"
+  "crypto/ed25519"
+  "crypto/rand"
+  "crypto/rsa"
+  "crypto/sha256"
+  "crypto/x509"
+  "encoding/base64"
+  "encoding/pem"
+  "errors"
+  "fmt"
+  "log"
+  "math/big"
+  "os"
+
+  "backend/config"
+  "backend/models"
+
+  "github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms accepted when verifying access tokens
+var ValidSigningMethods = []string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}
+
+type signingKey struct {
+  kid     string
+  method  jwt.SigningMethod
+  private crypto.Signer
+  jwk     models.JWK
+}
+
+// Set of keys used to sign and verify access tokens.
+// The first key signs new tokens, the others are only kept for verification while a rotation is in progress.
+type KeyRing struct {
+  active *signingKey
+  keys   map[string]*signingKey
+  jwks   models.JWKS
+}
+
+// Loaded from the PEM files of JWT_SIGNING_KEYS by Start
+var Keys *KeyRing
+
+func mustLoadKeyRing() *KeyRing {
+  ring := &KeyRing{keys: map[string]*signingKey{}}
+
+  for _, path := range config.Current.JWTSigningKeys {
+    data, err := os.ReadFile(path)
+    if err != nil {
+      log.Fatalf("Unable to read signing key %s: %v\n", path, err)
+    }
+    key, err := parseSigningKey(data)
+    if err != nil {
+      log.Fatalf("Unable to parse signing key %s: %v\n", path, err)
+    }
+    ring.add(key)
+  }
+
+  if ring.active == nil {
+    // Only reachable with DEBUG=true, tokens signed with this key do not survive a restart and are not shared between replicas
+    log.Println("JWT_SIGNING_KEYS not set, using an ephemeral Ed25519 signing key for development")
+    _, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+      log.Fatalf("Unable to generate signing key: %v\n", err)
+    }
+    key, err := newSigningKey(private)
+    if err != nil {
+      log.Fatalf("Unable to generate signing key: %v\n", err)
+    }
+    ring.add(key)
+  }
+
+  return ring
+}
+
+func (r *KeyRing) add(key *signingKey) {
+  if _, ok := r.keys[key.kid]; ok {
+    return
+  }
+  if r.active == nil {
+    r.active = key
+  }
+  r.keys[key.kid] = key
+  r.jwks.Keys = append(r.jwks.Keys, key.jwk)
+}
+
+/// Parse a PKCS#8 (Ed25519 or RSA) or PKCS#1 (RSA) PEM encoded private key
+func parseSigningKey(data []byte) (*signingKey, error) {
+  block, _ := pem.Decode(data)
+  if block == nil {
+    return nil, errors.New("no PEM block found")
+  }
+
+  var private any
+  var err error
+  switch block.Type {
+  case "PRIVATE KEY":
+    private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+  case "RSA PRIVATE KEY":
+    private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+  default:
+    return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+  }
+  if err != nil {
+    return nil, err
+  }
+
+  signer, ok := private.(crypto.Signer)
+  if !ok {
+    return nil, errors.New("key can not be used for signing")
+  }
+  return newSigningKey(signer)
+}
+
+func newSigningKey(private crypto.Signer) (*signingKey, error) {
+  b64 := base64.RawURLEncoding.EncodeToString
+  key := &signingKey{private: private}
+
+  // The RFC 7638 thumbprint is used as key ID, so it is stable across restarts and replicas
+  var thumbprint string
+  switch public := private.Public().(type) {
+  case ed25519.PublicKey:
+    key.method = jwt.SigningMethodEdDSA
+    key.jwk = models.JWK{Kty: "OKP", Crv: "Ed25519", X: b64(public)}
+    thumbprint = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, key.jwk.X)
+  case *rsa.PublicKey:
+    if public.N.BitLen() < 2048 {
+      return nil, errors.New("RSA keys must be at least 2048 bits")
+    }
+    key.method = jwt.SigningMethodRS256
+    key.jwk = models.JWK{Kty: "RSA", N: b64(public.N.Bytes()), E: b64(big.NewInt(int64(public.E)).Bytes())}
+    thumbprint = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, key.jwk.E, key.jwk.N)
+  default:
+    return nil, fmt.Errorf("unsupported key type %T", public)
+  }
+
+  sum := sha256.Sum256([]byte(thumbprint))
+  key.kid = b64(sum[:])
+  key.jwk.Kid = key.kid
+  key.jwk.Use = "sig"
+  key.jwk.Alg = key.method.Alg()
+  return key, nil
+}
+
+/// Sign claims with the active key, the key ID is put in the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+  token := jwt.NewWithClaims(r.active.method, claims)
+  token.Header["kid"] = r.active.kid
+  return token.SignedString(r.active.private)
+}
+
+/// jwt.Keyfunc resolving the verification key from the kid header
+func (r *KeyRing) Keyfunc(token *jwt.Token) (any, error) {
+  kid, _ := token.Header["kid"].(string)
+  key, ok := r.keys[kid]
+  if !ok {
+    return nil, errors.New("unknown signing key")
+  }
+  if token.Method.Alg() != key.method.Alg() {
+    return nil, errors.New("signing method does not match key")
+  }
+  return key.private.Public(), nil
+}
+
+/// Public keys of the ring as a JSON Web Key Set
+func (r *KeyRing) JWKS() models.JWKS {
+  return r.jwks
+}
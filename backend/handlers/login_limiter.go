@@ -0,0 +1,137 @@
+package handlers
+
+import (
+  "context"
+  "fmt"
+  "log"
+  "math"
+  "net/netip"
+  "strconv"
+  "time"
+
+  "backend/config"
+  "backend/database"
+  "backend/limiter"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+// Limits guessing the password of a single account, the Store of both limiters is set by Start
+var accountLimiter = &limiter.Limiter{
+  Threshold:   5,
+  BaseLockout: 30 * time.Second,
+  MaxLockout:  time.Hour,
+  Window:      time.Hour,
+}
+
+// Limits a single client trying many accounts, more lenient as an IP may be shared by a whole campus
+var ipLimiter = &limiter.Limiter{
+  Threshold:   30,
+  BaseLockout: time.Minute,
+  MaxLockout:  time.Hour,
+  Window:      time.Hour,
+}
+
+/// Failure counters are kept in postgres so lockouts hold across replicas, LOGIN_LIMITER_STORE=memory keeps them in process
+func newLoginAttemptStore() limiter.Store {
+  if config.Current.LoginLimiterStore == "memory" {
+    log.Println("Login attempts are tracked in memory, lockouts are not shared between replicas")
+    return limiter.NewMemoryStore(time.Hour)
+  }
+  return &limiter.PostgresStore{DB: database.DB}
+}
+
+func accountLimiterKey(id int, role string) string {
+  return fmt.Sprintf("account:%s:%d", role, id)
+}
+
+func ipLimiterKey(ip string) string {
+  // A proxy may write the same address differently, and UnlockAddress has to find the key again
+  if addr, err := netip.ParseAddr(ip); err == nil {
+    ip = addr.Unmap().String()
+  }
+  return "ip:" + ip
+}
+
+func sendTooManyAttempts(c fiber.Ctx, retryAfter time.Duration) error {
+  seconds := int(math.Ceil(retryAfter.Seconds()))
+  c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+  return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+    "error":       "Too many failed login attempts, try again later",
+    "retry_after": seconds,
+  })
+}
+
+/// Time left until the account or client may try again, zero if neither is locked
+func loginRetryAfter(ctx context.Context, accountKey, ipKey string) (time.Duration, error) {
+  accountRetry, err := accountLimiter.Check(ctx, accountKey)
+  if err != nil {
+    return 0, err
+  }
+  ipRetry, err := ipLimiter.Check(ctx, ipKey)
+  if err != nil {
+    return 0, err
+  }
+  return max(accountRetry, ipRetry), nil
+}
+
+/// Count a failed login against the account and the client, returns the lockout now in effect
+func recordLoginFailure(ctx context.Context, accountKey, ipKey string) (time.Duration, error) {
+  accountLockout, err := accountLimiter.Fail(ctx, accountKey)
+  if err != nil {
+    return 0, err
+  }
+  ipLockout, err := ipLimiter.Fail(ctx, ipKey)
+  if err != nil {
+    return 0, err
+  }
+  return max(accountLockout, ipLockout), nil
+}
+
+/// Respond to a failed login, with 429 if it caused a lockout
+func sendLoginFailed(c fiber.Ctx, accountKey, ipKey string) error {
+  lockout, err := recordLoginFailure(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if lockout > 0 {
+    return sendTooManyAttempts(c, lockout)
+  }
+  return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+}
+
+func isInvalidCredentials(err error) bool {
+  return isRaisedException(err, "Invalid credentials")
+}
+
+func UnlockAccount(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid user ID")
+  }
+
+  role := c.Params("role")
+  if role != "student" && role != "faculty" {
+    return sendBadRequestError(c, "Invalid role")
+  }
+
+  if err := accountLimiter.Reset(context.Background(), accountLimiterKey(id, role)); err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Account unlocked successfully"})
+}
+
+/// Lift the lockout of a client address, e.g. of a campus NAT that many users share
+func UnlockAddress(c fiber.Ctx) error {
+  addr, err := netip.ParseAddr(c.Params("address"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid IP address")
+  }
+
+  if err := ipLimiter.Reset(context.Background(), ipLimiterKey(addr.String())); err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Address unlocked successfully"})
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+  "context"
+  "fmt"
+  "net/http/httptest"
+  "testing"
+  "time"
+
+  "backend/limiter"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Point both login limiters at a fresh memory store with a clock that only moves when the test says so
+func useTestLimiters(t *testing.T) *time.Time {
+  now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+  clock := func() time.Time { return now }
+  store := limiter.NewMemoryStore(time.Hour)
+  store.Now = clock
+
+  for _, l := range []*limiter.Limiter{accountLimiter, ipLimiter} {
+    previousStore, previousNow := l.Store, l.Now
+    l.Store, l.Now = store, clock
+    t.Cleanup(func() { l.Store, l.Now = previousStore, previousNow })
+  }
+  return &now
+}
+
+func TestLoginLimits(t *testing.T) {
+  tests := []struct {
+    name      string
+    failures  int
+    account   func(i int) string
+    ip        func(i int) string
+    firstLock time.Duration
+  }{
+    // Failures from many addresses still lock the account after 5
+    {"account", 5, func(int) string { return accountLimiterKey(1, "student") }, func(i int) string { return ipLimiterKey(fmt.Sprintf("10.0.0.%d", i)) }, 30 * time.Second},
+    // A single address trying many accounts is locked after 30
+    {"ip", 30, func(i int) string { return accountLimiterKey(i, "student") }, func(int) string { return ipLimiterKey("10.0.0.1") }, time.Minute},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      ctx := context.Background()
+      useTestLimiters(t)
+
+      for i := range test.failures {
+        retryAfter, err := loginRetryAfter(ctx, test.account(i), test.ip(i))
+        if err != nil {
+          t.Fatal(err)
+        }
+        if retryAfter != 0 {
+          t.Fatalf("locked out for %v before failure %d", retryAfter, i+1)
+        }
+
+        lockout, err := recordLoginFailure(ctx, test.account(i), test.ip(i))
+        if err != nil {
+          t.Fatal(err)
+        }
+        want := time.Duration(0)
+        if i == test.failures-1 {
+          want = test.firstLock
+        }
+        if lockout != want {
+          t.Errorf("failure %d: lockout = %v, want %v", i+1, lockout, want)
+        }
+      }
+
+      retryAfter, err := loginRetryAfter(ctx, test.account(test.failures), test.ip(test.failures))
+      if err != nil {
+        t.Fatal(err)
+      }
+      if retryAfter != test.firstLock {
+        t.Errorf("retry after = %v, want %v", retryAfter, test.firstLock)
+      }
+    })
+  }
+}
+
+func TestLoginLockoutBackoff(t *testing.T) {
+  ctx := context.Background()
+  now := useTestLimiters(t)
+  account := accountLimiterKey(1, "faculty")
+
+  // Every failure after a lockout ended doubles the next one, up to an hour
+  want := []time.Duration{0, 0, 0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+    16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+  for i, want := range want {
+    // Each failure comes from another address, so only the account limit applies
+    lockout, err := recordLoginFailure(ctx, account, ipLimiterKey(fmt.Sprintf("192.0.2.%d", i)))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if lockout != want {
+      t.Errorf("failure %d: lockout = %v, want %v", i+1, lockout, want)
+    }
+    *now = now.Add(lockout)
+  }
+
+  // A successful login forgets the failures
+  if err := accountLimiter.Reset(ctx, account); err != nil {
+    t.Fatal(err)
+  }
+  lockout, err := recordLoginFailure(ctx, account, ipLimiterKey("192.0.2.1"))
+  if err != nil || lockout != 0 {
+    t.Errorf("lockout after reset = %v, %v, want 0", lockout, err)
+  }
+}
+
+func TestIPLimiterKey(t *testing.T) {
+  tests := []struct {
+    ip   string
+    want string
+  }{
+    {"192.0.2.1", "ip:192.0.2.1"},
+    {"::ffff:192.0.2.1", "ip:192.0.2.1"},
+    {"2001:DB8:0:0::1", "ip:2001:db8::1"},
+    {"not an address", "ip:not an address"},
+  }
+  for _, test := range tests {
+    if got := ipLimiterKey(test.ip); got != test.want {
+      t.Errorf("ipLimiterKey(%q) = %q, want %q", test.ip, got, test.want)
+    }
+  }
+}
+
+func TestUnlockAddress(t *testing.T) {
+  ctx := context.Background()
+  useTestLimiters(t)
+
+  app := fiber.New()
+  app.Delete("/lockouts/ip/:address", UnlockAddress)
+  app.Delete("/lockouts/:role/:id", UnlockAccount)
+
+  account := accountLimiterKey(7, "student")
+  ip := ipLimiterKey("2001:db8::1")
+  for i := range ipLimiter.Threshold {
+    if _, err := recordLoginFailure(ctx, accountLimiterKey(i, "student"), ip); err != nil {
+      t.Fatal(err)
+    }
+  }
+  for range accountLimiter.Threshold {
+    if _, err := accountLimiter.Fail(ctx, account); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  tests := []struct {
+    path          string
+    status        int
+    accountLocked bool
+    ipLocked      bool
+  }{
+    {"/lockouts/ip/not-an-address", fiber.StatusBadRequest, true, true},
+    // Unlocking the account leaves the address locked
+    {"/lockouts/student/7", fiber.StatusOK, false, true},
+    {"/lockouts/ip/2001:DB8:0::1", fiber.StatusOK, false, false},
+  }
+  for _, test := range tests {
+    resp, err := app.Test(httptest.NewRequest(fiber.MethodDelete, test.path, nil))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if resp.StatusCode != test.status {
+      t.Errorf("%s: status = %d, want %d", test.path, resp.StatusCode, test.status)
+    }
+
+    accountRetry, _ := accountLimiter.Check(ctx, account)
+    ipRetry, _ := ipLimiter.Check(ctx, ip)
+    if (accountRetry > 0) != test.accountLocked || (ipRetry > 0) != test.ipLocked {
+      t.Errorf("%s: account locked %v, ip locked %v, want %v, %v", test.path, accountRetry > 0, ipRetry > 0, test.accountLocked, test.ipLocked)
+    }
+  }
+}
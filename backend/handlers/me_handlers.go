@@ -0,0 +1,60 @@
+package handlers
+
+import (
+  "context"
+  "time"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+func GetMe(c fiber.Ctx) error {
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  me := models.MeResponse{
+    ID:                 userID,
+    Role:               userRole,
+    TokenExpiresAt:     c.Locals("tokenExpiresAt").(time.Time),
+    MustChangePassword: c.Locals("mustChangePassword").(bool),
+    MustEnrollMFA:      c.Locals("mustEnrollMFA").(bool),
+  }
+
+  switch userRole {
+  case "student":
+    student := models.Student{}
+    query := `SELECT id, name, date_of_birth, address, contact, program FROM get_student_by_id($1, $2, $3)`
+    err := database.DB.QueryRow(context.Background(), query, userID, userID, userRole).Scan(
+      &student.ID,
+      &student.Name,
+      &student.DateOfBirth,
+      &student.Address,
+      &student.Contact,
+      &student.Program,
+    )
+    if err != nil {
+      return handleDatabaseError(c, err)
+    }
+    me.Student = &student
+  case "faculty":
+    faculty := models.Faculty{}
+    query := `SELECT ` + facultyColumns + ` FROM get_faculty_profile($1, $2)`
+    if err := scanFaculty(database.DB.QueryRow(context.Background(), query, userID, userRole), &faculty); err != nil {
+      return handleDatabaseError(c, err)
+    }
+    me.Faculty = &faculty
+  default:
+    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Invalid user role."})
+  }
+
+  // Read from the database rather than the token, so role changes show up right away
+  permissions, err := getUserPermissions(userID, userRole)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  me.Permissions = permissions
+
+  return c.JSON(me)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+  "strconv"
+
+  "backend/metrics"
+
+  "github.com/gofiber/fiber/v3"
+  "github.com/jackc/pgx/v5/pgconn"
+  "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+  loginOutcomes = metrics.With.NewCounterVec(prometheus.CounterOpts{
+    Name: "sis_logins_total",
+    Help: "Login attempts by account role and outcome. A login with a second factor counts as mfa_required, then as the outcome of the code.",
+  }, []string{"role", "outcome"})
+  databaseErrors = metrics.With.NewCounterVec(prometheus.CounterOpts{
+    Name: "sis_database_errors_total",
+    Help: "Database errors answered by handleDatabaseError by response status and SQLSTATE, none for errors without one.",
+  }, []string{"status", "sqlstate"})
+)
+
+/// Counts a login attempt of a valid role once the response is written, unless outcome is already known the status decides it
+func recordLogin(c fiber.Ctx, role string, outcome string) {
+  if outcome == "" {
+    switch c.Response().StatusCode() {
+    case fiber.StatusOK:
+      outcome = "success"
+    case fiber.StatusUnauthorized:
+      outcome = "failure"
+    case fiber.StatusTooManyRequests:
+      outcome = "locked_out"
+    default:
+      outcome = "error"
+    }
+  }
+  loginOutcomes.WithLabelValues(role, outcome).Inc()
+}
+
+func recordDatabaseError(c fiber.Ctx, err error) {
+  sqlState := "none"
+  if pgErr, ok := err.(*pgconn.PgError); ok {
+    sqlState = pgErr.Code
+  }
+  databaseErrors.WithLabelValues(strconv.Itoa(c.Response().StatusCode()), sqlState).Inc()
+}
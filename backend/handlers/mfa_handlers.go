@@ -0,0 +1,347 @@
+package handlers
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "strings"
+  "time"
+
+  "backend/config"
+  "backend/database"
+  "backend/models"
+  "backend/totp"
+
+  "github.com/gofiber/fiber/v3"
+  "github.com/golang-jwt/jwt/v5"
+  "github.com/jackc/pgx/v5"
+)
+
+const (
+  mfaChallengeAud   = "mfa-challenge"
+  recoveryCodeCount = 10
+)
+
+// Claims of the partial token handed out by Login when a second factor is still needed.
+// It has no session ID, so AuthRequired never accepts it as an access token.
+type MFAChallengeClaims struct {
+  ID                 int    `json:"id"`
+  Role               string `json:"role"`
+  MustChangePassword bool   `json:"must_change_password,omitempty"`
+  jwt.RegisteredClaims
+}
+
+type mfaFactor struct {
+  secret       string
+  enabled      bool
+  lastUsedStep int64
+}
+
+/// Second factor of a user, nil if none was ever set up
+func getMFAFactor(id int, role string) (*mfaFactor, error) {
+  factor := &mfaFactor{}
+  query := `SELECT secret, enabled, last_used_step FROM get_mfa_factor($1, $2)`
+  err := database.DB.QueryRow(context.Background(), query, id, role).Scan(&factor.secret, &factor.enabled, &factor.lastUsedStep)
+  if errors.Is(err, pgx.ErrNoRows) {
+    return nil, nil
+  }
+  if err != nil {
+    return nil, err
+  }
+  return factor, nil
+}
+
+/// Reports weather the user still has to enroll a second factor before using the API
+func mfaEnrollmentRequired(id int, role string) (bool, error) {
+  // Faculty can change grades, so a deployment may refuse to let them work without a second factor
+  if role != "faculty" || !config.Current.MFARequiredForFaculty {
+    return false, nil
+  }
+  factor, err := getMFAFactor(id, role)
+  if err != nil {
+    return false, err
+  }
+  return factor == nil || !factor.enabled, nil
+}
+
+func generateMFAChallenge(id int, role string, mustChangePassword bool) (string, time.Time, error) {
+  now := time.Now()
+  expiresAt := now.Add(config.Current.MFAChallengeTTL)
+  claims := MFAChallengeClaims{
+    ID:                 id,
+    Role:               role,
+    MustChangePassword: mustChangePassword,
+    RegisteredClaims: jwt.RegisteredClaims{
+      Audience:  jwt.ClaimStrings{mfaChallengeAud},
+      ExpiresAt: jwt.NewNumericDate(expiresAt),
+      IssuedAt:  jwt.NewNumericDate(now),
+    },
+  }
+
+  signed, err := Keys.Sign(claims)
+  return signed, expiresAt, err
+}
+
+/// Normalize a recovery code as typed by a user
+func normalizeRecoveryCode(code string) string {
+  return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+  for range recoveryCodeCount {
+    code, err := randomToken(5)
+    if err != nil {
+      return nil, nil, err
+    }
+    codes = append(codes, code[:5]+"-"+code[5:])
+    hashes = append(hashes, hashRefreshSecret(code))
+  }
+  return codes, hashes, nil
+}
+
+/// Check a TOTP or recovery code and mark it as used, so it can not be used again
+func verifySecondFactor(id int, role string, factor *mfaFactor, code string) (bool, error) {
+  code = strings.TrimSpace(code)
+  if len(code) == totp.Digits {
+    step, ok := totp.Validate(factor.secret, code, time.Now(), factor.lastUsedStep)
+    if !ok {
+      return false, nil
+    }
+    _, err := database.DB.Exec(context.Background(), `CALL use_mfa_step($1, $2, $3)`, id, role, step)
+    if isInvalidVerificationCode(err) {
+      return false, nil
+    }
+    return err == nil, err
+  }
+
+  _, err := database.DB.Exec(context.Background(), `CALL use_recovery_code($1, $2, $3)`, id, role, hashRefreshSecret(normalizeRecoveryCode(code)))
+  if isInvalidVerificationCode(err) {
+    return false, nil
+  }
+  return err == nil, err
+}
+
+func isInvalidVerificationCode(err error) bool {
+  return isRaisedException(err, "Invalid verification code")
+}
+
+/// Respond to a wrong code of a signed in user, counted like a failed login and with 429 if it caused a lockout
+func sendInvalidVerificationCode(c fiber.Ctx, accountKey, ipKey string) error {
+  lockout, err := recordLoginFailure(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if lockout > 0 {
+    return sendTooManyAttempts(c, lockout)
+  }
+  return sendBadRequestError(c, "Invalid verification code")
+}
+
+func VerifyLoginMFA(c fiber.Ctx) error {
+  req := new(models.MFALoginRequest)
+
+  if err := c.Bind().Body(req); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+  if req.MFAToken == "" || req.Code == "" {
+    return sendBadRequestError(c, "MFA token and code are required")
+  }
+
+  claims := &MFAChallengeClaims{}
+  token, err := jwt.ParseWithClaims(req.MFAToken, claims, Keys.Keyfunc,
+    jwt.WithValidMethods(ValidSigningMethods),
+    jwt.WithAudience(mfaChallengeAud),
+  )
+  if err != nil || !token.Valid {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired MFA token"})
+  }
+
+  defer recordLogin(c, claims.Role, "")
+
+  // Codes are short, so guesses count against the same limits as passwords
+  accountKey := accountLimiterKey(claims.ID, claims.Role)
+  ipKey := ipLimiterKey(c.IP())
+  retryAfter, err := loginRetryAfter(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if retryAfter > 0 {
+    return sendTooManyAttempts(c, retryAfter)
+  }
+
+  factor, err := getMFAFactor(claims.ID, claims.Role)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if factor == nil || !factor.enabled {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired MFA token"})
+  }
+
+  ok, err := verifySecondFactor(claims.ID, claims.Role, factor, req.Code)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if !ok {
+    return sendLoginFailed(c, accountKey, ipKey)
+  }
+
+  if err := accountLimiter.Reset(context.Background(), accountKey); err != nil {
+    println("Failed to reset login attempts:", err.Error())
+  }
+
+  response, err := startSession(claims.ID, claims.Role, claims.MustChangePassword)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.JSON(response)
+}
+
+func EnrollMFA(c fiber.Ctx) error {
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  secret, err := totp.GenerateSecret()
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  // Replaces any pending enrollment, fails if a factor is already enabled
+  _, err = database.DB.Exec(context.Background(), `CALL set_mfa_factor($1, $2, $3)`, userID, userRole, secret)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(models.MFAEnrollResponse{
+    Secret:     secret,
+    OTPAuthURL: totp.URI(secret, config.Current.InstitutionName, fmt.Sprintf("%s-%d", userRole, userID)),
+  })
+}
+
+func ConfirmMFA(c fiber.Ctx) error {
+  req := new(models.MFACodeRequest)
+
+  if err := c.Bind().Body(req); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+  if req.Code == "" {
+    return sendBadRequestError(c, "Verification code is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  factor, err := getMFAFactor(userID, userRole)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if factor == nil {
+    return sendBadRequestError(c, "No pending two-factor enrollment")
+  }
+  if factor.enabled {
+    return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+  }
+
+  // Guesses count against the login limits, a stolen access token must not allow unlimited tries
+  accountKey := accountLimiterKey(userID, userRole)
+  ipKey := ipLimiterKey(c.IP())
+  retryAfter, err := loginRetryAfter(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if retryAfter > 0 {
+    return sendTooManyAttempts(c, retryAfter)
+  }
+
+  step, ok := totp.Validate(factor.secret, strings.TrimSpace(req.Code), time.Now(), factor.lastUsedStep)
+  if !ok {
+    return sendInvalidVerificationCode(c, accountKey, ipKey)
+  }
+  if err := accountLimiter.Reset(context.Background(), accountKey); err != nil {
+    println("Failed to reset login attempts:", err.Error())
+  }
+
+  codes, hashes, err := generateRecoveryCodes()
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  _, err = database.DB.Exec(context.Background(), `CALL enable_mfa_factor($1, $2, $3, $4)`, userID, userRole, step, hashes)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  // The current token may carry the must enroll flag, replace it with a fresh session
+  if err := revokeSession(c.Locals("sessionID").(string)); err != nil {
+    return handleDatabaseError(c, err)
+  }
+  response, err := startSession(userID, userRole, false)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.JSON(models.MFAConfirmResponse{RecoveryCodes: codes, AuthResponse: response})
+}
+
+func DisableMFA(c fiber.Ctx) error {
+  req := new(models.MFADisableRequest)
+
+  if err := c.Bind().Body(req); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+  if req.Password == "" || req.Code == "" {
+    return sendBadRequestError(c, "Password and verification code are required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  if userRole == "faculty" && config.Current.MFARequiredForFaculty {
+    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor authentication is required for faculty"})
+  }
+
+  // Password and code guesses count against the login limits
+  accountKey := accountLimiterKey(userID, userRole)
+  ipKey := ipLimiterKey(c.IP())
+  retryAfter, err := loginRetryAfter(context.Background(), accountKey, ipKey)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if retryAfter > 0 {
+    return sendTooManyAttempts(c, retryAfter)
+  }
+
+  var storedPassword string
+  query := `SELECT password FROM get_user_credentials($1, $2)`
+  if err := database.DB.QueryRow(context.Background(), query, userID, userRole).Scan(&storedPassword); err != nil {
+    return handleDatabaseError(c, err)
+  }
+  if ok, _ := verifyPassword(storedPassword, req.Password); !ok {
+    return sendLoginFailed(c, accountKey, ipKey)
+  }
+
+  factor, err := getMFAFactor(userID, userRole)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if factor == nil || !factor.enabled {
+    return sendBadRequestError(c, "Two-factor authentication is not enabled")
+  }
+
+  ok, err := verifySecondFactor(userID, userRole, factor, req.Code)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  if !ok {
+    return sendInvalidVerificationCode(c, accountKey, ipKey)
+  }
+  if err := accountLimiter.Reset(context.Background(), accountKey); err != nil {
+    println("Failed to reset login attempts:", err.Error())
+  }
+
+  if _, err := database.DB.Exec(context.Background(), `CALL delete_mfa_factor($1, $2)`, userID, userRole); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
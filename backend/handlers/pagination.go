@@ -0,0 +1,168 @@
+package handlers
+
+import (
+  "encoding/base64"
+  "errors"
+  "slices"
+  "strconv"
+  "strings"
+  "time"
+
+  "backend/models"
+  "backend/tabular"
+
+  "github.com/goccy/go-json"
+  "github.com/gofiber/fiber/v3"
+)
+
+const (
+  defaultPageSize = 50
+  maxPageSize     = 200
+)
+
+// Position after the last row of a page, opaque to clients
+type pageCursor struct {
+  Sort  string `json:"s"`
+  Value string `json:"v"`
+  ID    int    `json:"id"`
+}
+
+// Parsed ?limit=&after=&sort= parameters of a list endpoint
+type pageRequest struct {
+  limit      int
+  sort       string
+  descending bool
+  afterValue *string
+  afterID    *int
+}
+
+/// Parse the pagination parameters, sort must be one of sortFields with an optional "-" prefix for descending order
+func parsePageRequest(c fiber.Ctx, sortFields []string, defaultSort string) (pageRequest, error) {
+  req := pageRequest{limit: defaultPageSize}
+
+  if limit := c.Query("limit"); limit != "" {
+    n, err := strconv.Atoi(limit)
+    if err != nil || n < 1 || n > maxPageSize {
+      return req, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageSize))
+    }
+    req.limit = n
+  }
+
+  sort := c.Query("sort", defaultSort)
+  req.sort, req.descending = strings.CutPrefix(sort, "-")
+  if !slices.Contains(sortFields, req.sort) {
+    return req, errors.New("sort must be one of " + strings.Join(sortFields, ", "))
+  }
+
+  if after := c.Query("after"); after != "" {
+    data, err := base64.RawURLEncoding.DecodeString(after)
+    if err != nil {
+      return req, errors.New("Invalid cursor")
+    }
+    cursor := pageCursor{}
+    if err := json.Unmarshal(data, &cursor); err != nil {
+      return req, errors.New("Invalid cursor")
+    }
+    // A cursor is only meaningful for the order it was created with
+    if cursor.Sort != sort {
+      return req, errors.New("Cursor does not match sort order")
+    }
+    req.afterValue = &cursor.Value
+    req.afterID = &cursor.ID
+  }
+
+  return req, nil
+}
+
+/// Limit passed to the *_page functions, exports are not paginated and contain every row after the cursor
+func (req pageRequest) queryLimit(format tabular.Format) *int {
+  if format != "" {
+    return nil
+  }
+  limit := req.limit + 1
+  return &limit
+}
+
+/// Sort key of a row as returned by the *_page functions
+type pageKey struct {
+  value string
+  id    int
+}
+
+/// Build the response envelope. The *_page functions are queried for one row more than
+/// the limit, if it is present there is a next page starting after the last returned row.
+func newPage[T any](req pageRequest, items []T, keys []pageKey, totalCount int64) models.Page[T] {
+  page := models.Page[T]{Items: items, TotalCount: totalCount}
+  if len(items) > req.limit {
+    page.Items = items[:req.limit]
+    last := keys[req.limit-1]
+    sort := req.sort
+    if req.descending {
+      sort = "-" + sort
+    }
+    data, _ := json.Marshal(pageCursor{Sort: sort, Value: last.value, ID: last.id})
+    page.NextCursor = base64.RawURLEncoding.EncodeToString(data)
+  }
+  return page
+}
+
+/// Optional integer query parameter
+func queryInt(c fiber.Ctx, key string) (*int, error) {
+  value := c.Query(key)
+  if value == "" {
+    return nil, nil
+  }
+  n, err := strconv.Atoi(value)
+  if err != nil {
+    return nil, errors.New("Invalid " + key + " query parameter")
+  }
+  return &n, nil
+}
+
+/// Optional decimal query parameter
+func queryFloat(c fiber.Ctx, key string) (*float64, error) {
+  value := c.Query(key)
+  if value == "" {
+    return nil, nil
+  }
+  n, err := strconv.ParseFloat(value, 64)
+  if err != nil {
+    return nil, errors.New("Invalid " + key + " query parameter")
+  }
+  return &n, nil
+}
+
+/// Optional date query parameter in YYYY-MM-DD form
+func queryDate(c fiber.Ctx, key string) (*time.Time, error) {
+  value := c.Query(key)
+  if value == "" {
+    return nil, nil
+  }
+  t, err := time.Parse(time.DateOnly, value)
+  if err != nil {
+    return nil, errors.New("Invalid " + key + " query parameter")
+  }
+  return &t, nil
+}
+
+/// Optional boolean query parameter, true or false
+func queryBool(c fiber.Ctx, key string) (*bool, error) {
+  value := c.Query(key)
+  if value == "" {
+    return nil, nil
+  }
+  b, err := strconv.ParseBool(value)
+  if err != nil {
+    return nil, errors.New("Invalid " + key + " query parameter")
+  }
+  return &b, nil
+}
+
+/// Optional string query parameter
+func queryString(c fiber.Ctx, key string) *string {
+  value := c.Query(key)
+  if value == "" {
+    return nil
+  }
+  return &value
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+  "runtime"
+  "strings"
+  "sync"
+
+  "golang.org/x/crypto/bcrypt"
+)
+
+// Cost used for newly hashed passwords, older hashes get upgraded on login
+const passwordHashCost = 12
+
+// Minimum length accepted for a user chosen password
+const minPasswordLength = 8
+
+// bcrypt only hashes the first 72 bytes and the Go implementation refuses anything longer
+const maxPasswordLength = 72
+
+// Layout of the date of birth when used as the default password
+const dobPasswordLayout = "2006-01-02"
+
+// Hash of a random password nobody knows, compared against when no account matches so that unknown
+// users take as long to reject as wrong passwords. Its cost has to follow passwordHashCost.
+const dummyPasswordHash = "$2a$12$z3axi4ZiQob9au3OuJ0fHORngMkCgME4yrhGbperzhFk4.8kx/vWa"
+
+/// Hash a plaintext password for storage
+func hashPassword(password string) (string, error) {
+  hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordHashCost)
+  if err != nil {
+    return "", err
+  }
+  return string(hash), nil
+}
+
+/// Hash many passwords at once, spread over all CPUs as every hash takes a noticeable fraction of a second
+func hashPasswords(passwords []string) ([]string, error) {
+  hashes := make([]string, len(passwords))
+  errs := make([]error, len(passwords))
+  slots := make(chan struct{}, runtime.NumCPU())
+  var wg sync.WaitGroup
+  for i, password := range passwords {
+    wg.Add(1)
+    slots <- struct{}{}
+    go func() {
+      defer wg.Done()
+      defer func() { <-slots }()
+      hashes[i], errs[i] = hashPassword(password)
+    }()
+  }
+  wg.Wait()
+
+  for _, err := range errs {
+    if err != nil {
+      return nil, err
+    }
+  }
+  return hashes, nil
+}
+
+/// Reports weather the stored value is a bcrypt hash
+func isPasswordHash(stored string) bool {
+  return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+/// Spend the time of a password check without an account to check against
+func rejectPassword(password string) {
+  bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+}
+
+/// Verify a password against the stored hash, anything else never matches. The passwords of databases predating hashing
+/// are hashed by the migration that upgrades them.
+/// Returns weather the password matched and weather the stored hash must be rehashed with the current cost.
+func verifyPassword(stored string, password string) (ok bool, rehash bool) {
+  if !isPasswordHash(stored) || bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+    return false, false
+  }
+  cost, err := bcrypt.Cost([]byte(stored))
+  return true, err != nil || cost < passwordHashCost
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+  "testing"
+
+  "golang.org/x/crypto/bcrypt"
+)
+
+func TestDummyPasswordHashCost(t *testing.T) {
+  // Rejecting an unknown user must take as long as checking a current hash
+  cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if cost != passwordHashCost {
+    t.Errorf("dummyPasswordHash has cost %d, want passwordHashCost %d", cost, passwordHashCost)
+  }
+}
+
+func TestVerifyPassword(t *testing.T) {
+  oldHash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  tests := []struct {
+    name     string
+    stored   string
+    password string
+    ok       bool
+    rehash   bool
+  }{
+    {"match with an outdated cost", string(oldHash), "correct horse", true, true},
+    {"wrong password", string(oldHash), "battery staple", false, false},
+    {"plaintext is never accepted", "correct horse", "correct horse", false, false},
+    {"empty password", "", "", false, false},
+    {"dummy hash", dummyPasswordHash, "", false, false},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      ok, rehash := verifyPassword(test.stored, test.password)
+      if ok != test.ok || rehash != test.rehash {
+        t.Errorf("verifyPassword = %v, %v, want %v, %v", ok, rehash, test.ok, test.rehash)
+      }
+    })
+  }
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+func GetCoursePrerequisites(c fiber.Ctx) error {
+  courseID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid course ID")
+  }
+
+  query := `SELECT group_number, required_course_id, required_course_code, min_grade, is_corequisite FROM get_course_prerequisites($1)`
+  rows, err := database.DB.Query(context.Background(), query, courseID)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  prerequisites := []models.CoursePrerequisite{}
+  for rows.Next() {
+    prerequisite := models.CoursePrerequisite{}
+    err := rows.Scan(
+      &prerequisite.Group,
+      &prerequisite.RequiredCourseID,
+      &prerequisite.RequiredCourseCode,
+      &prerequisite.MinGrade,
+      &prerequisite.Corequisite,
+    )
+    if err != nil {
+      return sendInternalServerError(c, err)
+    }
+    prerequisites = append(prerequisites, prerequisite)
+  }
+
+  // The course check is raised on the first row
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(prerequisites)
+}
+
+/// Replaces all requirements of the course, an empty list removes them
+func SetCoursePrerequisites(c fiber.Ctx) error {
+  courseID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid course ID")
+  }
+
+  prerequisites := []models.CoursePrerequisite{}
+  if err := c.Bind().JSON(&prerequisites); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL set_course_prerequisites($1, $2, $3, $4)`
+  _, err = database.DB.Exec(context.Background(), query, courseID, prerequisites, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Prerequisites updated successfully"})
+}
+
+func GetPrerequisiteOverrides(c fiber.Ctx) error {
+  studentID, err := queryInt(c, "student_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  courseID, err := queryInt(c, "course_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `SELECT id, student_id, course_id, term_id, enrollment_id, unmet, reason, overridden_by, created_at FROM get_prerequisite_overrides($1, $2, $3, $4)`
+  rows, err := database.DB.Query(context.Background(), query, studentID, courseID, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  overrides := []models.PrerequisiteOverride{}
+  for rows.Next() {
+    override := models.PrerequisiteOverride{}
+    err := rows.Scan(
+      &override.ID,
+      &override.StudentID,
+      &override.CourseID,
+      &override.TermID,
+      &override.EnrollmentID,
+      &override.Unmet,
+      &override.Reason,
+      &override.OverriddenBy,
+      &override.CreatedAt,
+    )
+    if err != nil {
+      return sendInternalServerError(c, err)
+    }
+    overrides = append(overrides, override)
+  }
+
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(overrides)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+  "context"
+  "sync"
+  "time"
+
+  "backend/config"
+  "backend/database"
+)
+
+// How often revocations made by other replicas are pulled from the database
+const revocationSyncInterval = 15 * time.Second
+
+// In process cache of revoked sessions, so that AuthRequired does not need a database round trip.
+// Entries are only kept while an access token issued for the session could still be valid.
+type revocationList struct {
+  mu       sync.RWMutex
+  revoked  map[string]time.Time
+  lastSync time.Time
+}
+
+var revocations = &revocationList{revoked: map[string]time.Time{}}
+
+/// Loads the revocations of still valid access tokens and keeps them in sync until ctx is done
+func (r *revocationList) start(ctx context.Context) {
+  r.lastSync = time.Now().Add(-config.Current.AccessTokenTTL)
+  if err := r.sync(); err != nil {
+    println("Failed to load revoked sessions:", err.Error())
+  }
+  go r.syncLoop(ctx)
+}
+
+/// Reports weather the session an access token belongs to was revoked
+func IsSessionRevoked(sessionID string) bool {
+  revocations.mu.RLock()
+  defer revocations.mu.RUnlock()
+  _, ok := revocations.revoked[sessionID]
+  return ok
+}
+
+func (r *revocationList) add(sessionID string, revokedAt time.Time) {
+  r.mu.Lock()
+  r.revoked[sessionID] = revokedAt
+  r.mu.Unlock()
+}
+
+/// Fetch revocations since the last sync and drop entries whose access tokens have expired
+func (r *revocationList) sync() error {
+  // Overlap a little so revocations committed during the previous sync are not missed
+  since := r.lastSync.Add(-revocationSyncInterval)
+  now := time.Now()
+
+  rows, err := database.DB.Query(context.Background(), `SELECT id, revoked_at FROM get_revoked_sessions($1)`, since)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  r.mu.Lock()
+  defer r.mu.Unlock()
+
+  for rows.Next() {
+    var id string
+    var revokedAt time.Time
+    if err := rows.Scan(&id, &revokedAt); err != nil {
+      return err
+    }
+    r.revoked[id] = revokedAt
+  }
+  if err := rows.Err(); err != nil {
+    return err
+  }
+
+  for id, revokedAt := range r.revoked {
+    if now.Sub(revokedAt) > config.Current.AccessTokenTTL {
+      delete(r.revoked, id)
+    }
+  }
+
+  r.lastSync = now
+  return nil
+}
+
+func (r *revocationList) syncLoop(ctx context.Context) {
+  ticker := time.NewTicker(revocationSyncInterval)
+  defer ticker.Stop()
+
+  for {
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+      if err := r.sync(); err != nil {
+        println("Failed to sync revoked sessions:", err.Error())
+      }
+    }
+  }
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+  "context"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Permissions granted by all roles of a user, embedded into access tokens
+func getUserPermissions(id int, role string) ([]string, error) {
+  rows, err := database.DB.Query(context.Background(), `SELECT get_user_permissions($1, $2)`, id, role)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  permissions := []string{}
+  for rows.Next() {
+    var permission string
+    if err := rows.Scan(&permission); err != nil {
+      return nil, err
+    }
+    permissions = append(permissions, permission)
+  }
+  return permissions, rows.Err()
+}
+
+func GetRoles(c fiber.Ctx) error {
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `SELECT name, description, permissions FROM get_roles($1, $2)`
+  rows, err := database.DB.Query(context.Background(), query, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  roles := []models.Role{}
+  for rows.Next() {
+    role := models.Role{}
+    if err := rows.Scan(&role.Name, &role.Description, &role.Permissions); err != nil {
+      return sendInternalServerError(c, err)
+    }
+    roles = append(roles, role)
+  }
+
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(roles)
+}
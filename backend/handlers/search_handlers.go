@@ -0,0 +1,58 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+  "strings"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+const (
+  defaultSearchLimit = 20
+  maxSearchLimit     = 100
+)
+
+func Search(c fiber.Ctx) error {
+  q := strings.TrimSpace(c.Query("q"))
+  if q == "" {
+    return sendBadRequestError(c, "Search query is required")
+  }
+
+  limit := defaultSearchLimit
+  if value := c.Query("limit"); value != "" {
+    n, err := strconv.Atoi(value)
+    if err != nil || n < 1 || n > maxSearchLimit {
+      return sendBadRequestError(c, "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+    }
+    limit = n
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `SELECT kind, id, label, detail, rank FROM search($1, $2, $3, $4)`
+  rows, err := database.DB.Query(context.Background(), query, q, userID, userRole, limit)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+  defer rows.Close()
+
+  results := []models.SearchResult{}
+  for rows.Next() {
+    result := models.SearchResult{}
+    if err := rows.Scan(&result.Kind, &result.ID, &result.Label, &result.Detail, &result.Rank); err != nil {
+      return sendInternalServerError(c, err)
+    }
+    results = append(results, result)
+  }
+
+  if err := rows.Err(); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(results)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Sections with their enrolled and waitlisted counts, a sectionID loads only that section
+func loadSections(courseID *int, termID *int, sectionID *int) ([]models.CourseSection, error) {
+  query := `SELECT id, course_id, term_id, section_number, instructor_id, capacity, room, meeting_times, enrolled, waitlisted FROM get_course_sections($1, $2, $3)`
+  rows, err := database.DB.Query(context.Background(), query, courseID, termID, sectionID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  sections := []models.CourseSection{}
+  for rows.Next() {
+    section := models.CourseSection{}
+    err := rows.Scan(
+      &section.ID,
+      &section.CourseID,
+      &section.TermID,
+      &section.SectionNumber,
+      &section.InstructorID,
+      &section.Capacity,
+      &section.Room,
+      &section.MeetingTimes,
+      &section.Enrolled,
+      &section.Waitlisted,
+    )
+    if err != nil {
+      return nil, err
+    }
+    sections = append(sections, section)
+  }
+
+  return sections, rows.Err()
+}
+
+/// Scan the rows of get_section_waitlist and get_student_waitlist
+func loadWaitlist(query string, args ...any) ([]models.WaitlistEntry, error) {
+  rows, err := database.DB.Query(context.Background(), query, args...)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  entries := []models.WaitlistEntry{}
+  for rows.Next() {
+    entry := models.WaitlistEntry{}
+    err := rows.Scan(
+      &entry.ID,
+      &entry.StudentID,
+      &entry.SectionID,
+      &entry.CourseID,
+      &entry.TermID,
+      &entry.SectionNumber,
+      &entry.Position,
+      &entry.CreatedAt,
+    )
+    if err != nil {
+      return nil, err
+    }
+    entries = append(entries, entry)
+  }
+
+  return entries, rows.Err()
+}
+
+func loadStudentWaitlist(studentID int, userID int, userRole string) ([]models.WaitlistEntry, error) {
+  query := `SELECT id, student_id, section_id, course_id, term_id, section_number, waitlist_position, created_at FROM get_student_waitlist($1, $2, $3)`
+  return loadWaitlist(query, studentID, userID, userRole)
+}
+
+func GetSections(c fiber.Ctx) error {
+  courseID, err := queryInt(c, "course_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+  termID, err := queryInt(c, "term_id")
+  if err != nil {
+    return sendBadRequestError(c, err.Error())
+  }
+
+  sections, err := loadSections(courseID, termID, nil)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(sections)
+}
+
+func GetSection(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid section ID")
+  }
+
+  sections, err := loadSections(nil, nil, &id)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(sections[0])
+}
+
+func CreateSection(c fiber.Ctx) error {
+  section := new(models.CourseSection)
+  if err := c.Bind().JSON(section); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if section.CourseID == 0 {
+    return sendBadRequestError(c, "Course ID is required")
+  }
+  if section.TermID == 0 {
+    return sendBadRequestError(c, "Term ID is required")
+  }
+  if section.SectionNumber == "" {
+    return sendBadRequestError(c, "Section number is required")
+  }
+  if section.Capacity <= 0 {
+    return sendBadRequestError(c, "Positive capacity is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  var newSectionID int
+  query := `SELECT create_course_section($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+  err := database.DB.QueryRow(context.Background(), query,
+    section.CourseID,
+    section.TermID,
+    section.SectionNumber,
+    section.InstructorID,
+    section.Capacity,
+    section.Room,
+    section.MeetingTimes,
+    userID,
+    userRole,
+  ).Scan(&newSectionID)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  sections, err := loadSections(nil, nil, &newSectionID)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(sections[0])
+}
+
+func UpdateSection(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid section ID")
+  }
+
+  section := new(models.CourseSection)
+  if err := c.Bind().JSON(section); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if section.SectionNumber == "" {
+    return sendBadRequestError(c, "Section number is required")
+  }
+  if section.Capacity <= 0 {
+    return sendBadRequestError(c, "Positive capacity is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL update_course_section($1, $2, $3, $4, $5, $6, $7, $8)`
+  _, err = database.DB.Exec(context.Background(), query,
+    id,
+    section.SectionNumber,
+    section.InstructorID,
+    section.Capacity,
+    section.Room,
+    section.MeetingTimes,
+    userID,
+    userRole,
+  )
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Section updated successfully"})
+}
+
+func DeleteSection(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid section ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL delete_course_section($1, $2, $3)`
+  _, err = database.DB.Exec(context.Background(), query, id, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Section deleted successfully"})
+}
+
+func GetSectionWaitlist(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid section ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `SELECT id, student_id, section_id, course_id, term_id, section_number, waitlist_position, created_at FROM get_section_waitlist($1, $2, $3)`
+  entries, err := loadWaitlist(query, id, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(entries)
+}
+
+func GetStudentWaitlist(c fiber.Ctx) error {
+  studentID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid student ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  entries, err := loadStudentWaitlist(studentID, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(entries)
+}
+
+func DeleteWaitlistEntry(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid waitlist entry ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL delete_waitlist_entry($1, $2, $3)`
+  _, err = database.DB.Exec(context.Background(), query, id, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Waitlist entry deleted successfully"})
+}
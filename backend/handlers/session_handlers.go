@@ -0,0 +1,184 @@
+package handlers
+
+import (
+  "context"
+  "crypto/rand"
+  "crypto/sha256"
+  "crypto/subtle"
+  "encoding/hex"
+  "errors"
+  "strings"
+  "time"
+
+  "backend/config"
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Random hex encoded string of n bytes
+func randomToken(n int) (string, error) {
+  buf := make([]byte, n)
+  if _, err := rand.Read(buf); err != nil {
+    return "", err
+  }
+  return hex.EncodeToString(buf), nil
+}
+
+/// Only a hash of the refresh secret is stored, so a database leak does not leak sessions
+func hashRefreshSecret(secret string) string {
+  sum := sha256.Sum256([]byte(secret))
+  return hex.EncodeToString(sum[:])
+}
+
+/// Refresh tokens have the form <session id>.<secret>
+func splitRefreshToken(token string) (sessionID string, secret string, ok bool) {
+  sessionID, secret, ok = strings.Cut(token, ".")
+  return sessionID, secret, ok && sessionID != "" && secret != ""
+}
+
+/// Create a new session and issue an access and refresh token for it
+func startSession(id int, role string, mustChangePassword bool) (models.AuthResponse, error) {
+  sessionID, err := randomToken(16)
+  if err != nil {
+    return models.AuthResponse{}, err
+  }
+  secret, err := randomToken(32)
+  if err != nil {
+    return models.AuthResponse{}, err
+  }
+
+  query := `CALL create_session($1, $2, $3, $4, $5)`
+  _, err = database.DB.Exec(context.Background(), query, sessionID, id, role, hashRefreshSecret(secret), time.Now().Add(config.Current.RefreshTokenTTL))
+  if err != nil {
+    return models.AuthResponse{}, err
+  }
+
+  return sessionResponse(sessionID, secret, id, role, mustChangePassword)
+}
+
+func sessionResponse(sessionID, secret string, id int, role string, mustChangePassword bool) (models.AuthResponse, error) {
+  mustEnrollMFA, err := mfaEnrollmentRequired(id, role)
+  if err != nil {
+    return models.AuthResponse{}, err
+  }
+
+  permissions, err := getUserPermissions(id, role)
+  if err != nil {
+    return models.AuthResponse{}, err
+  }
+
+  token, expiresAt, err := generateJWT(sessionID, Claims{
+    ID:                 id,
+    Role:               role,
+    Permissions:        permissions,
+    MustChangePassword: mustChangePassword,
+    MustEnrollMFA:      mustEnrollMFA,
+  })
+  if err != nil {
+    return models.AuthResponse{}, errors.New("Failed to generate token")
+  }
+
+  return models.AuthResponse{
+    Token:              token,
+    RefreshToken:       sessionID + "." + secret,
+    ExpiresAt:          expiresAt,
+    Role:               role,
+    ID:                 id,
+    Permissions:        permissions,
+    MustChangePassword: mustChangePassword,
+    MustEnrollMFA:      mustEnrollMFA,
+  }, nil
+}
+
+func revokeSession(sessionID string) error {
+  _, err := database.DB.Exec(context.Background(), `CALL revoke_session($1)`, sessionID)
+  if err != nil {
+    return err
+  }
+  revocations.add(sessionID, time.Now())
+  return nil
+}
+
+func revokeUserSessions(id int, role string) error {
+  rows, err := database.DB.Query(context.Background(), `SELECT revoke_user_sessions($1, $2)`, id, role)
+  if err != nil {
+    return err
+  }
+  defer rows.Close()
+
+  now := time.Now()
+  for rows.Next() {
+    var sessionID string
+    if err := rows.Scan(&sessionID); err != nil {
+      return err
+    }
+    revocations.add(sessionID, now)
+  }
+  return rows.Err()
+}
+
+func RefreshToken(c fiber.Ctx) error {
+  req := new(models.RefreshRequest)
+
+  if err := c.Bind().Body(req); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  sessionID, secret, ok := splitRefreshToken(req.RefreshToken)
+  if !ok {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+  }
+
+  var userID int
+  var userRole string
+  var storedHash string
+  query := `SELECT user_id, user_role, refresh_token_hash FROM get_active_session($1)`
+  err := database.DB.QueryRow(context.Background(), query, sessionID).Scan(&userID, &userRole, &storedHash)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  if subtle.ConstantTimeCompare([]byte(hashRefreshSecret(secret)), []byte(storedHash)) != 1 {
+    // An already rotated token was replayed, assume it was stolen and end the session for everyone
+    if err := revokeSession(sessionID); err != nil {
+      println("Failed to revoke session:", err.Error())
+    }
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+  }
+
+  newSecret, err := randomToken(32)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  query = `CALL rotate_session($1, $2, $3, $4)`
+  _, err = database.DB.Exec(context.Background(), query, sessionID, storedHash, hashRefreshSecret(newSecret), time.Now().Add(config.Current.RefreshTokenTTL))
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  var mustChangePassword bool
+  query = `SELECT must_change_password FROM get_user_credentials($1, $2)`
+  if err := database.DB.QueryRow(context.Background(), query, userID, userRole).Scan(&mustChangePassword); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  response, err := sessionResponse(sessionID, newSecret, userID, userRole, mustChangePassword)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  return c.JSON(response)
+}
+
+func Logout(c fiber.Ctx) error {
+  sessionID := c.Locals("sessionID").(string)
+
+  if err := revokeSession(sessionID); err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Logged out successfully"})
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+  "context"
+)
+
+/// Loads the signing keys and starts the background work of the handlers. Must be called once the database is
+/// connected at the expected schema version and before serving, the background work stops when ctx is done.
+func Start(ctx context.Context) {
+  Keys = mustLoadKeyRing()
+  transcriptKeys = mustLoadTranscriptKeys()
+
+  store := newLoginAttemptStore()
+  accountLimiter.Store = store
+  ipLimiter.Store = store
+
+  revocations.start(ctx)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+  "context"
+  "strconv"
+
+  "backend/database"
+  "backend/models"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Terms ordered by ID, termID nil loads all of them
+func loadTerms(termID *int) ([]models.Term, error) {
+  query := `SELECT id, name, start_date, end_date, enrollment_opens, enrollment_closes, grades_due FROM get_terms($1)`
+  rows, err := database.DB.Query(context.Background(), query, termID)
+  if err != nil {
+    return nil, err
+  }
+  defer rows.Close()
+
+  terms := []models.Term{}
+  for rows.Next() {
+    term := models.Term{}
+    err := rows.Scan(
+      &term.ID,
+      &term.Name,
+      &term.StartDate,
+      &term.EndDate,
+      &term.EnrollmentOpens,
+      &term.EnrollmentCloses,
+      &term.GradesDue,
+    )
+    if err != nil {
+      return nil, err
+    }
+    terms = append(terms, term)
+  }
+
+  return terms, rows.Err()
+}
+
+func GetTerms(c fiber.Ctx) error {
+  terms, err := loadTerms(nil)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(terms)
+}
+
+func GetTerm(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid term ID")
+  }
+
+  terms, err := loadTerms(&id)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.JSON(terms[0])
+}
+
+func CreateTerm(c fiber.Ctx) error {
+  term := new(models.Term)
+  if err := c.Bind().JSON(term); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if term.ID <= 0 {
+    return sendBadRequestError(c, "Term ID is required")
+  }
+  if term.Name == "" {
+    return sendBadRequestError(c, "Term name is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL create_term($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+  _, err := database.DB.Exec(context.Background(), query,
+    term.ID,
+    term.Name,
+    term.StartDate,
+    term.EndDate,
+    term.EnrollmentOpens,
+    term.EnrollmentCloses,
+    term.GradesDue,
+    userID,
+    userRole,
+  )
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  terms, err := loadTerms(&term.ID)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusCreated).JSON(terms[0])
+}
+
+func UpdateTerm(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid term ID")
+  }
+
+  term := new(models.Term)
+  if err := c.Bind().JSON(term); err != nil {
+    return sendBadRequestError(c, "Invalid request body")
+  }
+
+  if term.Name == "" {
+    return sendBadRequestError(c, "Term name is required")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL update_term($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+  _, err = database.DB.Exec(context.Background(), query,
+    id,
+    term.Name,
+    term.StartDate,
+    term.EndDate,
+    term.EnrollmentOpens,
+    term.EnrollmentCloses,
+    term.GradesDue,
+    userID,
+    userRole,
+  )
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Term updated successfully"})
+}
+
+func DeleteTerm(c fiber.Ctx) error {
+  id, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid term ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  query := `CALL delete_term($1, $2, $3)`
+  _, err = database.DB.Exec(context.Background(), query, id, userID, userRole)
+
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Term deleted successfully"})
+}
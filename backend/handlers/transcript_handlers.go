@@ -0,0 +1,257 @@
+package handlers
+
+import (
+  "context"
+  "crypto/ed25519"
+  "crypto/rand"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "fmt"
+  "log"
+  "os"
+  "strconv"
+  "time"
+
+  "backend/config"
+  "backend/database"
+  "backend/models"
+  "backend/transcript"
+
+  "github.com/goccy/go-json"
+  "github.com/gofiber/fiber/v3"
+)
+
+// Ed25519 keys used to sign PDF transcripts, loaded from the PEM files of TRANSCRIPT_SIGNING_KEYS.
+// The first key signs new documents, the others are only kept to verify documents issued before a rotation.
+type transcriptKeyRing struct {
+  active *signingKey
+  keys   map[string]*signingKey
+}
+
+// Loaded by Start, nil when PDF transcripts are disabled
+var transcriptKeys *transcriptKeyRing
+
+func mustLoadTranscriptKeys() *transcriptKeyRing {
+  paths := config.Current.TranscriptSigningKeys
+  if len(paths) == 0 {
+    if !config.Current.Debug {
+      // A key that only lives in memory would make every issued document fail verification after a restart or on another replica
+      log.Println("TRANSCRIPT_SIGNING_KEYS not set, PDF transcripts are disabled")
+      return nil
+    }
+    log.Println("TRANSCRIPT_SIGNING_KEYS not set, using an ephemeral Ed25519 transcript signing key as DEBUG=true")
+    _, private, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+      log.Fatalf("Unable to generate transcript signing key: %v\n", err)
+    }
+    key, err := newSigningKey(private)
+    if err != nil {
+      log.Fatalf("Unable to generate transcript signing key: %v\n", err)
+    }
+    ring := &transcriptKeyRing{keys: map[string]*signingKey{}}
+    ring.add(key)
+    return ring
+  }
+
+  ring, err := loadTranscriptKeys(paths)
+  if err != nil {
+    log.Fatalf("Unable to load transcript signing keys: %v\n", err)
+  }
+  return ring
+}
+
+/// Reads the Ed25519 PEM files in order, the first one becomes the active key
+func loadTranscriptKeys(paths []string) (*transcriptKeyRing, error) {
+  ring := &transcriptKeyRing{keys: map[string]*signingKey{}}
+  for _, path := range paths {
+    data, err := os.ReadFile(path)
+    if err != nil {
+      return nil, fmt.Errorf("reading %s: %v", path, err)
+    }
+    key, err := parseSigningKey(data)
+    if err != nil {
+      return nil, fmt.Errorf("parsing %s: %v", path, err)
+    }
+    if _, ok := key.private.Public().(ed25519.PublicKey); !ok {
+      return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+    }
+    ring.add(key)
+  }
+  return ring, nil
+}
+
+func (r *transcriptKeyRing) add(key *signingKey) {
+  if _, ok := r.keys[key.kid]; ok {
+    return
+  }
+  if r.active == nil {
+    r.active = key
+  }
+  r.keys[key.kid] = key
+}
+
+/// Sign with the active key, returns the key ID and the base64 encoded signature
+func (r *transcriptKeyRing) sign(payload []byte) (string, string) {
+  signature := ed25519.Sign(r.active.private.(ed25519.PrivateKey), payload)
+  return r.active.kid, base64.StdEncoding.EncodeToString(signature)
+}
+
+/// Check a signature made by sign, fails for keys that are no longer configured and when no keys are
+func (r *transcriptKeyRing) verify(kid string, payload []byte, signature string) (ed25519.PublicKey, bool) {
+  if r == nil {
+    return nil, false
+  }
+  key, ok := r.keys[kid]
+  if !ok {
+    return nil, false
+  }
+  public := key.private.Public().(ed25519.PublicKey)
+  raw, err := base64.StdEncoding.DecodeString(signature)
+  if err != nil {
+    return public, false
+  }
+  return public, ed25519.Verify(public, payload, raw)
+}
+
+/// Public URL a third party can check the document at, PUBLIC_BASE_URL is where this API is reachable
+func verifyURL(c fiber.Ctx, docID string) string {
+  base := config.Current.PublicBaseURL
+  if base == "" {
+    base = c.BaseURL()
+  }
+  return base + "/verify/" + docID
+}
+
+/// Group graded courses by semester, courses without a grade or mark are in progress. GPAs and credits are taken from the GPA report.
+func buildTranscriptDocument(docID string, t models.StudentTranscript, gpa models.GPAReport) models.TranscriptDocument {
+  doc := models.TranscriptDocument{
+    DocumentID:    docID,
+    StudentID:     t.StudentID,
+    StudentName:   t.StudentName,
+    IssuedAt:      time.Now().UTC().Truncate(time.Second),
+    Semesters:     []models.TranscriptSemester{},
+    InProgress:    []models.TranscriptCourse{},
+    RetakePolicy:  gpa.RetakePolicy,
+    CreditsEarned: gpa.CreditsEarned,
+    CGPA:          gpa.GPA,
+    CGPAMark:      gpa.GPAMark,
+  }
+
+  courses := map[int][]models.TranscriptCourse{}
+  for _, course := range t.Courses {
+    if course.Semester == nil || (course.Grade == nil && course.Mark == nil) {
+      doc.InProgress = append(doc.InProgress, course)
+      continue
+    }
+    courses[*course.Semester] = append(courses[*course.Semester], course)
+  }
+
+  // The report has a row for every semester with a grade or mark, in order
+  for _, semester := range gpa.Semesters {
+    doc.Semesters = append(doc.Semesters, models.TranscriptSemester{
+      Semester:      semester.Semester,
+      TermName:      semester.TermName,
+      Courses:       courses[semester.Semester],
+      Credits:       semester.CreditsAttempted,
+      CreditsEarned: semester.CreditsEarned,
+      GPA:           semester.SGPA,
+      GPAMark:       semester.SGPAMark,
+      CGPA:          semester.CGPA,
+      CGPAMark:      semester.CGPAMark,
+    })
+  }
+
+  return doc
+}
+
+func GetStudentTranscriptPDF(c fiber.Ctx) error {
+  if transcriptKeys == nil {
+    return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "PDF transcripts are disabled, TRANSCRIPT_SIGNING_KEYS is not configured"})
+  }
+
+  studentID, err := strconv.Atoi(c.Params("id"))
+  if err != nil {
+    return sendBadRequestError(c, "Invalid student ID")
+  }
+
+  userRole := c.Locals("userRole").(string)
+  userID := c.Locals("userID").(int)
+
+  records, err := loadTranscript(studentID, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  gpa, err := loadGPAReport(studentID, userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  docID, err := randomToken(16)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+
+  doc := buildTranscriptDocument(docID, records, gpa)
+  payload, err := json.Marshal(doc)
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  keyID, signature := transcriptKeys.sign(payload)
+
+  pdf, err := transcript.Render(doc, transcript.Options{
+    Institution: config.Current.InstitutionName,
+    VerifyURL:   verifyURL(c, docID),
+    KeyID:       keyID,
+    Signature:   signature,
+  })
+  if err != nil {
+    return sendInternalServerError(c, err)
+  }
+  sum := sha256.Sum256(pdf)
+
+  query := `CALL create_transcript_document($1, $2, $3, $4, $5, $6, $7, $8)`
+  _, err = database.DB.Exec(context.Background(), query, docID, studentID, string(payload), signature, keyID, hex.EncodeToString(sum[:]), userID, userRole)
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  c.Set(fiber.HeaderContentType, "application/pdf")
+  c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="transcript-%d.pdf"`, studentID))
+  return c.Send(pdf)
+}
+
+func VerifyTranscript(c fiber.Ctx) error {
+  docID := c.Params("docId")
+
+  var studentID int
+  var payload string
+  result := models.TranscriptVerification{}
+  query := `SELECT id, student_id, issued_at, payload, signature, key_id, pdf_sha256 FROM get_transcript_document($1)`
+  err := database.DB.QueryRow(context.Background(), query, docID).Scan(
+    &result.DocumentID,
+    &studentID,
+    &result.IssuedAt,
+    &payload,
+    &result.Signature,
+    &result.KeyID,
+    &result.PDFSHA256,
+  )
+  if err != nil {
+    return handleDatabaseError(c, err)
+  }
+
+  public, valid := transcriptKeys.verify(result.KeyID, []byte(payload), result.Signature)
+  if public != nil {
+    result.PublicKey = base64.StdEncoding.EncodeToString(public)
+  }
+
+  if err := json.Unmarshal([]byte(payload), &result.Transcript); err != nil {
+    return sendInternalServerError(c, err)
+  }
+  // The signed payload must describe the document it is stored under
+  result.Valid = valid && result.Transcript.DocumentID == result.DocumentID && result.Transcript.StudentID == studentID
+
+  return c.JSON(result)
+}
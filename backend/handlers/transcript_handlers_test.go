@@ -0,0 +1,119 @@
+package handlers
+
+import (
+  "bytes"
+  "crypto/ecdsa"
+  "crypto/ed25519"
+  "crypto/elliptic"
+  "crypto/rand"
+  "crypto/x509"
+  "encoding/pem"
+  "os"
+  "path/filepath"
+  "testing"
+
+  "backend/models"
+
+  "github.com/goccy/go-json"
+)
+
+/// Writes key as a PKCS #8 PEM file in dir and returns its path
+func writeTestKey(t *testing.T, dir, name string, key any) string {
+  t.Helper()
+  der, err := x509.MarshalPKCS8PrivateKey(key)
+  if err != nil {
+    t.Fatal(err)
+  }
+  path := filepath.Join(dir, name)
+  if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+    t.Fatal(err)
+  }
+  return path
+}
+
+func newTestEd25519Key(t *testing.T) ed25519.PrivateKey {
+  t.Helper()
+  _, private, err := ed25519.GenerateKey(rand.Reader)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return private
+}
+
+func TestTranscriptSignatureVerifiesWithReloadedKeys(t *testing.T) {
+  dir := t.TempDir()
+  oldPath := writeTestKey(t, dir, "old.pem", newTestEd25519Key(t))
+  newPath := writeTestKey(t, dir, "new.pem", newTestEd25519Key(t))
+
+  signer, err := loadTranscriptKeys([]string{oldPath})
+  if err != nil {
+    t.Fatal(err)
+  }
+  doc := buildTranscriptDocument("doc-1", models.StudentTranscript{StudentID: 7, StudentName: "Test Student"}, models.GPAReport{})
+  payload, err := json.Marshal(doc)
+  if err != nil {
+    t.Fatal(err)
+  }
+  keyID, signature := signer.sign(payload)
+  tampered := bytes.Replace(payload, []byte("Test Student"), []byte("Other Student"), 1)
+
+  tests := []struct {
+    name    string
+    paths   []string
+    payload []byte
+    valid   bool
+  }{
+    {"same key after a restart", []string{oldPath}, payload, true},
+    {"retired key kept after a rotation", []string{newPath, oldPath}, payload, true},
+    {"retired key removed", []string{newPath}, payload, false},
+    {"tampered payload", []string{oldPath}, tampered, false},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      verifier, err := loadTranscriptKeys(test.paths)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if _, valid := verifier.verify(keyID, test.payload, signature); valid != test.valid {
+        t.Errorf("valid = %v, want %v", valid, test.valid)
+      }
+    })
+  }
+}
+
+func TestTranscriptKeysSignWithTheFirstKey(t *testing.T) {
+  dir := t.TempDir()
+  first := writeTestKey(t, dir, "first.pem", newTestEd25519Key(t))
+  second := writeTestKey(t, dir, "second.pem", newTestEd25519Key(t))
+
+  ring, err := loadTranscriptKeys([]string{first, second})
+  if err != nil {
+    t.Fatal(err)
+  }
+  only, err := loadTranscriptKeys([]string{first})
+  if err != nil {
+    t.Fatal(err)
+  }
+  keyID, _ := ring.sign([]byte("{}"))
+  if keyID != only.active.kid {
+    t.Errorf("signed with %s, want the first key %s", keyID, only.active.kid)
+  }
+}
+
+func TestLoadTranscriptKeysRejectsOtherKeyTypes(t *testing.T) {
+  private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+  if err != nil {
+    t.Fatal(err)
+  }
+  path := writeTestKey(t, t.TempDir(), "ecdsa.pem", private)
+  if _, err := loadTranscriptKeys([]string{path}); err == nil {
+    t.Error("expected an error for an ECDSA key")
+  }
+}
+
+func TestVerifyWithoutTranscriptKeys(t *testing.T) {
+  var ring *transcriptKeyRing
+  if public, valid := ring.verify("kid", []byte("{}"), ""); public != nil || valid {
+    t.Error("expected documents to be invalid when PDF transcripts are disabled")
+  }
+}
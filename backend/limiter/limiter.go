@@ -0,0 +1,90 @@
+package limiter
+
+import (
+  "context"
+  "time"
+)
+
+// Storage for failure counters and lockouts, implementations must be safe for concurrent use
+type Store interface {
+  /// Increment the failure counter of key and return the new count.
+  /// Counters that have not been incremented for longer than window start over.
+  Increment(ctx context.Context, key string, window time.Duration) (int, error)
+
+  /// Lock key until the given time
+  Lock(ctx context.Context, key string, until time.Time) error
+
+  /// Time until which key is locked, the zero time if it is not locked
+  LockedUntil(ctx context.Context, key string) (time.Time, error)
+
+  /// Forget the counter and any lockout of key
+  Reset(ctx context.Context, key string) error
+}
+
+// Locks keys out with exponential backoff once they failed Threshold times within Window
+type Limiter struct {
+  Store Store
+
+  // Failures allowed before the first lockout
+  Threshold int
+
+  // Length of the first lockout, doubled for every further failure
+  BaseLockout time.Duration
+
+  // Upper bound of a single lockout
+  MaxLockout time.Duration
+
+  // Failures older than this are forgotten
+  Window time.Duration
+
+  // Clock of lockouts, time.Now if nil
+  Now func() time.Time
+}
+
+func (l *Limiter) now() time.Time {
+  if l.Now == nil {
+    return time.Now()
+  }
+  return l.Now()
+}
+
+/// Lockout duration after the given number of failures
+func (l *Limiter) lockout(failures int) time.Duration {
+  if failures < l.Threshold {
+    return 0
+  }
+
+  lockout := l.BaseLockout
+  for i := l.Threshold; i < failures && lockout < l.MaxLockout; i++ {
+    lockout *= 2
+  }
+  return min(lockout, l.MaxLockout)
+}
+
+/// Time left until key is unlocked, zero if it is not locked
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+  until, err := l.Store.LockedUntil(ctx, key)
+  if err != nil {
+    return 0, err
+  }
+  return max(until.Sub(l.now()), 0), nil
+}
+
+/// Record a failure for key, returns the lockout that is now in effect (zero if none)
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+  failures, err := l.Store.Increment(ctx, key, l.Window)
+  if err != nil {
+    return 0, err
+  }
+
+  lockout := l.lockout(failures)
+  if lockout == 0 {
+    return 0, nil
+  }
+  return lockout, l.Store.Lock(ctx, key, l.now().Add(lockout))
+}
+
+/// Clear the failures of key, e.g. after a successful login
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+  return l.Store.Reset(ctx, key)
+}
@@ -0,0 +1,99 @@
+package limiter
+
+import (
+  "context"
+  "sync"
+  "time"
+)
+
+type memoryEntry struct {
+  failures    int
+  lastFailure time.Time
+  lockedUntil time.Time
+}
+
+// Store that keeps counters in process, only suitable for a single replica
+type MemoryStore struct {
+  mu      sync.Mutex
+  entries map[string]*memoryEntry
+
+  // Clock of failure windows, time.Now if nil
+  Now func() time.Time
+}
+
+/// Create a MemoryStore, entries idle for longer than retention are dropped periodically
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+  s := &MemoryStore{entries: map[string]*memoryEntry{}}
+  go s.cleanupLoop(retention)
+  return s
+}
+
+func (s *MemoryStore) now() time.Time {
+  if s.Now == nil {
+    return time.Now()
+  }
+  return s.Now()
+}
+
+func (s *MemoryStore) Increment(_ context.Context, key string, window time.Duration) (int, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  now := s.now()
+  entry, ok := s.entries[key]
+  if !ok {
+    entry = &memoryEntry{}
+    s.entries[key] = entry
+  }
+  if now.Sub(entry.lastFailure) > window {
+    entry.failures = 0
+  }
+  entry.failures++
+  entry.lastFailure = now
+  return entry.failures, nil
+}
+
+func (s *MemoryStore) Lock(_ context.Context, key string, until time.Time) error {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  entry, ok := s.entries[key]
+  if !ok {
+    entry = &memoryEntry{}
+    s.entries[key] = entry
+  }
+  entry.lockedUntil = until
+  return nil
+}
+
+func (s *MemoryStore) LockedUntil(_ context.Context, key string) (time.Time, error) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  if entry, ok := s.entries[key]; ok {
+    return entry.lockedUntil, nil
+  }
+  return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+  s.mu.Lock()
+  delete(s.entries, key)
+  s.mu.Unlock()
+  return nil
+}
+
+func (s *MemoryStore) cleanupLoop(retention time.Duration) {
+  ticker := time.NewTicker(retention)
+  defer ticker.Stop()
+
+  for now := range ticker.C {
+    s.mu.Lock()
+    for key, entry := range s.entries {
+      if now.Sub(entry.lastFailure) > retention && now.After(entry.lockedUntil) {
+        delete(s.entries, key)
+      }
+    }
+    s.mu.Unlock()
+  }
+}
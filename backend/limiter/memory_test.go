@@ -0,0 +1,179 @@
+package limiter
+
+import (
+  "context"
+  "testing"
+  "time"
+)
+
+type fakeClock struct {
+  now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+  return c.now
+}
+
+func newTestLimiter(clock *fakeClock) *Limiter {
+  return &Limiter{
+    Store:       &MemoryStore{entries: map[string]*memoryEntry{}, Now: clock.Now},
+    Threshold:   3,
+    BaseLockout: 30 * time.Second,
+    MaxLockout:  5 * time.Minute,
+    Window:      time.Hour,
+    Now:         clock.Now,
+  }
+}
+
+func TestLimiter(t *testing.T) {
+  // A step advances the clock, then fails the key, resets it or only waits, and checks the lockout
+  // a failure caused and the time left that Check reports afterwards
+  type step struct {
+    advance   time.Duration
+    reset     bool
+    wait      bool
+    lockout   time.Duration
+    remaining time.Duration
+  }
+  tests := []struct {
+    name  string
+    steps []step
+  }{
+    {"threshold", []step{
+      {lockout: 0},
+      {lockout: 0},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+    }},
+    {"lockout expires", []step{
+      {},
+      {},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+      {advance: 10 * time.Second, wait: true, remaining: 20 * time.Second},
+      {advance: 20 * time.Second, wait: true, remaining: 0},
+      {lockout: time.Minute, remaining: time.Minute},
+    }},
+    {"exponential backoff capped", []step{
+      {},
+      {},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+      {advance: 30 * time.Second, lockout: time.Minute, remaining: time.Minute},
+      {advance: time.Minute, lockout: 2 * time.Minute, remaining: 2 * time.Minute},
+      {advance: 2 * time.Minute, lockout: 4 * time.Minute, remaining: 4 * time.Minute},
+      {advance: 4 * time.Minute, lockout: 5 * time.Minute, remaining: 5 * time.Minute},
+      {advance: 5 * time.Minute, lockout: 5 * time.Minute, remaining: 5 * time.Minute},
+    }},
+    {"reset after success", []step{
+      {},
+      {},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+      {reset: true},
+      {lockout: 0},
+      {lockout: 0},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+    }},
+    {"failures expire after the window", []step{
+      {},
+      {advance: 59 * time.Minute},
+      {advance: time.Hour + time.Second, lockout: 0},
+      {lockout: 0},
+      {lockout: 30 * time.Second, remaining: 30 * time.Second},
+    }},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      ctx := context.Background()
+      clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+      l := newTestLimiter(clock)
+
+      for i, step := range test.steps {
+        clock.now = clock.now.Add(step.advance)
+        if step.reset {
+          if err := l.Reset(ctx, "key"); err != nil {
+            t.Fatal(err)
+          }
+        } else if !step.wait {
+          lockout, err := l.Fail(ctx, "key")
+          if err != nil {
+            t.Fatal(err)
+          }
+          if lockout != step.lockout {
+            t.Errorf("step %d: lockout = %v, want %v", i, lockout, step.lockout)
+          }
+        }
+
+        remaining, err := l.Check(ctx, "key")
+        if err != nil {
+          t.Fatal(err)
+        }
+        if remaining != step.remaining {
+          t.Errorf("step %d: remaining = %v, want %v", i, remaining, step.remaining)
+        }
+      }
+    })
+  }
+}
+
+func TestLimiterLockoutCountsDown(t *testing.T) {
+  ctx := context.Background()
+  clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+  l := newTestLimiter(clock)
+  for range l.Threshold {
+    if _, err := l.Fail(ctx, "key"); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  tests := []struct {
+    elapsed time.Duration
+    want    time.Duration
+  }{
+    {0, 30 * time.Second},
+    {10 * time.Second, 20 * time.Second},
+    {30 * time.Second, 0},
+    {time.Hour, 0},
+  }
+  start := clock.now
+  for _, test := range tests {
+    clock.now = start.Add(test.elapsed)
+    got, err := l.Check(ctx, "key")
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got != test.want {
+      t.Errorf("after %v: Check = %v, want %v", test.elapsed, got, test.want)
+    }
+  }
+
+  if got, _ := l.Check(ctx, "other"); got != 0 {
+    t.Errorf("Check of another key = %v, want 0", got)
+  }
+}
+
+func TestMemoryStoreIncrement(t *testing.T) {
+  ctx := context.Background()
+  clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+  store := &MemoryStore{entries: map[string]*memoryEntry{}, Now: clock.Now}
+
+  tests := []struct {
+    key     string
+    advance time.Duration
+    want    int
+  }{
+    {"a", 0, 1},
+    {"a", time.Minute, 2},
+    {"b", 0, 1},
+    {"a", time.Hour, 3},
+    {"a", time.Hour + time.Nanosecond, 1},
+    {"b", 0, 1},
+  }
+  for i, test := range tests {
+    clock.now = clock.now.Add(test.advance)
+    got, err := store.Increment(ctx, test.key, time.Hour)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if got != test.want {
+      t.Errorf("step %d: Increment(%s) = %d, want %d", i, test.key, got, test.want)
+    }
+  }
+}
@@ -0,0 +1,40 @@
+package limiter
+
+import (
+  "context"
+  "time"
+
+  "github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Store backed by the login_attempts table, shared by all replicas
+type PostgresStore struct {
+  DB *pgxpool.Pool
+}
+
+func (s *PostgresStore) Increment(ctx context.Context, key string, window time.Duration) (int, error) {
+  var failures int
+  err := s.DB.QueryRow(ctx, `SELECT record_login_failure($1, $2)`, key, window).Scan(&failures)
+  return failures, err
+}
+
+func (s *PostgresStore) Lock(ctx context.Context, key string, until time.Time) error {
+  _, err := s.DB.Exec(ctx, `CALL lock_login_key($1, $2)`, key, until)
+  return err
+}
+
+func (s *PostgresStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+  var until *time.Time
+  if err := s.DB.QueryRow(ctx, `SELECT get_login_locked_until($1)`, key).Scan(&until); err != nil {
+    return time.Time{}, err
+  }
+  if until == nil {
+    return time.Time{}, nil
+  }
+  return *until, nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+  _, err := s.DB.Exec(ctx, `CALL reset_login_key($1)`, key)
+  return err
+}
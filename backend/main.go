@@ -1,39 +1,78 @@
 package main
 
 import (
+  "context"
+  "io"
   "log"
   "os"
   "time"
 
-  "backend/common"
+  "backend/config"
   "backend/common/fiberzerolog"
+  "backend/database"
+  "backend/handlers"
+  "backend/metrics"
+  "backend/middleware"
   "backend/routes"
 
   utils "github.com/ItsMeSamey/go_utils"
   "github.com/goccy/go-json"
   "github.com/gofiber/fiber/v3"
+  "github.com/gofiber/fiber/v3/middleware/adaptor"
   "github.com/gofiber/fiber/v3/middleware/cors"
   fiberRecover "github.com/gofiber/fiber/v3/middleware/recover"
+  "github.com/rs/zerolog"
+  "github.com/rs/zerolog/diode"
 )
 
 func main() {
-  utils.SetErrorStackTrace(common.IsDebug)
+  config.MustLoad()
+
+  if len(os.Args) > 1 && os.Args[1] == "migrate" {
+    database.Connect(false)
+    runMigrate(os.Args[2:])
+    return
+  }
+
+  database.Connect(true)
+  ctx, stopHandlers := context.WithCancel(context.Background())
+  handlers.Start(ctx)
+
+  utils.SetErrorStackTrace(config.Current.Debug)
 
   app := fiber.New(fiber.Config{
     CaseSensitive:      true,
     Concurrency:        1024 * 1024,
-    IdleTimeout:        30 * time.Second,
+    IdleTimeout:        config.Current.IdleTimeout,
+    ReadTimeout:        config.Current.ReadTimeout,
+    WriteTimeout:       config.Current.WriteTimeout,
     DisableDefaultDate: true,
     JSONEncoder:        json.Marshal,
     JSONDecoder:        json.Unmarshal,
+    // c.IP() takes the client address from ProxyHeader only for requests of a trusted proxy, the login limiters key on it
+    ProxyHeader:        config.Current.ProxyHeader,
+    TrustProxy:         config.Current.ProxyHeader != "",
+    TrustProxyConfig:   fiber.TrustProxyConfig{Proxies: config.Current.TrustedProxies},
+    EnableIPValidation: true,
   })
 
-  app.Use(cors.New())
-  app.Use(fiberRecover.New(fiberRecover.Config{EnableStackTrace: common.IsDebug}))
+  app.Use(middleware.Metrics)
+  app.Use(cors.New(cors.Config{AllowOrigins: config.Current.CORSOrigins}))
+  app.Use(fiberRecover.New(fiberRecover.Config{EnableStackTrace: config.Current.Debug}))
 
-  // Console logging
-  if os.Getenv("ZEROLOG") == "true" || (common.IsDebug && os.Getenv("ZEROLOG") != "false") {
-    app.Use(fiberzerolog.New())
+  // Console logging, buffered so a slow terminal does not hold up requests
+  var logWriter io.Closer
+  if config.Current.Zerolog {
+    writer := diode.NewWriter(os.Stderr, 1000, 10*time.Millisecond, func(missed int) {
+      log.Printf("Dropped %d request log lines\n", missed)
+    })
+    logWriter = writer
+    logger := zerolog.New(writer).With().Timestamp().Logger()
+    app.Use(fiberzerolog.New(fiberzerolog.Config{
+      Logger: &logger,
+      // Probed every few seconds, logging them would drown out real requests
+      SkipURIs: []string{"/healthz", "/readyz"},
+    }))
     log.Println("Zerolog logging enabled")
   } else {
     log.Println("Zerolog logging [[DISABLED]]")
@@ -41,10 +80,13 @@ func main() {
   
   routes.SetupRoutes(app)
 
-  log.Fatal(
-    app.Listen("0.0.0.0:3000", fiber.ListenConfig{
-      EnablePrintRoutes: true,
-    }),
-  )
+  // On its own listener so it can stay on an internal interface, away from the public API
+  var metricsApp *fiber.App
+  if config.Current.MetricsListenAddress != "" {
+    metricsApp = fiber.New(fiber.Config{DisableDefaultDate: true})
+    metricsApp.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+  }
+
+  os.Exit(serve(app, metricsApp, logWriter, stopHandlers))
 }
 
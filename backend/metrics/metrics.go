@@ -0,0 +1,35 @@
+package metrics
+
+import (
+  "log"
+  "net/http"
+
+  "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/collectors"
+  "github.com/prometheus/client_golang/prometheus/promauto"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Upper bounds in seconds for request latencies, from 5ms to 10s
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Every metric served on /metrics: the Go runtime and process metrics, and those registered through With.
+// Kept apart from the global registry so libraries can not add metrics of their own.
+var Registry = newRegistry()
+
+// Registers metrics with Registry, registering a name twice or with an invalid name panics
+var With = promauto.With(Registry)
+
+func newRegistry() *prometheus.Registry {
+  registry := prometheus.NewRegistry()
+  registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+  return registry
+}
+
+/// Serves Registry in the Prometheus text format, or as OpenMetrics to scrapers asking for it
+func Handler() http.Handler {
+  return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{
+    ErrorLog:          log.Default(),
+    EnableOpenMetrics: true,
+  })
+}
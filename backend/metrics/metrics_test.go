@@ -0,0 +1,118 @@
+package metrics
+
+import (
+  "math"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+
+  "github.com/prometheus/client_golang/prometheus"
+  dto "github.com/prometheus/client_model/go"
+  "github.com/prometheus/common/expfmt"
+)
+
+/// Scrapes Handler in the text format and parses the result
+func scrape(t *testing.T) map[string]*dto.MetricFamily {
+  t.Helper()
+  recorder := httptest.NewRecorder()
+  Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+  if recorder.Code != http.StatusOK {
+    t.Fatalf("status %d: %s", recorder.Code, recorder.Body)
+  }
+
+  var parser expfmt.TextParser
+  families, err := parser.TextToMetricFamilies(recorder.Body)
+  if err != nil {
+    t.Fatalf("unable to parse the scrape: %v", err)
+  }
+  return families
+}
+
+/// Value of the label name of m, empty when missing
+func label(m *dto.Metric, name string) string {
+  for _, pair := range m.GetLabel() {
+    if pair.GetName() == name {
+      return pair.GetValue()
+    }
+  }
+  return ""
+}
+
+func TestScrapeParses(t *testing.T) {
+  counter := With.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "Requests\nby route."}, []string{"route"})
+  histogram := With.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds", Help: "Durations.", Buckets: DefaultBuckets}, []string{"route"})
+  With.NewGaugeFunc(prometheus.GaugeOpts{Name: "test_pool_conns", Help: "Connections."}, func() float64 { return 7 })
+
+  // Quotes, backslashes and newlines have to be escaped in label values
+  route := "/a\"b\\c\nd"
+  counter.WithLabelValues(route).Add(2)
+  counter.WithLabelValues("/plain").Inc()
+  for _, v := range []float64{0.003, 0.2, 20} {
+    histogram.WithLabelValues(route).Observe(v)
+  }
+
+  families := scrape(t)
+
+  requests := families["test_requests_total"]
+  if requests == nil || requests.GetType() != dto.MetricType_COUNTER || requests.GetHelp() != "Requests\nby route." {
+    t.Fatalf("unexpected family %v", requests)
+  }
+  values := map[string]float64{}
+  for _, m := range requests.GetMetric() {
+    values[label(m, "route")] = m.GetCounter().GetValue()
+  }
+  if values[route] != 2 || values["/plain"] != 1 || len(values) != 2 {
+    t.Errorf("counter values %v", values)
+  }
+
+  durations := families["test_duration_seconds"]
+  if durations == nil || durations.GetType() != dto.MetricType_HISTOGRAM || len(durations.GetMetric()) != 1 {
+    t.Fatalf("unexpected family %v", durations)
+  }
+  h := durations.GetMetric()[0].GetHistogram()
+  if label(durations.GetMetric()[0], "route") != route || h.GetSampleCount() != 3 || math.Abs(h.GetSampleSum()-20.203) > 1e-9 {
+    t.Errorf("histogram count %d sum %v", h.GetSampleCount(), h.GetSampleSum())
+  }
+  // Buckets are cumulative, the observation above the last bound only counts towards +Inf
+  want := map[float64]uint64{0.005: 1, 0.01: 1, 0.1: 1, 0.25: 2, 10: 2, math.Inf(1): 3}
+  for _, bucket := range h.GetBucket() {
+    if count, ok := want[bucket.GetUpperBound()]; ok && bucket.GetCumulativeCount() != count {
+      t.Errorf("bucket %v has %d observations, want %d", bucket.GetUpperBound(), bucket.GetCumulativeCount(), count)
+    }
+  }
+  if len(h.GetBucket()) != len(DefaultBuckets)+1 {
+    t.Errorf("%d buckets, want %d and +Inf", len(h.GetBucket()), len(DefaultBuckets))
+  }
+
+  if gauge := families["test_pool_conns"]; gauge == nil || gauge.GetMetric()[0].GetGauge().GetValue() != 7 {
+    t.Errorf("unexpected gauge %v", gauge)
+  }
+  if families["go_goroutines"] == nil {
+    t.Error("expected the Go runtime metrics")
+  }
+}
+
+func TestScrapeOpenMetrics(t *testing.T) {
+  recorder := httptest.NewRecorder()
+  request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+  request.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+  Handler().ServeHTTP(recorder, request)
+
+  if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/openmetrics-text") {
+    t.Errorf("Content-Type %q", contentType)
+  }
+  if !strings.HasSuffix(recorder.Body.String(), "# EOF\n") {
+    t.Error("expected the OpenMetrics terminator")
+  }
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+  With.NewCounter(prometheus.CounterOpts{Name: "test_duplicate_total", Help: "Registered twice."})
+  defer func() {
+    if recover() == nil {
+      t.Error("expected registering the same name twice to panic")
+    }
+  }()
+  With.NewCounter(prometheus.CounterOpts{Name: "test_duplicate_total", Help: "Registered twice."})
+}
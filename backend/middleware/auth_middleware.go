@@ -1,6 +1,7 @@
 package middleware
 
 import (
+  "slices"
   "strings"
 
   "backend/handlers"
@@ -22,38 +23,57 @@ func AuthRequired(c fiber.Ctx) error {
 
   tokenString := parts[1]
 
-  token, err := jwt.ParseWithClaims(tokenString, &handlers.Claims{}, func(token *jwt.Token) (interface{}, error) {
-    return handlers.JwtSecret, nil
-  })
+  token, err := jwt.ParseWithClaims(tokenString, &handlers.Claims{}, handlers.Keys.Keyfunc, jwt.WithValidMethods(handlers.ValidSigningMethods))
 
   if err != nil {
     return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token", "details": err.Error()})
   }
 
+  // MFA challenge tokens carry no session ID and are rejected here
   claims, ok := token.Claims.(*handlers.Claims)
-  if !ok || !token.Valid {
+  if !ok || !token.Valid || claims.RegisteredClaims.ID == "" || claims.ExpiresAt == nil {
     return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
   }
 
+  if handlers.IsSessionRevoked(claims.RegisteredClaims.ID) {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token has been revoked"})
+  }
+
   c.Locals("userID", claims.ID)
   c.Locals("userRole", claims.Role)
+  c.Locals("permissions", claims.Permissions)
+  c.Locals("sessionID", claims.RegisteredClaims.ID)
+  c.Locals("tokenExpiresAt", claims.ExpiresAt.Time)
+  c.Locals("mustChangePassword", claims.MustChangePassword)
+  c.Locals("mustEnrollMFA", claims.MustEnrollMFA)
 
   return c.Next()
 }
 
-func FacultyOnly(c fiber.Ctx) error {
-  role, ok := c.Locals("userRole").(string)
-  if !ok || role != "faculty" {
-    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Faculty access required"})
+/// Rejects users that are still on a default password, must be used after AuthRequired
+func PasswordChanged(c fiber.Ctx) error {
+  if mustChange, _ := c.Locals("mustChangePassword").(bool); mustChange {
+    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Password change required", "must_change_password": true})
   }
   return c.Next()
 }
 
-func StudentOnly(c fiber.Ctx) error {
-  role, ok := c.Locals("userRole").(string)
-  if !ok || role != "student" {
-    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Student access required"})
+/// Rejects users that are required to but have not yet enrolled a second factor, must be used after AuthRequired
+func MFAEnrolled(c fiber.Ctx) error {
+  if mustEnroll, _ := c.Locals("mustEnrollMFA").(bool); mustEnroll {
+    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Two-factor enrollment required", "must_enroll_mfa": true})
   }
   return c.Next()
 }
 
+/// Rejects users whose roles do not grant the permission, must be used after AuthRequired.
+/// Stored procedures check the same permission again, this only rejects requests early.
+func Require(permission string) fiber.Handler {
+  return func(c fiber.Ctx) error {
+    permissions, _ := c.Locals("permissions").([]string)
+    if !slices.Contains(permissions, permission) {
+      return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Missing permission " + permission + "."})
+    }
+    return c.Next()
+  }
+}
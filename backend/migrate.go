@@ -0,0 +1,85 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "log"
+  "os"
+  "strconv"
+
+  "backend/database"
+)
+
+const migrateUsage = `Usage: backend migrate <command>
+  up            apply all pending migrations
+  down [steps]  revert the last migration, or the last steps migrations
+  status        list migrations and whether they are applied
+  seed          load the demo data into an empty, migrated database`
+
+/// Entry point of `backend migrate ...`, exits the process on failure
+func runMigrate(args []string) {
+  ctx := context.Background()
+  if len(args) == 0 {
+    fmt.Fprintln(os.Stderr, migrateUsage)
+    os.Exit(2)
+  }
+
+  switch args[0] {
+  case "up":
+    applied, err := database.MigrateUp(ctx)
+    for _, m := range applied {
+      log.Printf("Applied migration %04d %s\n", m.Version, m.Name)
+    }
+    if err != nil {
+      log.Fatalf("Migration failed: %v\n", err)
+    }
+    log.Printf("Database schema is at version %d\n", database.ExpectedSchemaVersion())
+
+  case "down":
+    steps := 1
+    if len(args) > 1 {
+      n, err := strconv.Atoi(args[1])
+      if err != nil || n < 1 {
+        log.Fatalf("Invalid number of steps %q\n", args[1])
+      }
+      steps = n
+    }
+    reverted, err := database.MigrateDown(ctx, steps)
+    for _, m := range reverted {
+      log.Printf("Reverted migration %04d %s\n", m.Version, m.Name)
+    }
+    if err != nil {
+      log.Fatalf("Migration failed: %v\n", err)
+    }
+
+  case "status":
+    states, err := database.MigrationStatus(ctx)
+    if err != nil {
+      log.Fatalf("Unable to read migration status: %v\n", err)
+    }
+    for _, state := range states {
+      status := "pending"
+      if state.AppliedAt != nil {
+        status = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+      }
+      if !state.Known {
+        status += " (unknown to this binary)"
+      }
+      fmt.Printf("%04d %-30s %s\n", state.Version, state.Name, status)
+    }
+    if err := database.CheckSchemaVersion(ctx); err != nil {
+      fmt.Println(err)
+      os.Exit(1)
+    }
+
+  case "seed":
+    if err := database.Seed(ctx); err != nil {
+      log.Fatalf("Seeding failed: %v\n", err)
+    }
+    log.Println("Seed data loaded")
+
+  default:
+    fmt.Fprintln(os.Stderr, migrateUsage)
+    os.Exit(2)
+  }
+}
@@ -22,31 +22,139 @@ type Faculty struct {
   Password    string    `json:"password"`
   DateOfBirth time.Time `json:"date_of_birth"`
   Info        string    `json:"info,omitempty"`
+  Roles       []string  `json:"roles"`
+  Active      bool      `json:"active"`
 }
 
+type Role struct {
+  Name        string   `json:"name"`
+  Description string   `json:"description"`
+  Permissions []string `json:"permissions"`
+}
+
+// GradingScaleID overrides the grading scale of the student's program, nil uses it
 type Course struct {
-  ID      int     `json:"id,omitempty"`
-  Code    string  `json:"code"`
-  Title   string  `json:"title"`
-  Credits float32 `json:"credits"`
+  ID             int     `json:"id,omitempty"`
+  Code           string  `json:"code"`
+  Title          string  `json:"title"`
+  Credits        float32 `json:"credits"`
+  GradingScaleID *int    `json:"grading_scale_id"`
+}
+
+type CourseInstructor struct {
+  FacultyID  int       `json:"faculty_id"`
+  Name       string    `json:"name,omitempty"`
+  AssignedAt time.Time `json:"assigned_at,omitempty"`
 }
 
+// ID is a code that sorts chronologically (e.g. 20231), all dates are inclusive
+type Term struct {
+  ID               int       `json:"id"`
+  Name             string    `json:"name"`
+  StartDate        time.Time `json:"start_date"`
+  EndDate          time.Time `json:"end_date"`
+  EnrollmentOpens  time.Time `json:"enrollment_opens"`
+  EnrollmentCloses time.Time `json:"enrollment_closes"`
+  GradesDue        time.Time `json:"grades_due"`
+}
+
+// OverridePrerequisites and OverrideReason are only read when enrolling
 type Enrollment struct {
-  ID             int       `json:"id,omitempty"`
-  StudentID      int       `json:"student_id"`
-  CourseID       int       `json:"course_id"`
-  EnrollmentDate time.Time `json:"enrollment_date"`
+  ID                    int       `json:"id,omitempty"`
+  StudentID             int       `json:"student_id"`
+  CourseID              int       `json:"course_id"`
+  TermID                int       `json:"term_id"`
+  SectionID             *int      `json:"section_id"`
+  EnrollmentDate        time.Time `json:"enrollment_date"`
+  OverridePrerequisites bool      `json:"override_prerequisites,omitempty"`
+  OverrideReason        string    `json:"override_reason,omitempty"`
+}
+
+// Requirements with the same Group are alternatives, every group must be met. Without MinGrade any passing grade
+// counts, a Corequisite may also be taken in the same term. RequiredCourseCode is ignored on update.
+type CoursePrerequisite struct {
+  Group              int      `json:"group"`
+  RequiredCourseID   int      `json:"required_course_id"`
+  RequiredCourseCode string   `json:"required_course_code"`
+  MinGrade           *float64 `json:"min_grade"`
+  Corequisite        bool     `json:"corequisite"`
 }
 
+// An enrollment made although Unmet requirements were missing, EnrollmentID is nil for a waitlisted student
+type PrerequisiteOverride struct {
+  ID           int                  `json:"id"`
+  StudentID    int                  `json:"student_id"`
+  CourseID     int                  `json:"course_id"`
+  TermID       int                  `json:"term_id"`
+  EnrollmentID *int                 `json:"enrollment_id"`
+  Unmet        []CoursePrerequisite `json:"unmet"`
+  Reason       string               `json:"reason"`
+  OverriddenBy int                  `json:"overridden_by"`
+  CreatedAt    time.Time            `json:"created_at"`
+}
+
+// Enrolled and Waitlisted are computed, they are ignored on create and update
+type CourseSection struct {
+  ID            int    `json:"id"`
+  CourseID      int    `json:"course_id"`
+  TermID        int    `json:"term_id"`
+  SectionNumber string `json:"section_number"`
+  InstructorID  *int   `json:"instructor_id"`
+  Capacity      int    `json:"capacity"`
+  Room          string `json:"room"`
+  MeetingTimes  string `json:"meeting_times"`
+  Enrolled      int    `json:"enrolled"`
+  Waitlisted    int    `json:"waitlisted"`
+}
+
+// Position is 1 for the student promoted next when a seat of the section frees up
+type WaitlistEntry struct {
+  ID            int       `json:"id"`
+  StudentID     int       `json:"student_id"`
+  SectionID     int       `json:"section_id"`
+  CourseID      int       `json:"course_id"`
+  TermID        int       `json:"term_id"`
+  SectionNumber string    `json:"section_number"`
+  Position      int       `json:"position"`
+  CreatedAt     time.Time `json:"created_at"`
+}
+
+// Grades are given as grade points, a mark of the grading scale, or both. Special marks have no points.
+// Semester is the ID of the term the grade is given in, 0 uses the term of the enrollment.
 type Grade struct {
   ID           int      `json:"id,omitempty"`
   EnrollmentID int      `json:"enrollment_id"`
   Grade        *float64 `json:"grade"`
+  Mark         *string  `json:"mark"`
   Semester     int      `json:"semester"`
 }
 
+type GradingScale struct {
+  ID        int         `json:"id,omitempty"`
+  Name      string      `json:"name"`
+  IsDefault bool        `json:"is_default"`
+  Programs  []string    `json:"programs"`
+  Marks     []GradeMark `json:"marks"`
+}
+
+// Kind is graded (has points and counts towards the GPA), pass, fail, incomplete or withdrawn
+type GradeMark struct {
+  Mark        string   `json:"mark"`
+  Description string   `json:"description"`
+  Points      *float64 `json:"points"`
+  Kind        string   `json:"kind"`
+}
+
 // API Models
 
+// Envelope of paginated lists, NextCursor is passed as ?after= to get the next page and is empty on the last one.
+// TotalCount counts all rows matching the filters.
+type Page[T any] struct {
+  Items      []T    `json:"items"`
+  NextCursor string `json:"next_cursor,omitempty"`
+  TotalCount int64  `json:"total_count"`
+}
+
 type StudentTranscript struct {
   StudentID   int              `json:"student_id"`
   StudentName string           `json:"student_name"`
@@ -60,9 +168,73 @@ type TranscriptCourse struct {
   Credits      float32  `json:"credits"` 
   GradeID      *int     `json:"grade_id,omitempty"`
   Grade        *float64 `json:"grade"`
+  Mark         *string  `json:"mark"`
+  // Term of the grade, or of the enrollment while not graded
   Semester     *int     `json:"semester"`
 }
 
+// Signed contents of a PDF transcript, courses without a grade or mark are listed as in progress.
+// GPAs are calculated with RetakePolicy, see GPAReport.
+type TranscriptDocument struct {
+  DocumentID    string               `json:"document_id"`
+  StudentID     int                  `json:"student_id"`
+  StudentName   string               `json:"student_name"`
+  IssuedAt      time.Time            `json:"issued_at"`
+  Semesters     []TranscriptSemester `json:"semesters"`
+  InProgress    []TranscriptCourse   `json:"in_progress"`
+  RetakePolicy  string               `json:"retake_policy"`
+  CreditsEarned float64              `json:"credits_earned"`
+  CGPA          float64              `json:"cgpa"`
+  CGPAMark      *string              `json:"cgpa_mark"`
+}
+
+type TranscriptSemester struct {
+  Semester      int                `json:"semester"`
+  TermName      string             `json:"term_name"`
+  Courses       []TranscriptCourse `json:"courses"`
+  Credits       float64            `json:"credits"`
+  CreditsEarned float64            `json:"credits_earned"`
+  GPA           *float64           `json:"gpa"`
+  GPAMark       *string            `json:"gpa_mark"`
+  CGPA          float64            `json:"cgpa"`
+  CGPAMark      *string            `json:"cgpa_mark"`
+}
+
+// GPA of a student with a per semester breakdown, GPA is the cumulative GPA over all semesters.
+// A course graded in several semesters counts once, picked by RetakePolicy (latest, best or average).
+type GPAReport struct {
+  StudentID        int           `json:"student_id"`
+  GPA              float64       `json:"gpa"`
+  GPAMark          *string       `json:"gpa_mark"`
+  RetakePolicy     string        `json:"retake_policy"`
+  CreditsAttempted float64       `json:"credits_attempted"`
+  CreditsEarned    float64       `json:"credits_earned"`
+  Semesters        []SemesterGPA `json:"semesters"`
+}
+
+// SGPA is nil for semesters with only special marks, marks are the equivalents on the student's grading scale
+type SemesterGPA struct {
+  Semester         int      `json:"semester"`
+  TermName         string   `json:"term_name"`
+  SGPA             *float64 `json:"sgpa"`
+  SGPAMark         *string  `json:"sgpa_mark"`
+  CreditsAttempted float64  `json:"credits_attempted"`
+  CreditsEarned    float64  `json:"credits_earned"`
+  CGPA             float64  `json:"cgpa"`
+  CGPAMark         *string  `json:"cgpa_mark"`
+}
+
+type TranscriptVerification struct {
+  Valid      bool               `json:"valid"`
+  DocumentID string             `json:"document_id"`
+  IssuedAt   time.Time          `json:"issued_at"`
+  KeyID      string             `json:"key_id"`
+  PublicKey  string             `json:"public_key,omitempty"`
+  Signature  string             `json:"signature"`
+  PDFSHA256  string             `json:"pdf_sha256"`
+  Transcript TranscriptDocument `json:"transcript"`
+}
+
 type LoginRequest struct {
   ID       int    `json:"id"`
   Password string `json:"password"`
@@ -70,8 +242,131 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-  Token string `json:"token"`
-  Role  string `json:"role"`
-  ID    int    `json:"id"`
+  Token              string    `json:"token"`
+  RefreshToken       string    `json:"refresh_token"`
+  ExpiresAt          time.Time `json:"expires_at"`
+  Role               string    `json:"role"`
+  ID                 int       `json:"id"`
+  Permissions        []string  `json:"permissions"`
+  MustChangePassword bool      `json:"must_change_password"`
+  MustEnrollMFA      bool      `json:"must_enroll_mfa"`
+}
+
+// Returned by login instead of AuthResponse when a second factor is required
+type MFAChallengeResponse struct {
+  MFARequired bool      `json:"mfa_required"`
+  MFAToken    string    `json:"mfa_token"`
+  ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type MFALoginRequest struct {
+  MFAToken string `json:"mfa_token"`
+  Code     string `json:"code"`
+}
+
+type MFACodeRequest struct {
+  Code string `json:"code"`
+}
+
+type MFADisableRequest struct {
+  Password string `json:"password"`
+  Code     string `json:"code"`
+}
+
+type MFAEnrollResponse struct {
+  Secret     string `json:"secret"`
+  OTPAuthURL string `json:"otpauth_url"`
+}
+
+type MFAConfirmResponse struct {
+  RecoveryCodes []string `json:"recovery_codes"`
+  AuthResponse
+}
+
+type RefreshRequest struct {
+  RefreshToken string `json:"refresh_token"`
+}
+
+// Profile of the authenticated user, exactly one of Student and Faculty is set
+type MeResponse struct {
+  ID                 int       `json:"id"`
+  Role               string    `json:"role"`
+  Student            *Student  `json:"student,omitempty"`
+  Faculty            *Faculty  `json:"faculty,omitempty"`
+  Permissions        []string  `json:"permissions"`
+  TokenExpiresAt     time.Time `json:"token_expires_at"`
+  MustChangePassword bool      `json:"must_change_password"`
+  MustEnrollMFA      bool      `json:"must_enroll_mfa"`
 }
 
+// A student or course matching a search, Label is the student name or course code
+type SearchResult struct {
+  Kind   string  `json:"kind"`
+  ID     int     `json:"id"`
+  Label  string  `json:"label"`
+  Detail string  `json:"detail,omitempty"`
+  Rank   float32 `json:"rank"`
+}
+
+type ImportRowError struct {
+  Row    int      `json:"row"`
+  Errors []string `json:"errors"`
+}
+
+// Summary of a bulk import, on a dry run Created is the number of rows that would be created. Waitlisted rows went onto
+// the waitlist of a full section. InitialPassword is set when imported accounts have no password yet, "date_of_birth"
+// means they sign in once with their date of birth (YYYY-MM-DD) and must then change their password.
+type ImportResult struct {
+  DryRun          bool             `json:"dry_run"`
+  Total           int              `json:"total"`
+  Created         int              `json:"created"`
+  Skipped         int              `json:"skipped"`
+  SkippedRows     []int            `json:"skipped_rows,omitempty"`
+  Waitlisted      int              `json:"waitlisted,omitempty"`
+  WaitlistedRows  []int            `json:"waitlisted_rows,omitempty"`
+  InitialPassword string           `json:"initial_password,omitempty"`
+  Errors          []ImportRowError `json:"errors"`
+}
+
+type ChangePasswordRequest struct {
+  CurrentPassword string `json:"current_password"`
+  NewPassword     string `json:"new_password"`
+}
+
+// Public signing key in JSON Web Key format (RFC 7517)
+type JWK struct {
+  Kty string `json:"kty"`
+  Kid string `json:"kid"`
+  Use string `json:"use"`
+  Alg string `json:"alg"`
+  Crv string `json:"crv,omitempty"`
+  X   string `json:"x,omitempty"`
+  N   string `json:"n,omitempty"`
+  E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+  Keys []JWK `json:"keys"`
+}
+
+// Snapshot of the database connection pool, durations in milliseconds
+type PoolStats struct {
+  TotalConns           int32 `json:"total_conns"`
+  IdleConns            int32 `json:"idle_conns"`
+  AcquiredConns        int32 `json:"acquired_conns"`
+  ConstructingConns    int32 `json:"constructing_conns"`
+  MaxConns             int32 `json:"max_conns"`
+  AcquireCount         int64 `json:"acquire_count"`
+  EmptyAcquireCount    int64 `json:"empty_acquire_count"`
+  CanceledAcquireCount int64 `json:"canceled_acquire_count"`
+  AcquireDurationMs    int64 `json:"acquire_duration_ms"`
+}
+
+// Status is ready, not_ready or shutting_down. Database is ok or describes why it can not be used.
+type Readiness struct {
+  Status                string    `json:"status"`
+  Database              string    `json:"database"`
+  SchemaVersion         int       `json:"schema_version"`
+  ExpectedSchemaVersion int       `json:"expected_schema_version"`
+  Pool                  PoolStats `json:"pool"`
+}
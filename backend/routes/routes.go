@@ -8,37 +8,114 @@ import (
 )
 
 func SetupRoutes(app fiber.Router) {
+  // Probed by load balancers and orchestrators without credentials
+  app.Get("/healthz", handlers.GetHealth)
+  app.Get("/readyz", handlers.GetReadiness)
+
+  app.Get("/.well-known/jwks.json", handlers.GetJWKS)
   app.Post("/login", handlers.Login)
+  app.Post("/login/mfa", handlers.VerifyLoginMFA)
+  app.Post("/refresh", handlers.RefreshToken)
+  app.Get("/verify/:docId", handlers.VerifyTranscript)
 
   app.Use(middleware.AuthRequired)
 
+  app.Post("/logout", handlers.Logout)
+
+  // Reachable with a default password, everything registered after PasswordChanged is not
+  meGroup := app.Group("/me")
+  meGroup.Get("/", handlers.GetMe)
+  meGroup.Post("/password", handlers.ChangePassword)
+
+  app.Use(middleware.PasswordChanged)
+
+  // Reachable before a mandatory second factor is enrolled
+  meGroup.Post("/mfa/enroll", handlers.EnrollMFA)
+  meGroup.Post("/mfa/verify", handlers.ConfirmMFA)
+  meGroup.Post("/mfa/disable", handlers.DisableMFA)
+
+  app.Use(middleware.MFAEnrolled)
+
+  lockoutGroup := app.Group("/lockouts")
+  lockoutGroup.Delete("/ip/:address", middleware.Require("accounts:unlock"), handlers.UnlockAddress)
+  lockoutGroup.Delete("/:role/:id", middleware.Require("accounts:unlock"), handlers.UnlockAccount)
+
+  app.Get("/roles", middleware.Require("faculty:manage"), handlers.GetRoles)
+
+  facultyGroup := app.Group("/faculty")
+  facultyGroup.Get("/", middleware.Require("faculty:manage"), handlers.GetFacultyMembers)
+  facultyGroup.Get("/:id", middleware.Require("faculty:manage"), handlers.GetFacultyMember)
+  facultyGroup.Post("/", middleware.Require("faculty:manage"), handlers.CreateFacultyMember)
+  facultyGroup.Put("/:id", middleware.Require("faculty:manage"), handlers.UpdateFacultyMember)
+  facultyGroup.Delete("/:id", middleware.Require("faculty:manage"), handlers.DeactivateFacultyMember)
+
+  app.Get("/search", handlers.Search)
+
+  importGroup := app.Group("/import")
+  importGroup.Post("/students", middleware.Require("students:write"), handlers.ImportStudents)
+  importGroup.Post("/courses", middleware.Require("courses:write"), handlers.ImportCourses)
+  importGroup.Post("/enrollments", middleware.Require("enrollments:write"), handlers.ImportEnrollments)
+
   studentGroup := app.Group("/students")
-  studentGroup.Post("/", middleware.FacultyOnly, handlers.CreateStudent)
-  studentGroup.Put("/:id", middleware.FacultyOnly, handlers.UpdateStudent)
-  studentGroup.Delete("/:id", middleware.FacultyOnly, handlers.DeleteStudent)
+  studentGroup.Post("/", middleware.Require("students:write"), handlers.CreateStudent)
+  studentGroup.Put("/:id", middleware.Require("students:write"), handlers.UpdateStudent)
+  studentGroup.Delete("/:id", middleware.Require("students:delete"), handlers.DeleteStudent)
 
   studentGroup.Get("/", handlers.GetStudents)
   studentGroup.Get("/:id", handlers.GetStudent)
   studentGroup.Get("/:id/transcript", handlers.GetStudentTranscript)
+  studentGroup.Get("/:id/transcript.pdf", handlers.GetStudentTranscriptPDF)
   studentGroup.Get("/:id/gpa", handlers.CalculateGPA)
+  studentGroup.Get("/:id/waitlist", handlers.GetStudentWaitlist)
+
+  gradingScaleGroup := app.Group("/grading-scales")
+  gradingScaleGroup.Get("/", handlers.GetGradingScales)
+  gradingScaleGroup.Get("/:id", handlers.GetGradingScale)
+  gradingScaleGroup.Post("/", middleware.Require("grading_scales:manage"), handlers.CreateGradingScale)
+  gradingScaleGroup.Put("/:id", middleware.Require("grading_scales:manage"), handlers.UpdateGradingScale)
+  gradingScaleGroup.Delete("/:id", middleware.Require("grading_scales:manage"), handlers.DeleteGradingScale)
+
+  termGroup := app.Group("/terms")
+  termGroup.Get("/", handlers.GetTerms)
+  termGroup.Get("/:id", handlers.GetTerm)
+  termGroup.Post("/", middleware.Require("terms:manage"), handlers.CreateTerm)
+  termGroup.Put("/:id", middleware.Require("terms:manage"), handlers.UpdateTerm)
+  termGroup.Delete("/:id", middleware.Require("terms:manage"), handlers.DeleteTerm)
 
   courseGroup := app.Group("/courses")
   courseGroup.Get("/", handlers.GetCourses)
   courseGroup.Get("/:id", handlers.GetCourse)
-  courseGroup.Post("/", middleware.FacultyOnly, handlers.CreateCourse)
-  courseGroup.Put("/:id", middleware.FacultyOnly, handlers.UpdateCourse)
-  courseGroup.Delete("/:id", middleware.FacultyOnly, handlers.DeleteCourse)
+  courseGroup.Post("/", middleware.Require("courses:write"), handlers.CreateCourse)
+  courseGroup.Put("/:id", middleware.Require("courses:write"), handlers.UpdateCourse)
+  courseGroup.Delete("/:id", middleware.Require("courses:delete"), handlers.DeleteCourse)
+  courseGroup.Get("/:id/instructors", handlers.GetCourseInstructors)
+  courseGroup.Post("/:id/instructors", middleware.Require("courses:write"), handlers.AssignCourseInstructor)
+  courseGroup.Delete("/:id/instructors/:facultyId", middleware.Require("courses:write"), handlers.UnassignCourseInstructor)
+  courseGroup.Get("/:id/prerequisites", handlers.GetCoursePrerequisites)
+  courseGroup.Put("/:id/prerequisites", middleware.Require("courses:write"), handlers.SetCoursePrerequisites)
+
+  app.Get("/prerequisite-overrides", middleware.Require("enrollments:read"), handlers.GetPrerequisiteOverrides)
+
+  sectionGroup := app.Group("/sections")
+  sectionGroup.Get("/", handlers.GetSections)
+  sectionGroup.Get("/:id", handlers.GetSection)
+  sectionGroup.Post("/", middleware.Require("courses:write"), handlers.CreateSection)
+  sectionGroup.Put("/:id", middleware.Require("courses:write"), handlers.UpdateSection)
+  sectionGroup.Delete("/:id", middleware.Require("courses:delete"), handlers.DeleteSection)
+  sectionGroup.Get("/:id/waitlist", middleware.Require("enrollments:read"), handlers.GetSectionWaitlist)
+
+  app.Delete("/waitlist/:id", middleware.Require("enrollments:delete"), handlers.DeleteWaitlistEntry)
 
   enrollmentGroup := app.Group("/enrollments")
-  enrollmentGroup.Post("/", middleware.FacultyOnly, handlers.EnrollStudent)
-  enrollmentGroup.Delete("/:id", middleware.FacultyOnly, handlers.DeleteEnrollment)
+  enrollmentGroup.Post("/", middleware.Require("enrollments:write"), handlers.EnrollStudent)
+  enrollmentGroup.Delete("/:id", middleware.Require("enrollments:delete"), handlers.DeleteEnrollment)
   enrollmentGroup.Get("/", handlers.GetEnrollments)
   enrollmentGroup.Get("/:id", handlers.GetEnrollment)
 
   gradeGroup := app.Group("/grades")
-  gradeGroup.Post("/", middleware.FacultyOnly, handlers.AddGrade)
-  gradeGroup.Put("/:id", middleware.FacultyOnly, handlers.UpdateGrade)
-  gradeGroup.Delete("/:id", middleware.FacultyOnly, handlers.DeleteGrade)
+  gradeGroup.Post("/", middleware.Require("grades:write"), handlers.AddGrade)
+  gradeGroup.Put("/:id", middleware.Require("grades:write"), handlers.UpdateGrade)
+  gradeGroup.Delete("/:id", middleware.Require("grades:delete"), handlers.DeleteGrade)
   gradeGroup.Get("/", handlers.GetGrades)
   gradeGroup.Get("/:id", handlers.GetGrade)
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+  "context"
+  "io"
+  "log"
+  "os"
+  "os/signal"
+  "syscall"
+  "time"
+
+  "backend/config"
+  "backend/database"
+  "backend/handlers"
+
+  "github.com/gofiber/fiber/v3"
+)
+
+/// Serves until SIGINT or SIGTERM, then fails readiness for SHUTDOWN_DELAY, stops accepting connections and lets
+/// in-flight requests finish within SHUTDOWN_TIMEOUT before closing the database pool and flushing the request log.
+/// The metrics app, if any, is served next to it and shut down after it. stopHandlers ends the background work of
+/// the handlers before the pool closes. Returns the exit status.
+func serve(app *fiber.App, metricsApp *fiber.App, logWriter io.Closer, stopHandlers context.CancelFunc) int {
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+  defer stop()
+
+  listenErr := make(chan error, 2)
+  go func() {
+    listenErr <- app.Listen(config.Current.ListenAddress, fiber.ListenConfig{
+      EnablePrintRoutes: true,
+    })
+  }()
+  if metricsApp != nil {
+    go func() {
+      listenErr <- metricsApp.Listen(config.Current.MetricsListenAddress, fiber.ListenConfig{
+        DisableStartupMessage: true,
+      })
+    }()
+    log.Println("Serving metrics on", config.Current.MetricsListenAddress)
+  }
+
+  status := 0
+  drained := true
+  select {
+  case err := <-listenErr:
+    log.Println("Server stopped:", err)
+    status = 1
+
+  case <-ctx.Done():
+    // A second signal kills the process right away
+    stop()
+
+    handlers.BeginShutdown()
+    if config.Current.ShutdownDelay > 0 {
+      log.Printf("Shutting down, failing readiness for %s before closing the listener\n", config.Current.ShutdownDelay)
+      time.Sleep(config.Current.ShutdownDelay)
+    }
+    log.Printf("Shutting down, waiting up to %s for in-flight requests\n", config.Current.ShutdownTimeout)
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Current.ShutdownTimeout)
+    defer cancel()
+    if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+      log.Println("In-flight requests did not finish in time:", err)
+      status = 1
+      drained = false
+    }
+
+    // Scraped last so the final request counts are not lost
+    if metricsApp != nil {
+      if err := metricsApp.ShutdownWithContext(shutdownCtx); err != nil {
+        log.Println("Unable to stop the metrics listener:", err)
+      }
+    }
+  }
+
+  stopHandlers()
+
+  // Requests that outlived the deadline still hold connections, Close would wait for them.
+  // Exiting drops those connections and Postgres rolls their transactions back.
+  if drained {
+    database.DB.Close()
+    log.Println("Database pool closed")
+  }
+
+  if logWriter != nil {
+    if err := logWriter.Close(); err != nil {
+      log.Println("Unable to flush request log:", err)
+    }
+  }
+
+  return status
+}
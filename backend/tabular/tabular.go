@@ -0,0 +1,150 @@
+package tabular
+
+import (
+  "bytes"
+  "encoding/csv"
+  "errors"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+  CSV    Format = "csv"
+  XLSX   Format = "xlsx"
+  NDJSON Format = "ndjson"
+)
+
+const (
+  CSVContentType    = "text/csv"
+  XLSXContentType   = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+  NDJSONContentType = "application/x-ndjson"
+)
+
+var ErrUnsupportedFormat = errors.New("Unsupported file format, expected CSV or XLSX")
+
+/// Detect the format from a file name or content type, empty if neither is known
+func DetectFormat(name string, contentType string) Format {
+  switch strings.ToLower(filepath.Ext(name)) {
+  case ".csv":
+    return CSV
+  case ".xlsx":
+    return XLSX
+  }
+
+  mediaType, _, _ := strings.Cut(contentType, ";")
+  switch strings.TrimSpace(strings.ToLower(mediaType)) {
+  case CSVContentType, "application/csv":
+    return CSV
+  case XLSXContentType:
+    return XLSX
+  }
+  return ""
+}
+
+// Rows of a spreadsheet, columns are named by the lower cased header in the first row
+type Table struct {
+  Header []string
+  Rows   [][]string
+}
+
+/// Read a CSV file or the first sheet of an XLSX workbook
+func Read(data []byte, format Format) (*Table, error) {
+  var records [][]string
+  var err error
+
+  switch format {
+  case CSV:
+    reader := csv.NewReader(bytes.NewReader(data))
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+    records, err = reader.ReadAll()
+  case XLSX:
+    records, err = readXLSX(data)
+  default:
+    return nil, ErrUnsupportedFormat
+  }
+  if err != nil {
+    return nil, err
+  }
+  if len(records) == 0 {
+    return nil, errors.New("File is empty")
+  }
+
+  table := &Table{Rows: records[1:]}
+  for _, name := range records[0] {
+    // Excel likes to prefix CSV exports with a byte order mark
+    name = strings.TrimPrefix(name, "\ufeff")
+    table.Header = append(table.Header, strings.ToLower(strings.TrimSpace(name)))
+  }
+  return table, nil
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+  // Raw values keep dates as serial numbers instead of applying the cell's display format
+  file, err := excelize.OpenReader(bytes.NewReader(data), excelize.Options{RawCellValue: true})
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  sheets := file.GetSheetList()
+  if len(sheets) == 0 {
+    return nil, errors.New("Workbook has no sheets")
+  }
+  return file.GetRows(sheets[0])
+}
+
+/// Value of the named column in a row, empty if the column or cell is missing
+func (t *Table) Get(row []string, column string) string {
+  for i, name := range t.Header {
+    if name == column {
+      if i < len(row) {
+        return strings.TrimSpace(row[i])
+      }
+      return ""
+    }
+  }
+  return ""
+}
+
+/// Columns of the given list the table does not have
+func (t *Table) Missing(columns ...string) []string {
+  missing := []string{}
+  for _, column := range columns {
+    found := false
+    for _, name := range t.Header {
+      found = found || name == column
+    }
+    if !found {
+      missing = append(missing, column)
+    }
+  }
+  return missing
+}
+
+/// Reports weather all cells of a row are blank
+func IsBlank(row []string) bool {
+  for _, cell := range row {
+    if strings.TrimSpace(cell) != "" {
+      return false
+    }
+  }
+  return true
+}
+
+/// Parse a YYYY-MM-DD date, or a spreadsheet date serial number as found in XLSX files
+func ParseDate(value string) (time.Time, error) {
+  if t, err := time.Parse(time.DateOnly, value); err == nil {
+    return t, nil
+  }
+  if serial, err := strconv.ParseFloat(value, 64); err == nil {
+    return excelize.ExcelDateToTime(serial, false)
+  }
+  return time.Time{}, errors.New("invalid date " + strconv.Quote(value) + ", expected YYYY-MM-DD")
+}
@@ -0,0 +1,200 @@
+package tabular
+
+import (
+  "encoding/csv"
+  "io"
+  "reflect"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/goccy/go-json"
+  "github.com/xuri/excelize/v2"
+)
+
+// Writes exported rows one at a time. Rows are the cell values of the columns the writer was created with,
+// NDJSON writers are given a single value per row that is encoded as a JSON object.
+type Writer interface {
+  Write(values ...any) error
+  Close() error
+}
+
+/// Create a writer for the format, CSV and XLSX start with a header row of the column names
+func NewWriter(w io.Writer, format Format, columns []string) (Writer, error) {
+  switch format {
+  case CSV:
+    writer := &csvWriter{w: csv.NewWriter(w)}
+    return writer, writer.w.Write(columns)
+  case XLSX:
+    return newXLSXWriter(w, columns)
+  case NDJSON:
+    return &ndjsonWriter{e: json.NewEncoder(w)}, nil
+  default:
+    return nil, ErrUnsupportedFormat
+  }
+}
+
+/// MIME type of a format
+func ContentType(format Format) string {
+  switch format {
+  case CSV:
+    return CSVContentType + "; charset=utf-8"
+  case XLSX:
+    return XLSXContentType
+  case NDJSON:
+    return NDJSONContentType
+  default:
+    return ""
+  }
+}
+
+/// Dereference pointers, nil pointers become nil
+func plain(value any) any {
+  v := reflect.ValueOf(value)
+  for v.Kind() == reflect.Pointer {
+    if v.IsNil() {
+      return nil
+    }
+    v = v.Elem()
+  }
+  if !v.IsValid() {
+    return nil
+  }
+  return v.Interface()
+}
+
+/// Reports weather a spreadsheet application would read the text as a formula, such cells must not be written verbatim
+/// as exports contain values entered by users
+func isFormula(text string) bool {
+  return text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0]))
+}
+
+type csvWriter struct {
+  w *csv.Writer
+}
+
+func (c *csvWriter) Write(values ...any) error {
+  record := make([]string, len(values))
+  for i, value := range values {
+    switch value := plain(value).(type) {
+    case nil:
+      record[i] = ""
+    case string:
+      // A leading apostrophe makes spreadsheet applications show the cell as text
+      if isFormula(value) {
+        value = "'" + value
+      }
+      record[i] = value
+    case time.Time:
+      record[i] = value.Format(time.DateOnly)
+    case float32:
+      record[i] = strconv.FormatFloat(float64(value), 'f', -1, 32)
+    case float64:
+      record[i] = strconv.FormatFloat(value, 'f', -1, 64)
+    default:
+      data, err := json.Marshal(value)
+      if err != nil {
+        return err
+      }
+      record[i] = string(data)
+    }
+  }
+  return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+  c.w.Flush()
+  return c.w.Error()
+}
+
+type ndjsonWriter struct {
+  e *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(values ...any) error {
+  for _, value := range values {
+    if err := n.e.Encode(value); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+  return nil
+}
+
+// The workbook is written by excelize's stream writer, which keeps rows in a temporary file
+// rather than memory until the workbook is written out on Close
+type xlsxWriter struct {
+  w         io.Writer
+  file      *excelize.File
+  stream    *excelize.StreamWriter
+  row       int
+  dateStyle int
+  textStyle int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (*xlsxWriter, error) {
+  file := excelize.NewFile()
+  sheet := file.GetSheetName(0)
+  stream, err := file.NewStreamWriter(sheet)
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+  dateStyle, err := file.NewStyle(&excelize.Style{NumFmt: 14})
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+
+  textStyle, err := file.NewStyle(&excelize.Style{NumFmt: 49})
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+
+  writer := &xlsxWriter{w: w, file: file, stream: stream, dateStyle: dateStyle, textStyle: textStyle}
+  header := make([]any, len(columns))
+  for i, column := range columns {
+    header[i] = column
+  }
+  return writer, writer.Write(header...)
+}
+
+func (x *xlsxWriter) Write(values ...any) error {
+  x.row++
+  cells := make([]any, len(values))
+  for i, value := range values {
+    switch v := plain(value).(type) {
+    case time.Time:
+      value = excelize.Cell{StyleID: x.dateStyle, Value: v}
+    case string:
+      // Strings are written as inline string cells, which are never evaluated, and the text format
+      // keeps a formula from being evaluated once the cell is edited
+      if isFormula(v) {
+        value = excelize.Cell{StyleID: x.textStyle, Value: v}
+      } else {
+        value = v
+      }
+    default:
+      value = v
+    }
+    cells[i] = value
+  }
+
+  cell, err := excelize.CoordinatesToCellName(1, x.row)
+  if err != nil {
+    return err
+  }
+  return x.stream.SetRow(cell, cells)
+}
+
+func (x *xlsxWriter) Close() error {
+  defer x.file.Close()
+  if err := x.stream.Flush(); err != nil {
+    return err
+  }
+  return x.file.Write(x.w)
+}
@@ -0,0 +1,107 @@
+package tabular
+
+import (
+  "bytes"
+  "encoding/csv"
+  "reflect"
+  "testing"
+
+  "github.com/xuri/excelize/v2"
+)
+
+// Cells an attacker could store in a name or address to run a formula in the spreadsheet of whoever opens an export
+var formulaCells = []string{"=1+1", "+1", "-2+3", "@SUM(A1)", "\t=1", "\r=1"}
+
+func TestCSVWriterQuotesFormulas(t *testing.T) {
+  buf := &bytes.Buffer{}
+  writer, err := NewWriter(buf, CSV, []string{"value"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, cell := range formulaCells {
+    if err := writer.Write(cell); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if err := writer.Write("plain text"); err != nil {
+    t.Fatal(err)
+  }
+  if err := writer.Write(-1.5); err != nil {
+    t.Fatal(err)
+  }
+  if err := writer.Close(); err != nil {
+    t.Fatal(err)
+  }
+
+  records, err := csv.NewReader(buf).ReadAll()
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := [][]string{{"value"}}
+  for _, cell := range formulaCells {
+    want = append(want, []string{"'" + cell})
+  }
+  want = append(want, []string{"plain text"}, []string{"-1.5"})
+  if !reflect.DeepEqual(records, want) {
+    t.Errorf("records = %q, want %q", records, want)
+  }
+}
+
+func TestXLSXWriterWritesFormulasAsText(t *testing.T) {
+  buf := &bytes.Buffer{}
+  writer, err := NewWriter(buf, XLSX, []string{"value"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, cell := range formulaCells {
+    if err := writer.Write(cell); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if err := writer.Write(-1.5); err != nil {
+    t.Fatal(err)
+  }
+  if err := writer.Close(); err != nil {
+    t.Fatal(err)
+  }
+
+  file, err := excelize.OpenReader(buf)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer file.Close()
+  sheet := file.GetSheetName(0)
+
+  for i, want := range formulaCells {
+    cell, _ := excelize.CoordinatesToCellName(1, i+2)
+    if got, err := file.GetCellValue(sheet, cell); err != nil || got != want {
+      t.Errorf("%s = %q, %v, want %q", cell, got, err, want)
+    }
+    if formula, err := file.GetCellFormula(sheet, cell); err != nil || formula != "" {
+      t.Errorf("%s has formula %q, %v", cell, formula, err)
+    }
+    if cellType, err := file.GetCellType(sheet, cell); err != nil || cellType != excelize.CellTypeInlineString {
+      t.Errorf("%s has type %v, %v, want an inline string", cell, cellType, err)
+    }
+    styleID, err := file.GetCellStyle(sheet, cell)
+    if err != nil {
+      t.Fatal(err)
+    }
+    style, err := file.GetStyle(styleID)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if style.NumFmt != 49 {
+      t.Errorf("%s has number format %d, want 49 (text)", cell, style.NumFmt)
+    }
+  }
+
+  cell, _ := excelize.CoordinatesToCellName(1, len(formulaCells)+2)
+  // Numbers are written without a type, which spreadsheet applications read as a number
+  if cellType, err := file.GetCellType(sheet, cell); err != nil || cellType != excelize.CellTypeUnset {
+    t.Errorf("%s has type %v, %v, want a number", cell, cellType, err)
+  }
+  if got, err := file.GetCellValue(sheet, cell); err != nil || got != "-1.5" {
+    t.Errorf("%s = %q, %v, want -1.5", cell, got, err)
+  }
+}
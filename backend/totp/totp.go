@@ -0,0 +1,99 @@
+package totp
+
+import (
+  "crypto/hmac"
+  "crypto/rand"
+  "crypto/sha1"
+  "crypto/subtle"
+  "encoding/base32"
+  "encoding/binary"
+  "fmt"
+  "net/url"
+  "strings"
+  "time"
+)
+
+// Parameters of RFC 6238 as understood by common authenticator apps
+const (
+  Period = 30 * time.Second
+  Digits = 6
+
+  // Codes of this many periods before and after the current one are accepted to allow for clock drift
+  Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+/// Generate a random base32 encoded 160 bit secret
+func GenerateSecret() (string, error) {
+  buf := make([]byte, 20)
+  if _, err := rand.Read(buf); err != nil {
+    return "", err
+  }
+  return encoding.EncodeToString(buf), nil
+}
+
+/// Time step a moment falls into
+func Step(t time.Time) int64 {
+  return t.Unix() / int64(Period/time.Second)
+}
+
+/// HOTP code (RFC 4226) of secret for the given time step
+func Code(secret string, step int64) (string, error) {
+  key, err := encoding.DecodeString(strings.ToUpper(secret))
+  if err != nil {
+    return "", err
+  }
+
+  var counter [8]byte
+  binary.BigEndian.PutUint64(counter[:], uint64(step))
+  mac := hmac.New(sha1.New, key)
+  mac.Write(counter[:])
+  sum := mac.Sum(nil)
+
+  offset := sum[len(sum)-1] & 0x0f
+  value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+  mod := uint32(1)
+  for range Digits {
+    mod *= 10
+  }
+  return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+/// Check code against the steps around t.
+/// Steps up to lastUsedStep are rejected so that a code can not be replayed.
+/// Returns the matched step, which should be stored as the new lastUsedStep.
+func Validate(secret string, code string, t time.Time, lastUsedStep int64) (int64, bool) {
+  if len(code) != Digits {
+    return 0, false
+  }
+
+  current := Step(t)
+  for step := current - Skew; step <= current+Skew; step++ {
+    if step <= lastUsedStep {
+      continue
+    }
+    expected, err := Code(secret, step)
+    if err != nil {
+      return 0, false
+    }
+    if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+      return step, true
+    }
+  }
+  return 0, false
+}
+
+/// otpauth:// provisioning URI, usually rendered as a QR code for authenticator apps
+func URI(secret string, issuer string, account string) string {
+  values := url.Values{}
+  values.Set("secret", secret)
+  values.Set("issuer", issuer)
+  values.Set("algorithm", "SHA1")
+  values.Set("digits", fmt.Sprint(Digits))
+  values.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+  label := url.PathEscape(issuer + ":" + account)
+  return "otpauth://totp/" + label + "?" + values.Encode()
+}
@@ -0,0 +1,125 @@
+package totp
+
+import (
+  "encoding/base32"
+  "strings"
+  "testing"
+  "time"
+)
+
+// Secret of the SHA-1 test vectors in RFC 6238 appendix B, the ASCII string "12345678901234567890"
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+  // The RFC lists 8 digit codes, 6 digit codes are their last six digits
+  tests := []struct {
+    unix int64
+    code string
+  }{
+    {59, "287082"},
+    {1111111109, "081804"},
+    {1111111111, "050471"},
+    {1234567890, "005924"},
+    {2000000000, "279037"},
+    {20000000000, "353130"},
+  }
+  for _, test := range tests {
+    code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if code != test.code {
+      t.Errorf("Code at %d = %s, want %s", test.unix, code, test.code)
+    }
+  }
+}
+
+func TestCodeAcceptsLowerCaseSecret(t *testing.T) {
+  code, err := Code(strings.ToLower(rfcSecret), Step(time.Unix(59, 0)))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if code != "287082" {
+    t.Errorf("Code = %s, want 287082", code)
+  }
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+  if _, err := Code("not base32!", 1); err == nil {
+    t.Error("expected an error for an invalid secret")
+  }
+}
+
+func TestValidateSkew(t *testing.T) {
+  now := time.Unix(1234567890, 0)
+  current := Step(now)
+
+  tests := []struct {
+    name  string
+    step  int64
+    valid bool
+  }{
+    {"current period", current, true},
+    {"previous period", current - 1, true},
+    {"next period", current + 1, true},
+    {"two periods ago", current - 2, false},
+    {"two periods ahead", current + 2, false},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      code, err := Code(rfcSecret, test.step)
+      if err != nil {
+        t.Fatal(err)
+      }
+      step, ok := Validate(rfcSecret, code, now, 0)
+      if ok != test.valid {
+        t.Fatalf("Validate = %v, want %v", ok, test.valid)
+      }
+      if ok && step != test.step {
+        t.Errorf("matched step %d, want %d", step, test.step)
+      }
+    })
+  }
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+  now := time.Unix(1234567890, 0)
+  current := Step(now)
+  code, err := Code(rfcSecret, current)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  step, ok := Validate(rfcSecret, code, now, 0)
+  if !ok {
+    t.Fatal("expected the code to be accepted once")
+  }
+  if _, ok := Validate(rfcSecret, code, now, step); ok {
+    t.Error("expected the same code to be rejected once its step is used")
+  }
+  // Still inside the skew window, but older than the step already used
+  previous, err := Code(rfcSecret, current-1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := Validate(rfcSecret, previous, now, step); ok {
+    t.Error("expected a code of an earlier step to be rejected after a later one was used")
+  }
+  // The next period's code is still accepted
+  next, err := Code(rfcSecret, current+1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if _, ok := Validate(rfcSecret, next, now, step); !ok {
+    t.Error("expected the code of a later step to be accepted")
+  }
+}
+
+func TestValidateRejectsMalformedCodes(t *testing.T) {
+  now := time.Unix(59, 0)
+  for _, code := range []string{"", "28708", "2870820", "94287082"} {
+    if _, ok := Validate(rfcSecret, code, now, 0); ok {
+      t.Errorf("expected %q to be rejected", code)
+    }
+  }
+}
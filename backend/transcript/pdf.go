@@ -0,0 +1,159 @@
+package transcript
+
+import (
+  "bytes"
+  "fmt"
+
+  "backend/models"
+
+  "github.com/go-pdf/fpdf"
+)
+
+// Everything printed on a transcript besides the records themselves
+type Options struct {
+  Institution string
+  VerifyURL   string
+  KeyID       string
+  Signature   string
+}
+
+// Column widths in mm, together they span the 180mm page body
+var columns = []struct {
+  title string
+  width float64
+  align string
+}{
+  {"Code", 25, "L"},
+  {"Course", 105, "L"},
+  {"Credits", 20, "R"},
+  {"Grade", 30, "R"},
+}
+
+/// Render a transcript as an A4 PDF
+func Render(doc models.TranscriptDocument, opts Options) ([]byte, error) {
+  pdf := fpdf.New("P", "mm", "A4", "")
+  pdf.SetMargins(15, 15, 15)
+  pdf.SetAutoPageBreak(true, 40)
+  pdf.AliasNbPages("")
+
+  // The core fonts are cp1252, names and titles may contain characters outside of ASCII
+  tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+  pdf.SetHeaderFunc(func() {
+    pdf.SetFont("Helvetica", "B", 16)
+    pdf.CellFormat(0, 8, tr(opts.Institution), "", 1, "C", false, 0, "")
+    pdf.SetFont("Helvetica", "", 11)
+    pdf.CellFormat(0, 6, "Official Academic Transcript", "", 1, "C", false, 0, "")
+    pdf.Ln(2)
+    pdf.Line(15, pdf.GetY(), 195, pdf.GetY())
+    pdf.Ln(4)
+  })
+
+  pdf.SetFooterFunc(func() {
+    pdf.SetY(-35)
+    pdf.Line(15, pdf.GetY(), 195, pdf.GetY())
+    pdf.Ln(2)
+    pdf.SetFont("Helvetica", "", 8)
+    pdf.CellFormat(0, 4, "Document ID: "+doc.DocumentID, "", 1, "L", false, 0, "")
+    pdf.CellFormat(0, 4, "Verify at: "+opts.VerifyURL, "", 1, "L", false, 0, opts.VerifyURL)
+    pdf.CellFormat(0, 4, "Ed25519 key: "+opts.KeyID, "", 1, "L", false, 0, "")
+    pdf.SetFont("Courier", "", 7)
+    pdf.MultiCell(0, 3, "Signature: "+opts.Signature, "", "L", false)
+    pdf.SetFont("Helvetica", "I", 8)
+    pdf.CellFormat(0, 4, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+  })
+
+  pdf.AddPage()
+
+  pdf.SetFont("Helvetica", "", 10)
+  field := func(label, value string) {
+    pdf.SetFont("Helvetica", "B", 10)
+    pdf.CellFormat(35, 6, label, "", 0, "L", false, 0, "")
+    pdf.SetFont("Helvetica", "", 10)
+    pdf.CellFormat(0, 6, tr(value), "", 1, "L", false, 0, "")
+  }
+  field("Student", doc.StudentName)
+  field("Student ID", fmt.Sprint(doc.StudentID))
+  field("Issued", doc.IssuedAt.UTC().Format("2006-01-02 15:04 UTC"))
+  field("Retakes", "GPA counts the "+doc.RetakePolicy+" attempt")
+  pdf.Ln(4)
+
+  for _, semester := range doc.Semesters {
+    courseTable(pdf, tr, semester.TermName, semester.Courses)
+    sgpa := "-"
+    if semester.GPA != nil {
+      sgpa = withMark(*semester.GPA, semester.GPAMark)
+    }
+    pdf.SetFont("Helvetica", "B", 10)
+    pdf.CellFormat(130, 6, "Semester GPA", "T", 0, "R", false, 0, "")
+    pdf.CellFormat(20, 6, fmt.Sprintf("%.2f", semester.Credits), "T", 0, "R", false, 0, "")
+    pdf.CellFormat(30, 6, sgpa, "T", 1, "R", false, 0, "")
+    pdf.SetFont("Helvetica", "", 10)
+    pdf.CellFormat(130, 6, "Credits earned / Cumulative GPA", "", 0, "R", false, 0, "")
+    pdf.CellFormat(20, 6, fmt.Sprintf("%.2f", semester.CreditsEarned), "", 0, "R", false, 0, "")
+    pdf.CellFormat(30, 6, withMark(semester.CGPA, semester.CGPAMark), "", 1, "R", false, 0, "")
+    pdf.Ln(4)
+  }
+
+  if len(doc.InProgress) > 0 {
+    courseTable(pdf, tr, "In Progress", doc.InProgress)
+    pdf.Ln(4)
+  }
+
+  pdf.SetFont("Helvetica", "B", 11)
+  pdf.CellFormat(130, 7, "Credits earned / Cumulative GPA", "TB", 0, "R", false, 0, "")
+  pdf.CellFormat(20, 7, fmt.Sprintf("%.2f", doc.CreditsEarned), "TB", 0, "R", false, 0, "")
+  pdf.CellFormat(30, 7, withMark(doc.CGPA, doc.CGPAMark), "TB", 1, "R", false, 0, "")
+
+  var buf bytes.Buffer
+  if err := pdf.Output(&buf); err != nil {
+    return nil, err
+  }
+  return buf.Bytes(), nil
+}
+
+func courseTable(pdf *fpdf.Fpdf, tr func(string) string, title string, courses []models.TranscriptCourse) {
+  pdf.SetFont("Helvetica", "B", 12)
+  pdf.CellFormat(0, 7, tr(title), "", 1, "L", false, 0, "")
+
+  pdf.SetFont("Helvetica", "B", 10)
+  pdf.SetFillColor(230, 230, 230)
+  for _, column := range columns {
+    pdf.CellFormat(column.width, 6, column.title, "B", 0, column.align, true, 0, "")
+  }
+  pdf.Ln(-1)
+
+  pdf.SetFont("Helvetica", "", 10)
+  for _, course := range courses {
+    grade := "-"
+    if course.Grade != nil {
+      grade = withMark(*course.Grade, course.Mark)
+    } else if course.Mark != nil {
+      grade = *course.Mark
+    }
+    values := []string{course.CourseCode, course.CourseTitle, fmt.Sprintf("%.2f", course.Credits), grade}
+    for i, column := range columns {
+      pdf.CellFormat(column.width, 6, truncate(pdf, tr(values[i]), column.width-2), "", 0, column.align, false, 0, "")
+    }
+    pdf.Ln(-1)
+  }
+}
+
+/// Shorten text with an ellipsis so it fits in width
+func truncate(pdf *fpdf.Fpdf, text string, width float64) string {
+  if pdf.GetStringWidth(text) <= width {
+    return text
+  }
+  for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+    text = text[:len(text)-1]
+  }
+  return text + "..."
+}
+
+/// Points with the mark in front when there is one, e.g. "A- 3.70"
+func withMark(points float64, mark *string) string {
+  if mark == nil {
+    return fmt.Sprintf("%.2f", points)
+  }
+  return fmt.Sprintf("%s %.2f", *mark, points)
+}
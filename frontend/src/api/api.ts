@@ -1,5 +1,5 @@
 import axios from 'axios';
-import { Student, Course, Enrollment, Grade, StudentTranscript, LoginRequest, AuthResponse } from '../types/types';
+import { Student, Course, Term, CourseSection, CoursePrerequisite, Enrollment, WaitlistEntry, Grade, StudentTranscript, GPAReport, GradingScale, LoginRequest, AuthResponse, Page } from '../types/types';
 
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:3000';
 
@@ -20,34 +20,59 @@ export const setAuthToken = (token: string | null) => {
 
 export const login = (credentials: LoginRequest) => api.post<AuthResponse>('/login', credentials);
 
-export const getStudents = () => api.get<Student[]>('/students');
+// Follows next_cursor until all pages of a list endpoint are fetched
+const getAllPages = async <T>(url: string, params: Record<string, unknown> = {}) => {
+	const items: T[] = [];
+	let after: string | undefined;
+	do {
+		const response = await api.get<Page<T>>(url, { params: { ...params, limit: 200, after } });
+		items.push(...response.data.items);
+		after = response.data.next_cursor;
+	} while (after);
+	return { data: items };
+};
+
+export const getStudents = () => getAllPages<Student>('/students');
 export const getStudent = (id: number) => api.get<Student>(`/students/${id}`);
 export const createStudent = (student: Student) => api.post<Student>('/students', student);
 export const updateStudent = (id: number, student: Student) => api.put<void>(`/students/${id}`, student);
 export const deleteStudent = (id: number) => api.delete<void>(`/students/${id}`);
 export const getStudentTranscript = (id: number) => api.get<StudentTranscript>(`/students/${id}/transcript`);
-export const calculateStudentGPA = (id: number) => api.get<{ student_id: number; gpa: number; message?: string }>(`/students/${id}/gpa`);
+export const calculateStudentGPA = (id: number) => api.get<GPAReport>(`/students/${id}/gpa`);
 
-export const getCourses = () => api.get<Course[]>('/courses');
+export const getCourses = () => getAllPages<Course>('/courses');
 export const getCourse = (id: number) => api.get<Course>(`/courses/${id}`);
 export const createCourse = (course: Course) => api.post<Course>('/courses', course);
 export const updateCourse = (id: number, course: Course) => api.put<void>(`/courses/${id}`, course);
 export const deleteCourse = (id: number) => api.delete<void>(`/courses/${id}`);
 
 
+export const getTerms = () => api.get<Term[]>('/terms');
+
+export const getCoursePrerequisites = (courseId: number) => api.get<CoursePrerequisite[]>(`/courses/${courseId}/prerequisites`);
+export const setCoursePrerequisites = (courseId: number, prerequisites: CoursePrerequisite[]) =>
+	api.put<void>(`/courses/${courseId}/prerequisites`, prerequisites);
+
+export const getSections = (courseId: number, termId: number) =>
+	api.get<CourseSection[]>('/sections', { params: { course_id: courseId, term_id: termId } });
+export const getStudentWaitlist = (studentId: number) => api.get<WaitlistEntry[]>(`/students/${studentId}/waitlist`);
+
 export const getEnrollments = (studentId?: number) => {
 	const params = studentId !== undefined ? { student_id: studentId } : {};
-	return api.get<Enrollment[]>('/enrollments', { params });
+	return getAllPages<Enrollment>('/enrollments', params);
 };
 export const getEnrollment = (id: number) => api.get<Enrollment>(`/enrollments/${id}`);
-export const createEnrollment = (enrollment: Enrollment) => api.post<Enrollment>('/enrollments', enrollment);
+// Answered with 202 and a WaitlistEntry when the section is full
+export const createEnrollment = (enrollment: Enrollment) => api.post<Enrollment | WaitlistEntry>('/enrollments', enrollment);
 export const deleteEnrollment = (id: number) => api.delete<void>(`/enrollments/${id}`);
 
-export const getGrades = () => api.get<Grade[]>('/grades');
+export const getGrades = () => getAllPages<Grade>('/grades');
 export const getGrade = (id: number) => api.get<Grade>(`/grades/${id}`);
 export const addGrade = (grade: Grade) => api.post<Grade>('/grades', grade);
 export const updateGrade = (id: number, grade: Grade) => api.put<void>(`/grades/${id}`, grade);
 export const deleteGrade = (id: number) => api.delete<void>(`/grades/${id}`);
 
+export const getGradingScales = () => api.get<GradingScale[]>('/grading-scales');
+
 export default api;
 
@@ -1,6 +1,6 @@
 import { useEffect, useState } from 'react';
-import { Enrollment, Student, Course } from '../../types/types';
-import { createEnrollment, getStudents, getCourses } from '../../api/api';
+import { Enrollment, Student, Course, Term, CourseSection, CoursePrerequisite } from '../../types/types';
+import { createEnrollment, getStudents, getCourses, getTerms, getSections } from '../../api/api';
 
 interface EnrollmentFormProps {
   onSuccess: () => void;
@@ -10,32 +10,50 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
   const [enrollment, setEnrollment] = useState<Enrollment>({
     student_id: 0,
     course_id: 0,
+    term_id: 0,
   });
   const [students, setStudents] = useState<Student[]>([]); // Needed to populate dropdown
   const [courses, setCourses] = useState<Course[]>([]); // Needed to populate dropdown
+  const [terms, setTerms] = useState<Term[]>([]); // Needed to populate dropdown
+  const [sections, setSections] = useState<CourseSection[]>([]); // Sections of the selected course and term
   const [loading, setLoading] = useState(false); // For form submission
   const [error, setError] = useState<string | null>(null);
+  const [loadError, setLoadError] = useState<string | null>(null); // Replaces the form, submission errors are shown inside it
+  const [unmet, setUnmet] = useState<CoursePrerequisite[]>([]); // Requirements missing on the last attempt
   const [dataLoading, setDataLoading] = useState(true); // For initial data fetch
 
   useEffect(() => {
     fetchStudentsAndCourses();
   }, []);
 
+  // A course with sections in the term can only be enrolled into through one of them
+  useEffect(() => {
+    setSections([]);
+    if (enrollment.course_id === 0 || enrollment.term_id === 0) {
+      return;
+    }
+    getSections(enrollment.course_id, enrollment.term_id)
+      .then((res) => setSections(res.data))
+      .catch((err) => console.error(err));
+  }, [enrollment.course_id, enrollment.term_id]);
+
   const fetchStudentsAndCourses = async () => {
     setDataLoading(true);
-    setError(null); // Clear errors before fetching
+    setLoadError(null); // Clear errors before fetching
     try {
       // Fetch students and courses to populate dropdowns
       // TODO: Backend getStudents/getCourses should be filtered for faculty if needed
-      const [studentsRes, coursesRes] = await Promise.all([
+      const [studentsRes, coursesRes, termsRes] = await Promise.all([
         getStudents(), // Consider filtering this on backend for faculty
         getCourses(), // Consider filtering this on backend for faculty
+        getTerms(),
       ]);
       setStudents(studentsRes.data);
       setCourses(coursesRes.data);
+      setTerms(termsRes.data);
       setDataLoading(false);
     } catch (err: any) {
-      setError(`Failed to load data for form: ${err.response?.data?.error || err.message}`);
+      setLoadError(`Failed to load data for form: ${err.response?.data?.error || err.message}`);
       setDataLoading(false);
       console.error(err);
     }
@@ -43,9 +61,13 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
 
   const handleChange = (e: React.ChangeEvent<HTMLSelectElement>) => {
     const { name, value } = e.target;
+    const id = parseInt(value, 10); // Parse selected value as integer ID
+    setUnmet([]);
     setEnrollment({
       ...enrollment,
-      [name]: parseInt(value, 10), // Parse selected value as integer ID
+      // Changing the course or term invalidates the selected section
+      ...(name === 'section_id' ? {} : { section_id: null }),
+      [name]: name === 'section_id' && id === 0 ? null : id,
     });
   };
 
@@ -55,17 +77,28 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
     setError(null); // Clear errors before submission
 
     // Client-side validation
-    if (enrollment.student_id === 0 || enrollment.course_id === 0) {
-      setError("Please select a student and a course.");
+    if (enrollment.student_id === 0 || enrollment.course_id === 0 || enrollment.term_id === 0) {
+      setError("Please select a student, a course and a term.");
+      setLoading(false);
+      return;
+    }
+
+    if (sections.length > 0 && !enrollment.section_id) {
+      setError("Please select a section.");
       setLoading(false);
       return;
     }
 
     try {
-      await createEnrollment(enrollment);
-      alert('Enrollment created successfully!'); // Consider a better UI notification
+      const res = await createEnrollment(enrollment);
+      if (res.status === 202 && 'position' in res.data) {
+        alert(`The section is full, the student is on the waitlist at position ${res.data.position}.`);
+      } else {
+        alert('Enrollment created successfully!'); // Consider a better UI notification
+      }
       onSuccess(); // Call success callback to navigate back
     } catch (err: any) {
+      setUnmet(err.response?.status === 422 ? err.response.data.unmet_requirements : []);
       setError(`Failed to create enrollment: ${err.response?.data?.error || err.message}`);
       console.error(err);
     } finally {
@@ -78,8 +111,8 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
   }
 
   // Show error if initial data fetch failed
-  if (error && !dataLoading) {
-    return <div className="text-center text-red-600">{error}</div>;
+  if (loadError && !dataLoading) {
+    return <div className="text-center text-red-600">{loadError}</div>;
   }
 
 
@@ -107,7 +140,7 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
             ))}
           </select>
         </div>
-        <div className="mb-6">
+        <div className="mb-4">
           <label className="block text-gray-700 text-sm font-semibold mb-2" htmlFor="course_id">
             Select Course:
           </label>
@@ -127,8 +160,84 @@ function EnrollmentForm({ onSuccess }: EnrollmentFormProps) {
             ))}
           </select>
         </div>
+        <div className="mb-6">
+          <label className="block text-gray-700 text-sm font-semibold mb-2" htmlFor="term_id">
+            Select Term:
+          </label>
+          <select
+            id="term_id"
+            name="term_id"
+            value={enrollment.term_id}
+            onChange={handleChange}
+            className="shadow-sm appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+            required
+          >
+            <option value={0}>-- Select Term --</option>
+            {terms.map((term) => (
+              <option key={term.id} value={term.id}>
+                {term.name} (enrollment {term.enrollment_opens.slice(0, 10)} to {term.enrollment_closes.slice(0, 10)})
+              </option>
+            ))}
+          </select>
+        </div>
+        {sections.length > 0 && (
+          <div className="mb-6">
+            <label className="block text-gray-700 text-sm font-semibold mb-2" htmlFor="section_id">
+              Select Section:
+            </label>
+            <select
+              id="section_id"
+              name="section_id"
+              value={enrollment.section_id ?? 0}
+              onChange={handleChange}
+              className="shadow-sm appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+              required
+            >
+              <option value={0}>-- Select Section --</option>
+              {sections.map((section) => (
+                <option key={section.id} value={section.id}>
+                  {section.section_number} {section.meeting_times} ({section.enrolled >= section.capacity
+                    ? `full, ${section.waitlisted} waitlisted`
+                    : `${section.capacity - section.enrolled} seats left`})
+                </option>
+              ))}
+            </select>
+          </div>
+        )}
         {/* Show submission error if any */}
         {error && !dataLoading && <p className="text-red-600 text-xs italic mb-4">{error}</p>}
+        {unmet.length > 0 && (
+          <div className="mb-4 text-sm text-gray-700">
+            <p className="font-semibold mb-1">Missing requirements (one of each group):</p>
+            <ul className="list-disc list-inside mb-2">
+              {unmet.map((req) => (
+                <li key={`${req.group}-${req.required_course_id}`}>
+                  Group {req.group}: {req.required_course_code}
+                  {req.min_grade !== null && ` with at least ${req.min_grade.toFixed(2)}`}
+                  {req.corequisite && ' (may be taken in the same term)'}
+                </li>
+              ))}
+            </ul>
+            <label className="flex items-center mb-2">
+              <input
+                type="checkbox"
+                checked={enrollment.override_prerequisites ?? false}
+                onChange={(e) => setEnrollment({ ...enrollment, override_prerequisites: e.target.checked })}
+                className="mr-2"
+              />
+              Override prerequisites (recorded)
+            </label>
+            {enrollment.override_prerequisites && (
+              <input
+                type="text"
+                placeholder="Reason for the override"
+                value={enrollment.override_reason ?? ''}
+                onChange={(e) => setEnrollment({ ...enrollment, override_reason: e.target.value })}
+                className="shadow-sm appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+              />
+            )}
+          </div>
+        )}
         <div className="flex items-center justify-between">
           <button
             type="submit"
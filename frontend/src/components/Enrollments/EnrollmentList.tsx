@@ -101,6 +101,7 @@ function EnrollmentList({ onAddEnrollment, userRole, userId }: EnrollmentListPro
                   <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">ID</th>
                   <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">Student</th>
                   <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">Course</th>
+                  <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">Term</th>
                   <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">Enrollment Date</th>
                   {userRole === 'faculty' && ( // Only faculty sees actions column
                     <th className="py-3 px-4 border-b text-left text-sm font-semibold text-gray-700">Actions</th>
@@ -113,6 +114,7 @@ function EnrollmentList({ onAddEnrollment, userRole, userId }: EnrollmentListPro
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{enrollment.id}</td>
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{getStudentName(enrollment.student_id)}</td>
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{getCourseTitle(enrollment.course_id)}</td>
+                    <td className="py-3 px-4 border-b text-sm text-gray-700">{enrollment.term_id}</td>
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{enrollment.enrollment_date ? new Date(enrollment.enrollment_date).toLocaleDateString() : 'N/A'}</td>
                     {userRole === 'faculty' && ( // Only faculty sees action buttons
                       <td className="py-3 px-4 border-b text-sm text-gray-700">
@@ -1,6 +1,6 @@
 import { useEffect, useState } from 'react';
-import { Student, StudentTranscript, Grade,  TranscriptCourse } from '../../types/types';
-import { getStudent, getStudentTranscript, calculateStudentGPA, addGrade, updateGrade, deleteGrade } from '../../api/api';
+import { Student, StudentTranscript, Grade,  TranscriptCourse, WaitlistEntry } from '../../types/types';
+import { getStudent, getStudentTranscript, calculateStudentGPA, getStudentWaitlist, addGrade, updateGrade, deleteGrade } from '../../api/api';
 
 interface StudentDetailsProps {
   studentId: number;
@@ -13,6 +13,7 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
   const [student, setStudent] = useState<Student | null>(null);
   const [transcript, setTranscript] = useState<StudentTranscript | null>(null);
   const [gpa, setGpa] = useState<number | null>(null);
+  const [waitlist, setWaitlist] = useState<WaitlistEntry[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const [showGradeModal, setShowGradeModal] = useState(false);
@@ -32,15 +33,17 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
       setLoading(true);
       setError(null);
       try {
-        const [studentRes, transcriptRes, gpaRes] = await Promise.all([
+        const [studentRes, transcriptRes, gpaRes, waitlistRes] = await Promise.all([
           getStudent(studentId),
           getStudentTranscript(studentId),
           calculateStudentGPA(studentId),
+          getStudentWaitlist(studentId),
         ]);
 
         setStudent(studentRes.data);
         setTranscript(transcriptRes.data);
         setGpa(gpaRes.data.gpa);
+        setWaitlist(waitlistRes.data);
 
       } catch (err: any) {
         setError(`Failed to load student data: ${err.response?.data?.error || err.message}`);
@@ -71,6 +74,7 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
     setGradeForm({
       enrollment_id: transcriptCourse.enrollment_id,
       grade: transcriptCourse.grade,
+      mark: transcriptCourse.mark,
       semester: transcriptCourse.semester ?? 0,
     });
     setIsEditingGrade(true);
@@ -106,8 +110,10 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
 
   const handleGradeFormChange = (e: React.ChangeEvent<HTMLInputElement | HTMLSelectElement>) => {
     const { name, value } = e.target;
+    // A grade is either points or a mark, the other one is derived by the backend
     setGradeForm({
       ...gradeForm,
+      ...(name === 'grade' ? { mark: undefined } : name === 'mark' ? { grade: undefined } : {}),
       [name]: name === 'grade' ? parseFloat(value) || undefined : name === 'semester' ? parseInt(value, 10) || 0 : value,
     });
   };
@@ -122,13 +128,6 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
     setLoading(true);
     setError(null);
 
-
-    if (gradeForm.semester === 0) {
-      setError("Semester is required.");
-      setLoading(false);
-      return;
-    }
-
     try {
       if (isEditingGrade && currentGradeId !== null) {
         await updateGrade(currentGradeId, gradeForm);
@@ -217,7 +216,7 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{course.course_title}</td>
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{course.credits}</td>
                     <td className="py-3 px-4 border-b text-sm text-gray-700">{course.semester ?? 'N/A'}</td>
-                    <td className="py-3 px-4 border-b text-sm text-gray-700">{course.grade?.toFixed(2) ?? 'N/A'}</td>
+                    <td className="py-3 px-4 border-b text-sm text-gray-700">{[course.mark, course.grade?.toFixed(2)].filter(Boolean).join(' ') || 'N/A'}</td>
                     {userRole === 'faculty' && (
                       <td className="py-3 px-4 border-b text-sm text-gray-700">
                         {course.grade_id !== null && course.grade_id !== undefined ? (
@@ -254,6 +253,19 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
             <p className="text-gray-600">No transcript data available.</p>
           )}
 
+        {waitlist.length > 0 && (
+          <>
+            <h4 className="text-lg font-semibold text-gray-700 mt-4 mb-2">Waitlists</h4>
+            <ul className="list-disc list-inside text-sm text-gray-700">
+              {waitlist.map((entry) => (
+                <li key={entry.id}>
+                  Course {entry.course_id}, section {entry.section_number} in term {entry.term_id}: position {entry.position}
+                </li>
+              ))}
+            </ul>
+          </>
+        )}
+
 
 
       </div>
@@ -280,9 +292,22 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
 
                 />
               </div>
+              <div className="mb-4">
+                <label className="block text-gray-700 text-sm font-semibold mb-2" htmlFor="mark">
+                  Or mark (e.g., A-, P, W):
+                </label>
+                <input
+                  type="text"
+                  id="mark"
+                  name="mark"
+                  value={gradeForm.mark ?? ''}
+                  onChange={handleGradeFormChange}
+                  className="shadow-sm appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                />
+              </div>
               <div className="mb-6">
                 <label className="block text-gray-700 text-sm font-semibold mb-2" htmlFor="semester">
-                  Semester (e.g., 20231):
+                  Term (e.g., 20231, empty for the term of the enrollment):
                 </label>
                 <input
                   type="number"
@@ -291,7 +316,6 @@ function StudentDetails({ studentId, onBack, userRole, userId }: StudentDetailsP
                   value={gradeForm.semester || ''}
                   onChange={handleGradeFormChange}
                   className="shadow-sm appearance-none border rounded w-full py-2 px-3 text-gray-700 leading-tight focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent"
-                  required
                 />
               </div>
 
@@ -21,22 +21,85 @@ export interface Course {
   code: string;
   title: string;
   credits: number;
+  grading_scale_id?: number | null;
+}
+
+export interface Term {
+  id: number;
+  name: string;
+  start_date: string;
+  end_date: string;
+  enrollment_opens: string;
+  enrollment_closes: string;
+  grades_due: string;
 }
 
 export interface Enrollment {
   id?: number;
   student_id: number;
   course_id: number;
+  term_id: number;
+  section_id?: number | null;
   enrollment_date?: string;
+  override_prerequisites?: boolean;
+  override_reason?: string;
+}
+
+export interface CoursePrerequisite {
+  group: number;
+  required_course_id: number;
+  required_course_code?: string;
+  min_grade: number | null;
+  corequisite: boolean;
+}
+
+export interface CourseSection {
+  id: number;
+  course_id: number;
+  term_id: number;
+  section_number: string;
+  instructor_id: number | null;
+  capacity: number;
+  room: string;
+  meeting_times: string;
+  enrolled: number;
+  waitlisted: number;
+}
+
+export interface WaitlistEntry {
+  id: number;
+  student_id: number;
+  section_id: number;
+  course_id: number;
+  term_id: number;
+  section_number: string;
+  position: number;
+  created_at: string;
 }
 
 export interface Grade {
   id?: number;
   enrollment_id: number;
-  grade?: number;
+  grade?: number | null;
+  mark?: string | null;
   semester: number;
 }
 
+export interface GradeMark {
+  mark: string;
+  description: string;
+  points: number | null;
+  kind: 'graded' | 'pass' | 'fail' | 'incomplete' | 'withdrawn';
+}
+
+export interface GradingScale {
+  id?: number;
+  name: string;
+  is_default: boolean;
+  programs: string[];
+  marks: GradeMark[];
+}
+
 export interface TranscriptCourse {
   enrollment_id: number;
   course_code: string;
@@ -44,6 +107,7 @@ export interface TranscriptCourse {
   credits: number;
   grade_id?: number;
   grade?: number;
+  mark?: string;
   semester?: number;
 }
 
@@ -53,6 +117,27 @@ export interface StudentTranscript {
   courses: TranscriptCourse[];
 }
 
+export interface SemesterGPA {
+  semester: number;
+  term_name: string;
+  sgpa: number | null;
+  sgpa_mark: string | null;
+  credits_attempted: number;
+  credits_earned: number;
+  cgpa: number;
+  cgpa_mark: string | null;
+}
+
+export interface GPAReport {
+  student_id: number;
+  gpa: number;
+  gpa_mark: string | null;
+  retake_policy: 'latest' | 'best' | 'average';
+  credits_attempted: number;
+  credits_earned: number;
+  semesters: SemesterGPA[];
+}
+
 export interface LoginRequest {
   id: number;
   password: string;
@@ -65,3 +150,8 @@ export interface AuthResponse {
   id: number;
 }
 
+export interface Page<T> {
+  items: T[];
+  next_cursor?: string;
+  total_count: number;
+}